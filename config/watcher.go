@@ -0,0 +1,125 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+// WatchableSource is a ConfigSource whose document can change at runtime, such as
+// a key in etcd or a zookeeper node.
+type WatchableSource interface {
+	ConfigSource
+	// Watch calls onChange with the current document and again after every change,
+	// until ctx is done. It blocks and returns ctx.Err() once ctx is done.
+	Watch(ctx context.Context, onChange func(data []byte)) error
+}
+
+// Watcher keeps a parsed configuration of type T in sync with a WatchableSource and
+// notifies callbacks with the newly parsed value, so it can be hot reloaded.
+type Watcher[T any] struct {
+	source WatchableSource
+	parser Parser
+
+	mu        sync.RWMutex
+	data      []byte
+	current   *T
+	callbacks []func(old, new *T)
+}
+
+// NewWatcher creates a Watcher. A nil parser parses YAML.
+func NewWatcher[T any](source WatchableSource, parser Parser) *Watcher[T] {
+	if parser == nil {
+		parser = &YAMLParser{}
+	}
+	return &Watcher[T]{source: source, parser: parser}
+}
+
+// Load reads and parses the document once and makes it the current configuration.
+func (w *Watcher[T]) Load() (*T, error) {
+	data, err := w.source.Read()
+	if err != nil {
+		return nil, err
+	}
+	conf, err := w.parse(data)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.data = data
+	w.current = conf
+	return conf, nil
+}
+
+// Get returns the current configuration, nil before the first successful load.
+// The returned value must not be modified.
+func (w *Watcher[T]) Get() *T {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// OnChange registers fn to be called with the previous and the new configuration
+// after every reload. old is nil for the first load done by Run.
+func (w *Watcher[T]) OnChange(fn func(old, new *T)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callbacks = append(w.callbacks, fn)
+}
+
+// Run watches the source and reloads the configuration until ctx is done. Documents
+// that fail to parse are logged and ignored, the previous configuration stays current.
+func (w *Watcher[T]) Run(ctx context.Context) error {
+	return w.source.Watch(ctx, func(data []byte) {
+		w.reload(ctx, data)
+	})
+}
+
+func (w *Watcher[T]) reload(ctx context.Context, data []byte) {
+	w.mu.RLock()
+	unchanged := w.current != nil && bytes.Equal(w.data, data)
+	w.mu.RUnlock()
+	if unchanged {
+		return
+	}
+	conf, err := w.parse(data)
+	if err != nil {
+		log.ZWarn(ctx, "config reload ignored", err)
+		return
+	}
+	w.mu.Lock()
+	old := w.current
+	w.data = data
+	w.current = conf
+	callbacks := append([]func(old, new *T){}, w.callbacks...)
+	w.mu.Unlock()
+	for _, fn := range callbacks {
+		fn(old, conf)
+	}
+}
+
+func (w *Watcher[T]) parse(data []byte) (*T, error) {
+	var conf T
+	if err := w.parser.Parse(data, &conf); err != nil {
+		return nil, errs.WrapMsg(err, "parse config failed")
+	}
+	return &conf, nil
+}
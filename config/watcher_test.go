@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// The default logger writes to ./logs, keep the watcher logs on stdout.
+	if err := log.InitLoggerFromConfig("test", "config", "", "", log.LevelDebug, true, false, "", 1, 24, "test", false); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// memorySource is a WatchableSource fed through a channel.
+type memorySource struct {
+	data    []byte
+	updates chan []byte
+}
+
+func (m *memorySource) Read() ([]byte, error) {
+	return m.data, nil
+}
+
+func (m *memorySource) Watch(ctx context.Context, onChange func(data []byte)) error {
+	onChange(m.data)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case data := <-m.updates:
+			onChange(data)
+		}
+	}
+}
+
+type reloadConfig struct {
+	LogLevel  int `yaml:"logLevel"`
+	RateLimit int `yaml:"rateLimit"`
+}
+
+func TestWatcher(t *testing.T) {
+	source := &memorySource{data: []byte("logLevel: 3\nrateLimit: 100\n"), updates: make(chan []byte)}
+	watcher := NewWatcher[reloadConfig](source, nil)
+	conf, err := watcher.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 3, conf.LogLevel)
+
+	changes := make(chan [2]*reloadConfig, 4)
+	watcher.OnChange(func(old, new *reloadConfig) {
+		changes <- [2]*reloadConfig{old, new}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Run(ctx) }()
+
+	source.updates <- []byte("logLevel: 6\nrateLimit: 100\n")
+	select {
+	case change := <-changes:
+		assert.Equal(t, 3, change[0].LogLevel)
+		assert.Equal(t, 6, change[1].LogLevel)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload not reported")
+	}
+
+	source.updates <- []byte("logLevel: [")
+	source.updates <- []byte("logLevel: 6\nrateLimit: 100\n")
+	assert.Equal(t, 6, watcher.Get().LogLevel, "invalid documents keep the current config")
+	assert.Empty(t, changes, "unchanged documents are not reported")
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
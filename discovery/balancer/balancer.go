@@ -0,0 +1,94 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package balancer registers gRPC load balancing policies that read the discovery.Metadata
+// attached to resolver addresses by the registries. Select one with WithPolicy.
+package balancer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/openimsdk/tools/discovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+const (
+	// RoundRobin is the gRPC builtin round robin policy.
+	RoundRobin = "round_robin"
+	// WeightedRoundRobin spreads requests in proportion to the instance weights.
+	WeightedRoundRobin = "openim_weighted_round_robin"
+	// LeastRequest sends each request to the instance with the fewest requests in flight.
+	LeastRequest = "openim_least_request"
+	// ZoneAware prefers instances in the local zone and falls back to all instances.
+	ZoneAware = "openim_zone_aware"
+	// ConsistentHash routes requests with the same hash key to the same instance.
+	ConsistentHash = "openim_consistent_hash"
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(WeightedRoundRobin, &wrrPickerBuilder{}, base.Config{HealthCheck: true}))
+	balancer.Register(leastRequestBuilder{})
+	balancer.Register(base.NewBalancerBuilder(ZoneAware, &zonePickerBuilder{}, base.Config{HealthCheck: true}))
+	balancer.Register(base.NewBalancerBuilder(ConsistentHash, &hashPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// WithPolicy returns a dial option selecting the load balancing policy name.
+// It works with the connections returned by GetConn of every registry.
+func WithPolicy(name string) grpc.DialOption {
+	return grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingPolicy": "%s"}`, name))
+}
+
+var (
+	localMu   sync.RWMutex
+	localZone string
+)
+
+// SetLocalZone sets the zone preferred by the ZoneAware policy.
+func SetLocalZone(zone string) {
+	localMu.Lock()
+	defer localMu.Unlock()
+	localZone = zone
+}
+
+// LocalZone returns the zone set by SetLocalZone.
+func LocalZone() string {
+	localMu.RLock()
+	defer localMu.RUnlock()
+	return localZone
+}
+
+// readySubConn is a ready SubConn with the metadata of its address.
+type readySubConn struct {
+	addr     string
+	subConn  balancer.SubConn
+	metadata *discovery.Metadata
+}
+
+// readySubConns returns the ready SubConns ordered by address, so pickers built
+// from the same set behave the same way.
+func readySubConns(info base.PickerBuildInfo) []readySubConn {
+	scs := make([]readySubConn, 0, len(info.ReadySCs))
+	for sc, scInfo := range info.ReadySCs {
+		md, _ := discovery.GetAddressMetadata(scInfo.Address)
+		scs = append(scs, readySubConn{addr: scInfo.Address.Addr, subConn: sc, metadata: md})
+	}
+	sort.Slice(scs, func(i, j int) bool {
+		return scs[i].addr < scs[j].addr
+	})
+	return scs
+}
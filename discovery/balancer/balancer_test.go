@@ -0,0 +1,144 @@
+package balancer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/discovery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func buildInfo(mds map[string]*discovery.Metadata) base.PickerBuildInfo {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for addr, md := range mds {
+		address := discovery.SetAddressMetadata(resolver.Address{Addr: addr}, md)
+		info.ReadySCs[&fakeSubConn{addr: addr}] = base.SubConnInfo{Address: address}
+	}
+	return info
+}
+
+func pick(t *testing.T, p balancer.Picker, ctx context.Context) (string, func(balancer.DoneInfo)) {
+	res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+	require.NoError(t, err)
+	return res.SubConn.(*fakeSubConn).addr, res.Done
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	p := (&wrrPickerBuilder{}).Build(buildInfo(map[string]*discovery.Metadata{
+		"a:1": {Weight: 1},
+		"b:1": {Weight: 3},
+		"c:1": nil,
+	}))
+	counts := make(map[string]int)
+	for i := 0; i < 104; i++ {
+		addr, _ := pick(t, p, context.Background())
+		counts[addr]++
+	}
+	assert.Equal(t, map[string]int{"a:1": 1, "b:1": 3, "c:1": 100}, counts)
+
+	_, err := (&wrrPickerBuilder{}).Build(base.PickerBuildInfo{}).Pick(balancer.PickInfo{})
+	assert.ErrorIs(t, err, balancer.ErrNoSubConnAvailable)
+}
+
+func TestLeastRequest(t *testing.T) {
+	p := (&leastRequestPickerBuilder{}).Build(buildInfo(map[string]*discovery.Metadata{"a:1": nil, "b:1": nil}))
+	first, done := pick(t, p, context.Background())
+	second, _ := pick(t, p, context.Background())
+	assert.NotEqual(t, first, second, "the busy instance must be skipped")
+
+	done(balancer.DoneInfo{})
+	third, _ := pick(t, p, context.Background())
+	assert.Equal(t, first, third)
+}
+
+func TestLeastRequestAcrossRebuilds(t *testing.T) {
+	b := &leastRequestPickerBuilder{}
+	info := buildInfo(map[string]*discovery.Metadata{"a:1": nil, "b:1": nil})
+	first, done := pick(t, b.Build(info), context.Background())
+
+	// A state change rebuilds the picker, the call in flight must still be counted.
+	second, secondDone := pick(t, b.Build(info), context.Background())
+	assert.NotEqual(t, first, second, "the busy instance must be skipped after a rebuild")
+
+	// Finishing a call picked by an older picker frees its instance in the current one.
+	p := b.Build(info)
+	done(balancer.DoneInfo{})
+	third, thirdDone := pick(t, p, context.Background())
+	assert.Equal(t, first, third)
+
+	// Counters of removed SubConns are kept while calls are in flight and dropped once idle.
+	count := func() int {
+		n := 0
+		b.counters.Range(func(any, any) bool { n++; return true })
+		return n
+	}
+	b.Build(base.PickerBuildInfo{})
+	assert.Equal(t, 2, count())
+	secondDone(balancer.DoneInfo{})
+	thirdDone(balancer.DoneInfo{})
+	b.Build(base.PickerBuildInfo{})
+	assert.Equal(t, 0, count())
+}
+
+func TestZoneAware(t *testing.T) {
+	defer SetLocalZone("")
+	info := buildInfo(map[string]*discovery.Metadata{
+		"a:1": {Zone: "zone-a"},
+		"b:1": {Zone: "zone-b"},
+		"c:1": {Zone: "zone-a"},
+	})
+
+	SetLocalZone("zone-a")
+	p := (&zonePickerBuilder{}).Build(info)
+	for i := 0; i < 10; i++ {
+		addr, _ := pick(t, p, context.Background())
+		assert.Contains(t, []string{"a:1", "c:1"}, addr)
+	}
+
+	SetLocalZone("zone-c")
+	p = (&zonePickerBuilder{}).Build(info)
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		addr, _ := pick(t, p, context.Background())
+		seen[addr] = true
+	}
+	assert.Len(t, seen, 3, "without local instances every zone is used")
+}
+
+func TestConsistentHash(t *testing.T) {
+	mds := make(map[string]*discovery.Metadata)
+	for i := 0; i < 5; i++ {
+		mds["10.0.0."+strconv.Itoa(i)+":10110"] = nil
+	}
+	p := (&hashPickerBuilder{}).Build(buildInfo(mds))
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(constant.OpUserID, "user1"))
+	first, _ := pick(t, p, ctx)
+	for i := 0; i < 10; i++ {
+		addr, _ := pick(t, p, ctx)
+		assert.Equal(t, first, addr)
+	}
+
+	valueCtx := context.WithValue(context.Background(), constant.OpUserID, "user1")
+	addr, _ := pick(t, p, valueCtx)
+	assert.Equal(t, first, addr)
+
+	seen := make(map[string]bool)
+	for i := 0; i < len(mds); i++ {
+		addr, _ := pick(t, p, context.Background())
+		seen[addr] = true
+	}
+	assert.Len(t, seen, len(mds), "requests without a key are spread over every instance")
+}
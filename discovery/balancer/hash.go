@@ -0,0 +1,96 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/discovery"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	hashMu   sync.RWMutex
+	hashKeys = []string{constant.OpUserID, constant.OperationID}
+)
+
+// SetHashKeys sets the request keys used by the ConsistentHash policy, in order of preference.
+// Each key is looked up in the outgoing gRPC metadata and then in the context values.
+// The default is the operator user ID followed by the operation ID.
+func SetHashKeys(keys ...string) {
+	hashMu.Lock()
+	defer hashMu.Unlock()
+	hashKeys = append([]string(nil), keys...)
+}
+
+func hashKey(ctx context.Context) string {
+	hashMu.RLock()
+	keys := hashKeys
+	hashMu.RUnlock()
+	md, _ := metadata.FromOutgoingContext(ctx)
+	for _, key := range keys {
+		if vals := md.Get(key); len(vals) > 0 && vals[0] != "" {
+			return vals[0]
+		}
+		if val, ok := ctx.Value(key).(string); ok && val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+type hashPickerBuilder struct{}
+
+func (*hashPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	scs := readySubConns(info)
+	if len(scs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &hashPicker{
+		ring:     discovery.NewHashRing(discovery.DefaultReplicas, nil),
+		subConns: make(map[string]balancer.SubConn, len(scs)),
+		ordered:  make([]balancer.SubConn, len(scs)),
+	}
+	for i, sc := range scs {
+		p.ring.Add(sc.addr)
+		p.subConns[sc.addr] = sc.subConn
+		p.ordered[i] = sc.subConn
+	}
+	return p
+}
+
+// hashPicker maps the request hash key onto a ring of instance addresses. Requests
+// without a key are spread round robin.
+type hashPicker struct {
+	ring     *discovery.HashRing
+	subConns map[string]balancer.SubConn
+	ordered  []balancer.SubConn
+	next     atomic.Uint32
+}
+
+func (p *hashPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	if key := hashKey(info.Ctx); key != "" {
+		if addr, ok := p.ring.Get(key); ok {
+			return balancer.PickResult{SubConn: p.subConns[addr]}, nil
+		}
+	}
+	i := p.next.Add(1)
+	return balancer.PickResult{SubConn: p.ordered[i%uint32(len(p.ordered))]}, nil
+}
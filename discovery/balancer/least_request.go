@@ -0,0 +1,96 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// leastRequestBuilder gives every ClientConn its own picker builder, so the in-flight
+// counters kept per SubConn are never shared between channels.
+type leastRequestBuilder struct{}
+
+func (leastRequestBuilder) Name() string {
+	return LeastRequest
+}
+
+func (leastRequestBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	return base.NewBalancerBuilder(LeastRequest, &leastRequestPickerBuilder{}, base.Config{HealthCheck: true}).Build(cc, opts)
+}
+
+// leastRequestPickerBuilder keeps the in-flight counter of each SubConn across picker
+// rebuilds. base rebuilds the picker on every SubConn state change, and calls picked
+// earlier must still be counted against the SubConn they run on.
+type leastRequestPickerBuilder struct {
+	counters sync.Map // balancer.SubConn -> *atomic.Int64
+}
+
+func (b *leastRequestPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	scs := readySubConns(info)
+	ready := make(map[balancer.SubConn]struct{}, len(scs))
+	p := &leastRequestPicker{subConns: make([]*countedSubConn, len(scs))}
+	for i, sc := range scs {
+		ready[sc.subConn] = struct{}{}
+		counter, _ := b.counters.LoadOrStore(sc.subConn, new(atomic.Int64))
+		p.subConns[i] = &countedSubConn{subConn: sc.subConn, inflight: counter.(*atomic.Int64)}
+	}
+	// Forget SubConns that are gone once their last call has finished.
+	b.counters.Range(func(sc, counter any) bool {
+		if _, ok := ready[sc.(balancer.SubConn)]; !ok && counter.(*atomic.Int64).Load() == 0 {
+			b.counters.Delete(sc)
+		}
+		return true
+	})
+	if len(scs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	return p
+}
+
+type countedSubConn struct {
+	subConn  balancer.SubConn
+	inflight *atomic.Int64
+}
+
+// leastRequestPicker picks the SubConn with the fewest outstanding requests. Ties are
+// broken by rotating the scan start so idle instances share the load.
+type leastRequestPicker struct {
+	subConns []*countedSubConn
+	next     atomic.Uint32
+}
+
+func (p *leastRequestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	n := uint32(len(p.subConns))
+	start := p.next.Add(1)
+	var best *countedSubConn
+	var least int64
+	for i := uint32(0); i < n; i++ {
+		sc := p.subConns[(start+i)%n]
+		if inflight := sc.inflight.Load(); best == nil || inflight < least {
+			best, least = sc, inflight
+		}
+	}
+	best.inflight.Add(1)
+	return balancer.PickResult{
+		SubConn: best.subConn,
+		Done: func(balancer.DoneInfo) {
+			best.inflight.Add(-1)
+		},
+	}, nil
+}
@@ -0,0 +1,74 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+type wrrPickerBuilder struct{}
+
+func (*wrrPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	scs := readySubConns(info)
+	if len(scs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	return newWRRPicker(scs)
+}
+
+type weightedSubConn struct {
+	subConn balancer.SubConn
+	weight  int
+	current int
+}
+
+// wrrPicker implements smooth weighted round robin: every pick raises each current weight
+// by its weight and takes the largest, which interleaves instances instead of bursting.
+type wrrPicker struct {
+	mu       sync.Mutex
+	subConns []*weightedSubConn
+	total    int
+}
+
+func newWRRPicker(scs []readySubConn) *wrrPicker {
+	p := &wrrPicker{subConns: make([]*weightedSubConn, len(scs))}
+	for i, sc := range scs {
+		weight := sc.metadata.GetWeight()
+		p.subConns[i] = &weightedSubConn{subConn: sc.subConn, weight: weight}
+		p.total += weight
+	}
+	return p
+}
+
+func (p *wrrPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	return balancer.PickResult{SubConn: p.next()}, nil
+}
+
+func (p *wrrPicker) next() balancer.SubConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var best *weightedSubConn
+	for _, sc := range p.subConns {
+		sc.current += sc.weight
+		if best == nil || sc.current > best.current {
+			best = sc
+		}
+	}
+	best.current -= p.total
+	return best.subConn
+}
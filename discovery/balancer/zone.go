@@ -0,0 +1,43 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balancer
+
+import (
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+type zonePickerBuilder struct{}
+
+// Build keeps the instances of the local zone and balances over them by weight.
+// When the local zone is unset or has no ready instance, every instance is used.
+func (*zonePickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	scs := readySubConns(info)
+	if len(scs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	if zone := LocalZone(); zone != "" {
+		local := make([]readySubConn, 0, len(scs))
+		for _, sc := range scs {
+			if sc.metadata != nil && sc.metadata.Zone == zone {
+				local = append(local, sc)
+			}
+		}
+		if len(local) > 0 {
+			scs = local
+		}
+	}
+	return newWRRPicker(scs)
+}
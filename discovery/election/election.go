@@ -0,0 +1,84 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package election provides leader election and distributed locks on top of the
+// etcd and zookeeper discovery backends, behind backend independent interfaces.
+package election
+
+import (
+	"context"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+var (
+	// ErrLocked is returned by TryLock when the lock is held by another instance.
+	ErrLocked = errs.New("lock is held by another instance")
+	// ErrNoLeader is returned by Leader when no instance is campaigning.
+	ErrNoLeader = errs.New("election has no leader")
+	// ErrNotLocked is returned by Unlock when the lock is not held.
+	ErrNotLocked = errs.New("lock is not held")
+	// ErrCampaigning is returned by Campaign while the same Election campaigns or leads.
+	ErrCampaigning = errs.New("election is already campaigned by this instance")
+	// ErrAlreadyLocked is returned by Lock and TryLock while the same Mutex acquires or holds the lock.
+	ErrAlreadyLocked = errs.New("lock is already held by this instance")
+)
+
+// Election elects a single leader among the instances campaigning under the same name.
+type Election interface {
+	// Campaign blocks until this instance becomes the leader or ctx is done.
+	// value is published as the leader value while this instance leads. It returns
+	// ErrCampaigning while a previous Campaign is pending or its leadership is held.
+	Campaign(ctx context.Context, value string) error
+	// Resign gives up the leadership won by Campaign. It is a no-op when not leading.
+	Resign(ctx context.Context) error
+	// Leader returns the value of the current leader, or ErrNoLeader.
+	Leader(ctx context.Context) (string, error)
+	// Observe returns a channel receiving the value of every new leader, "" when nobody leads.
+	// The channel is closed once ctx is done.
+	Observe(ctx context.Context) <-chan string
+	// Done is closed when this instance loses or resigns the leadership won by Campaign,
+	// e.g. because its session expired. Leader-only work must stop when it is closed.
+	Done() <-chan struct{}
+}
+
+// Mutex is a distributed lock. A Mutex must not be shared by goroutines that need to
+// exclude each other, create one per holder instead.
+type Mutex interface {
+	// Lock blocks until the lock is acquired or ctx is done. Lock and TryLock return
+	// ErrAlreadyLocked while this Mutex is acquiring or holding the lock.
+	Lock(ctx context.Context) error
+	// TryLock acquires the lock or returns ErrLocked without waiting.
+	TryLock(ctx context.Context) error
+	// Unlock releases the lock.
+	Unlock(ctx context.Context) error
+	// Done is closed when this Mutex loses or releases the lock, e.g. because its session
+	// expired. A lost lock no longer counts as held, it can be locked again. Work guarded by
+	// the lock must stop when it is closed.
+	Done() <-chan struct{}
+}
+
+// Provider creates elections and locks on one backend, so callers do not depend on
+// which discovery backend is configured.
+type Provider interface {
+	NewElection(name string) Election
+	NewMutex(name string) Mutex
+}
+
+// closedChan is returned by Done when no leadership or lock is held.
+var closedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
@@ -0,0 +1,265 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/discovery/internal/zktest"
+	"github.com/openimsdk/tools/discovery/zookeeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func freeURL(t *testing.T) url.URL {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	u, err := url.Parse("http://" + lis.Addr().String())
+	require.NoError(t, err)
+	return *u
+}
+
+// startEtcd runs an embedded single-node etcd and returns a client connected to it.
+func startEtcd(t *testing.T) *clientv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, peerURL.String())
+	e, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("embedded etcd did not start")
+	}
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{clientURL.Host}, DialTimeout: 5 * time.Second})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// startZookeeper runs an in-process zookeeper server.
+func startZookeeper(t *testing.T) *zktest.Server {
+	server, err := zktest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newZkClient returns a client with its own session on server.
+func newZkClient(t *testing.T, server *zktest.Server) *zookeeper.ZkClient {
+	client, err := zookeeper.NewZkClient([]string{server.Addr()}, "openim", zookeeper.WithTimeout(2))
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return client
+}
+
+// waitLeader reads leaders until want is observed.
+func waitLeader(t *testing.T, leaders <-chan string, want string) {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case value, ok := <-leaders:
+			require.True(t, ok, "observe channel closed before %q was observed", want)
+			if value == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("leader %q not observed", want)
+		}
+	}
+}
+
+// testMutex checks mutual exclusion between two mutexes of the same name.
+func testMutex(t *testing.T, first, second Mutex) {
+	ctx := context.Background()
+	require.NoError(t, first.TryLock(ctx))
+	assert.ErrorIs(t, first.TryLock(ctx), ErrAlreadyLocked)
+	assert.ErrorIs(t, second.TryLock(ctx), ErrLocked)
+
+	locked := make(chan error, 1)
+	go func() { locked <- second.Lock(ctx) }()
+	select {
+	case <-locked:
+		t.Fatal("Lock returned while the lock was held")
+	case <-time.After(200 * time.Millisecond):
+	}
+	done := first.Done()
+	require.NoError(t, first.Unlock(ctx))
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Done not closed after Unlock")
+	}
+	select {
+	case err := <-locked:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Lock did not return after Unlock")
+	}
+	require.NoError(t, second.Unlock(ctx))
+	assert.ErrorIs(t, second.Unlock(ctx), ErrNotLocked)
+	require.NoError(t, first.Lock(ctx))
+	require.NoError(t, first.Unlock(ctx))
+}
+
+// testElection checks that two elections of the same name never lead together.
+func testElection(t *testing.T, first, second Election) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := first.Leader(ctx)
+	assert.ErrorIs(t, err, ErrNoLeader)
+	leaders := first.Observe(ctx)
+	waitLeader(t, leaders, "")
+
+	require.NoError(t, first.Campaign(ctx, "instance-1"))
+	assert.ErrorIs(t, first.Campaign(ctx, "instance-1"), ErrCampaigning)
+	waitLeader(t, leaders, "instance-1")
+	leader, err := second.Leader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "instance-1", leader)
+
+	elected := make(chan error, 1)
+	go func() { elected <- second.Campaign(ctx, "instance-2") }()
+	select {
+	case <-elected:
+		t.Fatal("two leaders elected")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	done := first.Done()
+	require.NoError(t, first.Resign(ctx))
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Done not closed after Resign")
+	}
+	select {
+	case err := <-elected:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("second candidate not elected")
+	}
+	waitLeader(t, leaders, "instance-2")
+	require.NoError(t, second.Resign(ctx))
+	waitLeader(t, leaders, "")
+}
+
+func TestEtcdMutex(t *testing.T) {
+	provider := NewEtcdProvider(startEtcd(t), "/openim", 5)
+	testMutex(t, provider.NewMutex("cleanup"), provider.NewMutex("cleanup"))
+}
+
+func TestEtcdElection(t *testing.T) {
+	provider := NewEtcdProvider(startEtcd(t), "/openim", 5)
+	testElection(t, provider.NewElection("cron"), provider.NewElection("cron"))
+}
+
+func TestZookeeperMutex(t *testing.T) {
+	server := startZookeeper(t)
+	first := NewZookeeperProvider(newZkClient(t, server))
+	second := NewZookeeperProvider(newZkClient(t, server))
+	testMutex(t, first.NewMutex("cleanup"), second.NewMutex("cleanup"))
+}
+
+func TestZookeeperElection(t *testing.T) {
+	server := startZookeeper(t)
+	first := NewZookeeperProvider(newZkClient(t, server))
+	second := NewZookeeperProvider(newZkClient(t, server))
+	testElection(t, first.NewElection("cron"), second.NewElection("cron"))
+}
+
+func TestZookeeperElectionSessionExpired(t *testing.T) {
+	ctx := context.Background()
+	server := startZookeeper(t)
+	firstClient := newZkClient(t, server)
+	first := NewZookeeperProvider(firstClient).NewElection("cron")
+	second := NewZookeeperProvider(newZkClient(t, server)).NewElection("cron")
+
+	require.NoError(t, first.Campaign(ctx, "instance-1"))
+	elected := make(chan error, 1)
+	go func() { elected <- second.Campaign(ctx, "instance-2") }()
+	select {
+	case <-elected:
+		t.Fatal("two leaders elected")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	done := first.Done()
+	require.True(t, server.ExpireSession(firstClient.GetZkConn().SessionID()))
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Done not closed after the session expired")
+	}
+	select {
+	case err := <-elected:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("second candidate not elected after the leader session expired")
+	}
+	leader, err := first.Leader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "instance-2", leader)
+	require.NoError(t, second.Resign(ctx))
+}
+
+func TestZookeeperMutexSessionExpired(t *testing.T) {
+	ctx := context.Background()
+	server := startZookeeper(t)
+	firstClient := newZkClient(t, server)
+	first := NewZookeeperProvider(firstClient).NewMutex("job")
+	second := NewZookeeperProvider(newZkClient(t, server)).NewMutex("job")
+
+	require.NoError(t, first.Lock(ctx))
+	locked := make(chan error, 1)
+	go func() { locked <- second.Lock(ctx) }()
+	select {
+	case <-locked:
+		t.Fatal("Lock returned while the lock was held")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	done := first.Done()
+	require.True(t, server.ExpireSession(firstClient.GetZkConn().SessionID()))
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Done not closed after the session expired")
+	}
+	select {
+	case err := <-locked:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("second holder not locked after the first session expired")
+	}
+	// The lost lock is not held any more, so it can be locked again.
+	assert.ErrorIs(t, first.TryLock(ctx), ErrLocked)
+	require.NoError(t, second.Unlock(ctx))
+	require.NoError(t, first.TryLock(ctx))
+	require.NoError(t, first.Unlock(ctx))
+}
+
+func TestSortBySequence(t *testing.T) {
+	nodes := []string{
+		"_c_b1d2-n_0000000012",
+		"_c_a9f3-n_0000000003",
+		"_c_ffff-n_0000000007",
+	}
+	sortBySequence(nodes)
+	assert.Equal(t, []string{"_c_a9f3-n_0000000003", "_c_ffff-n_0000000007", "_c_b1d2-n_0000000012"}, nodes)
+}
@@ -0,0 +1,282 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+const defaultEtcdTTL = 10
+
+type etcdProvider struct {
+	client *clientv3.Client
+	prefix string
+	ttl    int
+}
+
+// NewEtcdProvider creates a Provider storing its keys under prefix. ttl is the lease TTL in
+// seconds bounding how long a crashed holder keeps a lock or the leadership, 10 if not positive.
+func NewEtcdProvider(client *clientv3.Client, prefix string, ttl int) Provider {
+	if ttl <= 0 {
+		ttl = defaultEtcdTTL
+	}
+	return &etcdProvider{client: client, prefix: prefix, ttl: ttl}
+}
+
+func (p *etcdProvider) NewElection(name string) Election {
+	return &etcdElection{provider: p, pfx: path.Join(p.prefix, "election", name)}
+}
+
+func (p *etcdProvider) NewMutex(name string) Mutex {
+	return &etcdMutex{provider: p, pfx: path.Join(p.prefix, "lock", name)}
+}
+
+func (p *etcdProvider) newSession() (*concurrency.Session, error) {
+	session, err := concurrency.NewSession(p.client, concurrency.WithTTL(p.ttl))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "create etcd session failed")
+	}
+	return session, nil
+}
+
+type etcdElection struct {
+	provider *etcdProvider
+	pfx      string
+
+	mu          sync.Mutex
+	campaigning bool
+	session     *concurrency.Session
+	election    *concurrency.Election
+}
+
+func (e *etcdElection) Campaign(ctx context.Context, value string) error {
+	e.mu.Lock()
+	if e.campaigning || sessionAlive(e.session) {
+		e.mu.Unlock()
+		return ErrCampaigning.Wrap()
+	}
+	e.campaigning = true
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.campaigning = false
+		e.mu.Unlock()
+	}()
+	session, err := e.provider.newSession()
+	if err != nil {
+		return err
+	}
+	election := concurrency.NewElection(session, e.pfx)
+	if err := election.Campaign(ctx, value); err != nil {
+		_ = session.Close()
+		return errs.WrapMsg(err, "etcd campaign failed", "election", e.pfx)
+	}
+	e.mu.Lock()
+	old := e.session
+	e.session, e.election = session, election
+	e.mu.Unlock()
+	// The previous session, if any, has expired, release its lease.
+	if old != nil {
+		_ = old.Close()
+	}
+	return nil
+}
+
+// sessionAlive reports whether session holds what it was created for, i.e. it is set and not expired.
+func sessionAlive(session *concurrency.Session) bool {
+	if session == nil {
+		return false
+	}
+	select {
+	case <-session.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+func (e *etcdElection) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	session, election := e.session, e.election
+	e.session, e.election = nil, nil
+	e.mu.Unlock()
+	if session == nil {
+		return nil
+	}
+	defer session.Close()
+	if err := election.Resign(ctx); err != nil {
+		return errs.WrapMsg(err, "etcd resign failed", "election", e.pfx)
+	}
+	return nil
+}
+
+func (e *etcdElection) Leader(ctx context.Context) (string, error) {
+	value, _, err := e.leader(ctx)
+	if err != nil {
+		return "", err
+	}
+	if value == nil {
+		return "", ErrNoLeader.Wrap()
+	}
+	return string(value), nil
+}
+
+// leader returns the value of the oldest candidate, which is the leader, nil if there is none,
+// and the revision it was read at.
+func (e *etcdElection) leader(ctx context.Context) ([]byte, int64, error) {
+	resp, err := e.provider.client.Get(ctx, e.pfx+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return nil, 0, errs.WrapMsg(err, "etcd get leader failed", "election", e.pfx)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, resp.Header.Revision, nil
+	}
+	return resp.Kvs[0].Value, resp.Header.Revision, nil
+}
+
+func (e *etcdElection) Observe(ctx context.Context) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		var last string
+		first := true
+		for ctx.Err() == nil {
+			value, revision, err := e.leader(ctx)
+			if err != nil {
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+			if first || string(value) != last {
+				first = false
+				last = string(value)
+				select {
+				case ch <- last:
+				case <-ctx.Done():
+					return
+				}
+			}
+			wctx, cancel := context.WithCancel(ctx)
+			// Any change of the candidates may change the leader, read it again.
+			for resp := range e.provider.client.Watch(wctx, e.pfx+"/", clientv3.WithPrefix(), clientv3.WithRev(revision+1)) {
+				if resp.Err() != nil || len(resp.Events) > 0 {
+					break
+				}
+			}
+			cancel()
+		}
+	}()
+	return ch
+}
+
+func (e *etcdElection) Done() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.session == nil {
+		return closedChan
+	}
+	return e.session.Done()
+}
+
+type etcdMutex struct {
+	provider *etcdProvider
+	pfx      string
+
+	mu        sync.Mutex
+	acquiring bool
+	session   *concurrency.Session
+	mutex     *concurrency.Mutex
+}
+
+func (m *etcdMutex) Lock(ctx context.Context) error {
+	return m.acquire(ctx, func(mutex *concurrency.Mutex) error {
+		return mutex.Lock(ctx)
+	})
+}
+
+func (m *etcdMutex) TryLock(ctx context.Context) error {
+	return m.acquire(ctx, func(mutex *concurrency.Mutex) error {
+		return mutex.TryLock(ctx)
+	})
+}
+
+func (m *etcdMutex) acquire(ctx context.Context, lock func(mutex *concurrency.Mutex) error) error {
+	m.mu.Lock()
+	if m.acquiring || sessionAlive(m.session) {
+		m.mu.Unlock()
+		return ErrAlreadyLocked.Wrap()
+	}
+	m.acquiring = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.acquiring = false
+		m.mu.Unlock()
+	}()
+	session, err := m.provider.newSession()
+	if err != nil {
+		return err
+	}
+	mutex := concurrency.NewMutex(session, m.pfx)
+	if err := lock(mutex); err != nil {
+		_ = session.Close()
+		if errors.Is(err, concurrency.ErrLocked) {
+			return ErrLocked.Wrap()
+		}
+		return errs.WrapMsg(err, "etcd lock failed", "lock", m.pfx)
+	}
+	m.mu.Lock()
+	old := m.session
+	m.session, m.mutex = session, mutex
+	m.mu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+	return nil
+}
+
+func (m *etcdMutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	session, mutex := m.session, m.mutex
+	m.session, m.mutex = nil, nil
+	m.mu.Unlock()
+	if session == nil {
+		return ErrNotLocked.Wrap()
+	}
+	defer session.Close()
+	if err := mutex.Unlock(ctx); err != nil {
+		return errs.WrapMsg(err, "etcd unlock failed", "lock", m.pfx)
+	}
+	return nil
+}
+
+func (m *etcdMutex) Done() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session == nil {
+		return closedChan
+	}
+	return m.session.Done()
+}
@@ -0,0 +1,387 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/openimsdk/tools/discovery/zookeeper"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+// zkProvider implements the standard zookeeper recipes: every candidate creates an
+// ephemeral sequential node and the one with the lowest sequence leads or holds the lock.
+type zkProvider struct {
+	conn   *zk.Conn
+	logger log.Logger
+	root   string
+}
+
+// NewZookeeperProvider creates a Provider sharing the connection and logger of client.
+// Nodes are created under the client's root path.
+func NewZookeeperProvider(client *zookeeper.ZkClient) Provider {
+	return &zkProvider{conn: client.GetZkConn(), logger: client.GetLogger(), root: client.GetRootPath()}
+}
+
+func (p *zkProvider) NewElection(name string) Election {
+	return &zkElection{provider: p, dir: path.Join(p.root, "election", name)}
+}
+
+func (p *zkProvider) NewMutex(name string) Mutex {
+	return &zkMutex{provider: p, dir: path.Join(p.root, "lock", name)}
+}
+
+// ensureDir creates dir and its parents as persistent nodes.
+func (p *zkProvider) ensureDir(dir string) error {
+	node := ""
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		node += "/" + part
+		_, err := p.conn.Create(node, nil, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && !errors.Is(err, zk.ErrNodeExists) {
+			return errs.WrapMsg(err, "create node failed", "node", node)
+		}
+	}
+	return nil
+}
+
+// enqueue adds a candidate node holding value to dir.
+func (p *zkProvider) enqueue(dir string, value string) (string, error) {
+	if err := p.ensureDir(dir); err != nil {
+		return "", err
+	}
+	node, err := p.conn.CreateProtectedEphemeralSequential(dir+"/n_", []byte(value), zk.WorldACL(zk.PermAll))
+	if err != nil {
+		return "", errs.WrapMsg(err, "create candidate node failed", "dir", dir)
+	}
+	return node, nil
+}
+
+// candidates returns the candidate nodes of dir ordered by sequence.
+func (p *zkProvider) candidates(dir string) ([]string, error) {
+	children, _, err := p.conn.Children(dir)
+	if err != nil && !errors.Is(err, zk.ErrNoNode) {
+		return nil, errs.WrapMsg(err, "get children failed", "dir", dir)
+	}
+	sortBySequence(children)
+	return children, nil
+}
+
+// sortBySequence orders nodes by the sequence number zookeeper appends to their names,
+// ignoring the protection prefix.
+func sortBySequence(nodes []string) {
+	sequence := func(node string) string {
+		if i := strings.LastIndex(node, "n_"); i >= 0 {
+			return node[i+2:]
+		}
+		return node
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return sequence(nodes[i]) < sequence(nodes[j])
+	})
+}
+
+// waitFirst blocks until node is the first candidate of dir or ctx is done. Each candidate
+// only watches its predecessor, so a release wakes up a single waiter.
+func (p *zkProvider) waitFirst(ctx context.Context, dir, node string, wait bool) error {
+	name := path.Base(node)
+	for {
+		candidates, err := p.candidates(dir)
+		if err != nil {
+			return err
+		}
+		index := -1
+		for i, candidate := range candidates {
+			if candidate == name {
+				index = i
+				break
+			}
+		}
+		switch {
+		case index < 0:
+			return errs.New("candidate node lost", "node", node).Wrap()
+		case index == 0:
+			return nil
+		case !wait:
+			return ErrLocked.Wrap()
+		}
+		exists, _, ch, err := p.conn.ExistsW(dir + "/" + candidates[index-1])
+		if err != nil {
+			return errs.WrapMsg(err, "watch predecessor failed", "dir", dir)
+		}
+		if !exists {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// acquire enqueues a candidate and waits until it is first, removing it on failure.
+func (p *zkProvider) acquire(ctx context.Context, dir, value string, wait bool) (string, error) {
+	node, err := p.enqueue(dir, value)
+	if err != nil {
+		return "", err
+	}
+	if err := p.waitFirst(ctx, dir, node, wait); err != nil {
+		p.remove(node)
+		return "", err
+	}
+	return node, nil
+}
+
+// watchNode closes done once node is gone, either removed by its owner or with an
+// expired session.
+func (p *zkProvider) watchNode(node string, done chan struct{}) {
+	defer close(done)
+	for {
+		exists, _, ch, err := p.conn.ExistsW(node)
+		if err != nil || !exists {
+			return
+		}
+		if ev := <-ch; ev.Type == zk.EventNodeDeleted || ev.Type == zk.EventNotWatching {
+			return
+		}
+	}
+}
+
+// alive reports whether node is set and done, closed by watchNode, is still open.
+func alive(node string, done chan struct{}) bool {
+	if node == "" {
+		return false
+	}
+	select {
+	case <-done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *zkProvider) remove(node string) {
+	if err := p.conn.Delete(node, -1); err != nil && !errors.Is(err, zk.ErrNoNode) {
+		p.logger.Warn(context.Background(), "delete candidate node failed", err, "node", node)
+	}
+}
+
+type zkElection struct {
+	provider *zkProvider
+	dir      string
+
+	mu          sync.Mutex
+	campaigning bool
+	node        string
+	done        chan struct{}
+}
+
+func (e *zkElection) Campaign(ctx context.Context, value string) error {
+	e.mu.Lock()
+	if e.campaigning || e.leading() {
+		e.mu.Unlock()
+		return ErrCampaigning.Wrap()
+	}
+	e.campaigning = true
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.campaigning = false
+		e.mu.Unlock()
+	}()
+	node, err := e.provider.acquire(ctx, e.dir, value, true)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	e.mu.Lock()
+	old := e.node
+	e.node, e.done = node, done
+	e.mu.Unlock()
+	if old != "" {
+		e.provider.remove(old)
+	}
+	go e.provider.watchNode(node, done)
+	return nil
+}
+
+// leading reports whether the leader node created by Campaign still exists. The caller holds e.mu.
+func (e *zkElection) leading() bool {
+	return alive(e.node, e.done)
+}
+
+func (e *zkElection) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	node := e.node
+	e.node, e.done = "", nil
+	e.mu.Unlock()
+	if node != "" {
+		e.provider.remove(node)
+	}
+	return nil
+}
+
+func (e *zkElection) Leader(ctx context.Context) (string, error) {
+	for {
+		candidates, err := e.provider.candidates(e.dir)
+		if err != nil {
+			return "", err
+		}
+		if len(candidates) == 0 {
+			return "", ErrNoLeader.Wrap()
+		}
+		data, _, err := e.provider.conn.Get(e.dir + "/" + candidates[0])
+		if errors.Is(err, zk.ErrNoNode) {
+			continue
+		}
+		if err != nil {
+			return "", errs.WrapMsg(err, "get leader failed", "dir", e.dir)
+		}
+		return string(data), nil
+	}
+}
+
+func (e *zkElection) Observe(ctx context.Context) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		var last string
+		first := true
+		for ctx.Err() == nil {
+			watch, err := e.observeOnce(ctx)
+			if err != nil {
+				e.provider.logger.Warn(ctx, "observe election failed", err, "dir", e.dir)
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+			value, err := e.Leader(ctx)
+			if (err == nil || errors.Is(err, ErrNoLeader)) && (first || value != last) {
+				first = false
+				last = value
+				select {
+				case ch <- value:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+			case <-watch:
+			}
+		}
+	}()
+	return ch
+}
+
+// observeOnce arms a watch on the candidates of the election.
+func (e *zkElection) observeOnce(ctx context.Context) (<-chan zk.Event, error) {
+	if err := e.provider.ensureDir(e.dir); err != nil {
+		return nil, err
+	}
+	_, _, watch, err := e.provider.conn.ChildrenW(e.dir)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "watch candidates failed", "dir", e.dir)
+	}
+	return watch, nil
+}
+
+func (e *zkElection) Done() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done == nil {
+		return closedChan
+	}
+	return e.done
+}
+
+type zkMutex struct {
+	provider *zkProvider
+	dir      string
+
+	mu        sync.Mutex
+	acquiring bool
+	node      string
+	done      chan struct{}
+}
+
+func (m *zkMutex) Lock(ctx context.Context) error {
+	return m.lock(ctx, true)
+}
+
+func (m *zkMutex) TryLock(ctx context.Context) error {
+	return m.lock(ctx, false)
+}
+
+func (m *zkMutex) lock(ctx context.Context, wait bool) error {
+	m.mu.Lock()
+	if m.acquiring || alive(m.node, m.done) {
+		m.mu.Unlock()
+		return ErrAlreadyLocked.Wrap()
+	}
+	m.acquiring = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.acquiring = false
+		m.mu.Unlock()
+	}()
+	node, err := m.provider.acquire(ctx, m.dir, "", wait)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	m.mu.Lock()
+	old := m.node
+	m.node, m.done = node, done
+	m.mu.Unlock()
+	// The previous node, if any, was lost with its session.
+	if old != "" {
+		m.provider.remove(old)
+	}
+	go m.provider.watchNode(node, done)
+	return nil
+}
+
+func (m *zkMutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	node := m.node
+	m.node, m.done = "", nil
+	m.mu.Unlock()
+	if node == "" {
+		return ErrNotLocked.Wrap()
+	}
+	m.provider.remove(node)
+	return nil
+}
+
+func (m *zkMutex) Done() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done == nil {
+		return closedChan
+	}
+	return m.done
+}
@@ -0,0 +1,113 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/config"
+	"github.com/openimsdk/tools/errs"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ config.WatchableSource = (*ConfigSource)(nil)
+
+// ConfigSource reads and watches a configuration document stored in an etcd key
+type ConfigSource struct {
+	client *clientv3.Client
+	key    string
+}
+
+// NewConfigSource creates a config.WatchableSource for key. The key is used as is and should
+// not live under the root directory of a registry, which is reserved for service endpoints
+func NewConfigSource(client *clientv3.Client, key string) *ConfigSource {
+	return &ConfigSource{client: client, key: key}
+}
+
+// ConfigSource returns a config.WatchableSource for key using the registry's client
+func (r *SvcDiscoveryRegistryImpl) ConfigSource(key string) *ConfigSource {
+	return NewConfigSource(r.client, key)
+}
+
+// GetClient returns the etcd client of the registry
+func (r *SvcDiscoveryRegistryImpl) GetClient() *clientv3.Client {
+	return r.client
+}
+
+// RegisterConf2Registry stores a configuration document under key
+func (r *SvcDiscoveryRegistryImpl) RegisterConf2Registry(key string, conf []byte) error {
+	if _, err := r.client.Put(context.TODO(), key, string(conf)); err != nil {
+		return errs.WrapMsg(err, "etcd put failed", "key", key)
+	}
+	return nil
+}
+
+// GetConfFromRegistry reads the configuration document stored under key
+func (r *SvcDiscoveryRegistryImpl) GetConfFromRegistry(key string) ([]byte, error) {
+	return r.ConfigSource(key).Read()
+}
+
+func (c *ConfigSource) Read() ([]byte, error) {
+	data, _, err := c.get(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errs.New("config key not found", "key", c.key).Wrap()
+	}
+	return data, nil
+}
+
+// get returns the value of the key, nil if it does not exist, and the revision it was read at
+func (c *ConfigSource) get(ctx context.Context) ([]byte, int64, error) {
+	resp, err := c.client.Get(ctx, c.key)
+	if err != nil {
+		return nil, 0, errs.WrapMsg(err, "etcd get failed", "key", c.key)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, resp.Header.Revision, nil
+	}
+	return resp.Kvs[0].Value, resp.Header.Revision, nil
+}
+
+// Watch calls onChange with the current document and after every put of the key. Deleting the
+// key is not reported, the last document stays in effect
+func (c *ConfigSource) Watch(ctx context.Context, onChange func(data []byte)) error {
+	for {
+		data, revision, err := c.get(ctx)
+		if err == nil {
+			if data != nil {
+				onChange(data)
+			}
+			for resp := range c.client.Watch(ctx, c.key, clientv3.WithRev(revision+1)) {
+				if resp.Err() != nil {
+					break
+				}
+				for _, ev := range resp.Events {
+					if ev.Type == clientv3.EventTypePut {
+						onChange(ev.Kv.Value)
+					}
+				}
+			}
+		}
+		// The watch broke, e.g. after compaction; read again and resume.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
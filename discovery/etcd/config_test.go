@@ -0,0 +1,48 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reloadConfig struct {
+	LogLevel int `yaml:"logLevel"`
+}
+
+func TestConfigSource(t *testing.T) {
+	addr := startEtcd(t)
+	r, err := NewSvcDiscoveryRegistry("openim", []string{addr})
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.GetConfFromRegistry("/openim-config/log.yml")
+	assert.Error(t, err)
+	require.NoError(t, r.RegisterConf2Registry("/openim-config/log.yml", []byte("logLevel: 3\n")))
+
+	watcher := config.NewWatcher[reloadConfig](r.ConfigSource("/openim-config/log.yml"), nil)
+	conf, err := watcher.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 3, conf.LogLevel)
+
+	reloaded := make(chan int, 4)
+	watcher.OnChange(func(old, new *reloadConfig) {
+		reloaded <- new.LogLevel
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watcher.Run(ctx)
+
+	require.NoError(t, r.RegisterConf2Registry("/openim-config/log.yml", []byte("logLevel: 6\n")))
+	select {
+	case level := <-reloaded:
+		assert.Equal(t, 6, level)
+	case <-time.After(10 * time.Second):
+		t.Fatal("config change not delivered")
+	}
+	assert.Equal(t, 6, watcher.Get().LogLevel)
+}
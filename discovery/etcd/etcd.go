@@ -2,7 +2,10 @@ package etcd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/openimsdk/tools/discovery"
+	"github.com/openimsdk/tools/discovery/balancer"
 	"github.com/pkg/errors"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/naming/endpoints"
@@ -12,6 +15,7 @@ import (
 	"google.golang.org/grpc"
 	gresolver "google.golang.org/grpc/resolver"
 	"io"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -20,8 +24,12 @@ import (
 // ZkOption defines a function type for modifying clientv3.Config
 type ZkOption func(*clientv3.Config)
 
+// RegistryOption defines a function type for configuring the registry itself
+type RegistryOption func(*SvcDiscoveryRegistryImpl)
+
 // SvcDiscoveryRegistryImpl implementation
 type SvcDiscoveryRegistryImpl struct {
+	config            clientv3.Config
 	client            *clientv3.Client
 	resolver          gresolver.Builder
 	dialOptions       []grpc.DialOption
@@ -32,8 +40,29 @@ type SvcDiscoveryRegistryImpl struct {
 
 	rootDirectory string
 
-	mu      sync.RWMutex
-	connMap map[string][]*grpc.ClientConn
+	gatewayName string
+	gateway     *discovery.GatewayHashRouter
+
+	metadata  *discovery.Metadata
+	filter    discovery.MetadataFilter
+	lifecycle discovery.Lifecycle
+
+	leaseTTL      int64
+	stateCallback StateCallback
+	regMu         sync.Mutex
+	keepAliveStop context.CancelFunc
+	keepAliveDone chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// connMap holds one connection per endpoint, keyed by service prefix and address.
+	// It is loaded on the first GetConns and then kept up to date by watch events.
+	mu       sync.RWMutex
+	connMap  map[string]map[string]*grpc.ClientConn
+	loaded   bool
+	revision int64
 }
 
 func createNoOpLogger() *zap.Logger {
@@ -53,21 +82,35 @@ func createNoOpLogger() *zap.Logger {
 
 // NewSvcDiscoveryRegistry creates a new service discovery registry implementation
 func NewSvcDiscoveryRegistry(rootDirectory string, endpoints []string, options ...ZkOption) (*SvcDiscoveryRegistryImpl, error) {
-	cfg := clientv3.Config{
-		Endpoints:   endpoints,
-		DialTimeout: 5 * time.Second,
-		// Increase keep-alive queue capacity and message size
-		PermitWithoutStream: true,
-		Logger:              createNoOpLogger(),
-		MaxCallSendMsgSize:  10 * 1024 * 1024, // 10 MB
+	return NewSvcDiscoveryRegistryWithOptions(rootDirectory, endpoints, options)
+}
+
+// NewSvcDiscoveryRegistryWithOptions creates a registry like NewSvcDiscoveryRegistry, additionally
+// applying registry options such as WithGatewayServiceName or WithBalancer
+func NewSvcDiscoveryRegistryWithOptions(rootDirectory string, endpoints []string, configOptions []ZkOption, options ...RegistryOption) (*SvcDiscoveryRegistryImpl, error) {
+	s := &SvcDiscoveryRegistryImpl{
+		config: clientv3.Config{
+			Endpoints:   endpoints,
+			DialTimeout: 5 * time.Second,
+			// Increase keep-alive queue capacity and message size
+			PermitWithoutStream: true,
+			Logger:              createNoOpLogger(),
+			MaxCallSendMsgSize:  10 * 1024 * 1024, // 10 MB
+		},
+		rootDirectory: rootDirectory,
+		leaseTTL:      defaultLeaseTTL,
+		connMap:       make(map[string]map[string]*grpc.ClientConn),
 	}
 
-	// Apply provided options to the config
+	// Apply provided options to the config and the registry
+	for _, opt := range configOptions {
+		opt(&s.config)
+	}
 	for _, opt := range options {
-		opt(&cfg)
+		opt(s)
 	}
 
-	client, err := clientv3.New(cfg)
+	client, err := clientv3.New(s.config)
 	if err != nil {
 		return nil, err
 	}
@@ -75,37 +118,152 @@ func NewSvcDiscoveryRegistry(rootDirectory string, endpoints []string, options .
 	if err != nil {
 		return nil, err
 	}
+	s.client = client
+	s.resolver = &metadataBuilder{Builder: r, filter: s.filter}
+	s.gateway = discovery.NewGatewayHashRouter(s.gatewayName, s.getServiceAddrs)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
-	s := &SvcDiscoveryRegistryImpl{
-		client:        client,
-		resolver:      r,
-		rootDirectory: rootDirectory,
-		connMap:       make(map[string][]*grpc.ClientConn),
-	}
-
+	s.wg.Add(1)
 	go s.watchServiceChanges()
 	return s, nil
 }
 
-// initializeConnMap fetches all existing endpoints and populates the local map
+// initializeConnMap fetches all existing endpoints and reconciles the local map with them,
+// reusing the connections that are still registered. The caller must hold mu.
 func (r *SvcDiscoveryRegistryImpl) initializeConnMap() error {
 	fullPrefix := fmt.Sprintf("%s/", r.rootDirectory)
 	resp, err := r.client.Get(context.Background(), fullPrefix, clientv3.WithPrefix())
 	if err != nil {
 		return err
 	}
-	r.connMap = make(map[string][]*grpc.ClientConn)
+	current := make(map[string]map[string]struct{})
 	for _, kv := range resp.Kvs {
+		if !r.acceptEndpoint(kv.Value) {
+			continue
+		}
 		prefix, addr := r.splitEndpoint(string(kv.Key))
-		conn, err := grpc.DialContext(context.Background(), addr, append(r.dialOptions, grpc.WithResolvers(r.resolver))...)
-		if err != nil {
+		if err := r.addConn(prefix, addr); err != nil {
 			continue
 		}
-		r.connMap[prefix] = append(r.connMap[prefix], conn)
+		if current[prefix] == nil {
+			current[prefix] = make(map[string]struct{})
+		}
+		current[prefix][addr] = struct{}{}
 	}
+	for prefix, conns := range r.connMap {
+		for addr := range conns {
+			if _, ok := current[prefix][addr]; !ok {
+				r.removeConn(prefix, addr)
+			}
+		}
+	}
+	r.revision = resp.Header.Revision
+	r.loaded = true
+	return nil
+}
+
+// addConn dials addr unless a connection to it already exists. The caller must hold mu.
+func (r *SvcDiscoveryRegistryImpl) addConn(prefix, addr string) error {
+	if _, ok := r.connMap[prefix][addr]; ok {
+		return nil
+	}
+	opts := append(append([]grpc.DialOption{}, r.dialOptions...), grpc.WithResolvers(r.resolver))
+	conn, err := grpc.DialContext(context.Background(), addr, opts...)
+	if err != nil {
+		return err
+	}
+	if r.connMap[prefix] == nil {
+		r.connMap[prefix] = make(map[string]*grpc.ClientConn)
+	}
+	r.connMap[prefix][addr] = conn
 	return nil
 }
 
+// removeConn closes and forgets the connection to addr. The caller must hold mu.
+func (r *SvcDiscoveryRegistryImpl) removeConn(prefix, addr string) {
+	conn, ok := r.connMap[prefix][addr]
+	if !ok {
+		return
+	}
+	_ = conn.Close()
+	delete(r.connMap[prefix], addr)
+	if len(r.connMap[prefix]) == 0 {
+		delete(r.connMap, prefix)
+	}
+}
+
+// resetConnMap closes every cached connection, the next GetConns loads the map again. The caller must hold mu.
+func (r *SvcDiscoveryRegistryImpl) resetConnMap() {
+	for _, conns := range r.connMap {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+	r.connMap = make(map[string]map[string]*grpc.ClientConn)
+	r.loaded = false
+	r.revision = 0
+}
+
+// applyEvents updates the local map with the endpoints put or deleted by watch events
+func (r *SvcDiscoveryRegistryImpl) applyEvents(events []*clientv3.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.loaded {
+		return
+	}
+	for _, ev := range events {
+		// Events already covered by the last full load are skipped, so a late event cannot
+		// bring back an endpoint the load saw deleted.
+		if ev.Kv.ModRevision <= r.revision {
+			continue
+		}
+		prefix, addr := r.splitEndpoint(string(ev.Kv.Key))
+		if ev.Type == clientv3.EventTypePut && r.acceptEndpoint(ev.Kv.Value) {
+			_ = r.addConn(prefix, addr)
+		} else {
+			r.removeConn(prefix, addr)
+		}
+	}
+}
+
+// connList returns the connections of a service prefix ordered by address. The caller must hold mu.
+func (r *SvcDiscoveryRegistryImpl) connList(prefix string) []*grpc.ClientConn {
+	addrs := make([]string, 0, len(r.connMap[prefix]))
+	for addr := range r.connMap[prefix] {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	conns := make([]*grpc.ClientConn, len(addrs))
+	for i, addr := range addrs {
+		conns[i] = r.connMap[prefix][addr]
+	}
+	return conns
+}
+
+// GetClientLocalConns returns a snapshot of the cached connections keyed by service name, for debugging
+func (r *SvcDiscoveryRegistryImpl) GetClientLocalConns() map[string][]*grpc.ClientConn {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make(map[string][]*grpc.ClientConn, len(r.connMap))
+	for prefix := range r.connMap {
+		res[strings.TrimPrefix(prefix, r.rootDirectory+"/")] = r.connList(prefix)
+	}
+	return res
+}
+
+// acceptEndpoint reports whether the stored endpoint is not draining and passes the metadata filter
+func (r *SvcDiscoveryRegistryImpl) acceptEndpoint(value []byte) bool {
+	var ep endpoints.Endpoint
+	if err := json.Unmarshal(value, &ep); err != nil {
+		return r.filter == nil || r.filter(nil)
+	}
+	md := endpointMetadata(ep.Metadata)
+	if md != nil && md.Draining {
+		return false
+	}
+	return r.filter == nil || r.filter(md)
+}
+
 // WithDialTimeout sets a custom dial timeout for the etcd client
 func WithDialTimeout(timeout time.Duration) ZkOption {
 	return func(cfg *clientv3.Config) {
@@ -128,22 +286,105 @@ func WithUsernameAndPassword(username, password string) ZkOption {
 	}
 }
 
-// GetUserIdHashGatewayHost returns the gateway host for a given user ID hash
+// WithGatewayServiceName sets the service name used by GetUserIdHashGatewayHost
+func WithGatewayServiceName(serviceName string) RegistryOption {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.gatewayName = serviceName
+	}
+}
+
+// WithMetadataFilter makes resolvers created by GetConn only return instances accepted by filter
+func WithMetadataFilter(filter discovery.MetadataFilter) RegistryOption {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.filter = filter
+	}
+}
+
+// WithHealthCheck makes Register run the grpc.health.v1 check against the registered target,
+// removing the registration again if it does not report SERVING within timeout
+func WithHealthCheck(timeout time.Duration, opts ...grpc.DialOption) RegistryOption {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.lifecycle.HealthCheckTimeout = timeout
+		r.lifecycle.HealthCheckDialOptions = opts
+	}
+}
+
+// WithDrain makes UnRegister mark the instance draining and wait for the RPCs counted by tracker,
+// at most timeout, before removing it
+func WithDrain(tracker *discovery.InflightTracker, timeout time.Duration) RegistryOption {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.lifecycle.Tracker = tracker
+		r.lifecycle.DrainTimeout = timeout
+	}
+}
+
+// WithLeaseTTL sets the TTL of the lease the registration is attached to, 30 seconds by default
+func WithLeaseTTL(ttl time.Duration) RegistryOption {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.leaseTTL = int64(ttl / time.Second)
+		if r.leaseTTL < 1 {
+			r.leaseTTL = 1
+		}
+	}
+}
+
+// WithStateCallback sets a callback receiving registration state changes, such as a lost lease and its recovery
+func WithStateCallback(fn StateCallback) RegistryOption {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.stateCallback = fn
+	}
+}
+
+// WithBalancer sets the load balancing policy used by GetConn, e.g. one registered by the balancer package
+func WithBalancer(name string) RegistryOption {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.dialOptions = append(r.dialOptions, balancer.WithPolicy(name))
+	}
+}
+
+// GetUserIdHashGatewayHost returns the gateway address owning the user ID on the consistent-hash ring
 func (r *SvcDiscoveryRegistryImpl) GetUserIdHashGatewayHost(ctx context.Context, userId string) (string, error) {
-	return "", nil
+	return r.gateway.GetHost(ctx, userId)
+}
+
+// getServiceAddrs lists the addresses currently registered in etcd for a service
+func (r *SvcDiscoveryRegistryImpl) getServiceAddrs(ctx context.Context, serviceName string) ([]string, error) {
+	em, err := endpoints.NewManager(r.client, r.rootDirectory+"/"+serviceName)
+	if err != nil {
+		return nil, err
+	}
+	eps, err := em.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(eps))
+	for _, ep := range eps {
+		if md := endpointMetadata(ep.Metadata); md != nil && md.Draining {
+			continue
+		}
+		addrs = append(addrs, ep.Addr)
+	}
+	return addrs, nil
 }
 
 // GetConns returns gRPC client connections for a given service name
 func (r *SvcDiscoveryRegistryImpl) GetConns(ctx context.Context, serviceName string, opts ...grpc.DialOption) ([]*grpc.ClientConn, error) {
 	fullServiceKey := fmt.Sprintf("%s/%s", r.rootDirectory, serviceName)
 	r.mu.RLock()
-	defer r.mu.RUnlock()
-	if len(r.connMap) == 0 {
+	if r.loaded {
+		defer r.mu.RUnlock()
+		return r.connList(fullServiceKey), nil
+	}
+	r.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.loaded {
 		if err := r.initializeConnMap(); err != nil {
 			return nil, err
 		}
 	}
-	return r.connMap[fullServiceKey], nil
+	return r.connList(fullServiceKey), nil
 }
 
 // GetConn returns a single gRPC client connection for a given service name
@@ -161,7 +402,7 @@ func (r *SvcDiscoveryRegistryImpl) GetSelfConnTarget() string {
 func (r *SvcDiscoveryRegistryImpl) AddOption(opts ...grpc.DialOption) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.connMap = make(map[string][]*grpc.ClientConn)
+	r.resetConnMap()
 	r.dialOptions = append(r.dialOptions, opts...)
 }
 
@@ -172,73 +413,95 @@ func (r *SvcDiscoveryRegistryImpl) CloseConn(conn *grpc.ClientConn) {
 
 // Register registers a new service endpoint with etcd
 func (r *SvcDiscoveryRegistryImpl) Register(serviceName, host string, port int, opts ...grpc.DialOption) error {
-	r.serviceKey = fmt.Sprintf("%s/%s/%s:%d", r.rootDirectory, serviceName, host, port)
+	return r.RegisterWithMetadata(serviceName, host, port, nil, opts...)
+}
+
+// RegisterWithMetadata registers a new service endpoint with etcd, storing md as the endpoint metadata
+func (r *SvcDiscoveryRegistryImpl) RegisterWithMetadata(serviceName, host string, port int, md *discovery.Metadata, opts ...grpc.DialOption) error {
+	md = discovery.RegisterMetadata(md)
 	em, err := endpoints.NewManager(r.client, r.rootDirectory+"/"+serviceName)
 	if err != nil {
 		return err
 	}
+	r.stopKeepAlive()
+
+	r.regMu.Lock()
+	r.serviceKey = fmt.Sprintf("%s/%s/%s:%d", r.rootDirectory, serviceName, host, port)
 	r.endpointMgr = em
+	r.rpcRegisterTarget = fmt.Sprintf("%s:%d", host, port)
+	r.metadata = md
+	r.regMu.Unlock()
 
-	leaseResp, err := r.client.Grant(context.Background(), 30) //
+	leaseID, err := r.putEndpoint(context.TODO())
 	if err != nil {
 		return err
 	}
-	r.leaseID = leaseResp.ID
-
-	r.rpcRegisterTarget = fmt.Sprintf("%s:%d", host, port)
-	endpoint := endpoints.Endpoint{Addr: r.rpcRegisterTarget}
-
-	err = em.AddEndpoint(context.TODO(), r.serviceKey, endpoint, clientv3.WithLease(leaseResp.ID))
-	if err != nil {
+	r.startKeepAlive(leaseID)
+	if err := r.lifecycle.CheckHealth(r.rpcRegisterTarget); err != nil {
+		r.stopKeepAlive()
+		_ = em.DeleteEndpoint(context.TODO(), r.serviceKey)
+		_, _ = r.client.Revoke(context.TODO(), leaseID)
 		return err
 	}
-
-	go r.keepAliveLease(r.leaseID)
+	r.notifyState(StateRegistered, nil)
 	return nil
 }
 
-// keepAliveLease maintains the lease alive by sending keep-alive requests
-func (r *SvcDiscoveryRegistryImpl) keepAliveLease(leaseID clientv3.LeaseID) {
-	ch, err := r.client.KeepAlive(context.Background(), leaseID)
-	if err != nil {
-		return
-	}
-	for ka := range ch {
-		if ka != nil {
-		} else {
-			return
-		}
+// startKeepAlive keeps leaseID alive in the background until stopKeepAlive or Close
+func (r *SvcDiscoveryRegistryImpl) startKeepAlive(leaseID clientv3.LeaseID) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	done := make(chan struct{})
+	r.regMu.Lock()
+	r.keepAliveStop = cancel
+	r.keepAliveDone = done
+	r.regMu.Unlock()
+	r.wg.Add(1)
+	go func() {
+		defer close(done)
+		r.keepAliveLease(ctx, leaseID)
+	}()
+}
+
+// stopKeepAlive stops the keep-alive goroutine and waits for it, so it can no longer re-register the endpoint
+func (r *SvcDiscoveryRegistryImpl) stopKeepAlive() {
+	r.regMu.Lock()
+	stop, done := r.keepAliveStop, r.keepAliveDone
+	r.keepAliveStop, r.keepAliveDone = nil, nil
+	r.regMu.Unlock()
+	if stop != nil {
+		stop()
+		<-done
 	}
 }
 
-// watchServiceChanges watches for changes in the service directory
+// watchServiceChanges applies endpoint changes under the root directory to the local map
+// until Close. A broken watch, e.g. after compaction, is restarted from a fresh load.
 func (r *SvcDiscoveryRegistryImpl) watchServiceChanges() {
-	watchChan := r.client.Watch(context.Background(), r.rootDirectory, clientv3.WithPrefix())
-	for range watchChan {
+	defer r.wg.Done()
+	for {
 		r.mu.RLock()
-		r.initializeConnMap()
+		revision := r.revision
 		r.mu.RUnlock()
-	}
-}
-
-// refreshConnMap fetches the latest endpoints and updates the local map
-func (r *SvcDiscoveryRegistryImpl) refreshConnMap(prefix string) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	fullPrefix := fmt.Sprintf("%s/", prefix)
-	resp, err := r.client.Get(context.Background(), fullPrefix, clientv3.WithPrefix())
-	if err != nil {
-		return
-	}
-	r.connMap[prefix] = []*grpc.ClientConn{} // Update the connMap with new connections
-	for _, kv := range resp.Kvs {
-		_, addr := r.splitEndpoint(string(kv.Key))
-		conn, err := grpc.DialContext(context.Background(), addr, append(r.dialOptions, grpc.WithResolvers(r.resolver))...)
-		if err != nil {
-			continue
+		opts := []clientv3.OpOption{clientv3.WithPrefix()}
+		if revision > 0 {
+			opts = append(opts, clientv3.WithRev(revision+1))
 		}
-		r.connMap[prefix] = append(r.connMap[prefix], conn)
+		for resp := range r.client.Watch(r.ctx, r.rootDirectory+"/", opts...) {
+			if resp.Err() != nil {
+				break
+			}
+			r.applyEvents(resp.Events)
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+		r.mu.Lock()
+		if r.loaded {
+			_ = r.initializeConnMap()
+		}
+		r.mu.Unlock()
 	}
 }
 
@@ -255,24 +518,52 @@ func (r *SvcDiscoveryRegistryImpl) splitEndpoint(input string) (string, string)
 
 // UnRegister removes the service endpoint from etcd
 func (r *SvcDiscoveryRegistryImpl) UnRegister() error {
-	if r.endpointMgr == nil {
+	r.regMu.Lock()
+	em, key := r.endpointMgr, r.serviceKey
+	r.regMu.Unlock()
+	if em == nil {
 		return fmt.Errorf("endpoint manager is not initialized")
 	}
-	err := r.endpointMgr.DeleteEndpoint(context.TODO(), r.serviceKey)
+	if r.lifecycle.DrainEnabled() {
+		r.regMu.Lock()
+		r.metadata = discovery.DrainingMetadata(r.metadata)
+		endpoint := endpoints.Endpoint{Addr: r.rpcRegisterTarget, Metadata: r.metadata}
+		leaseID := r.leaseID
+		r.regMu.Unlock()
+		if err := em.AddEndpoint(context.TODO(), key, endpoint, clientv3.WithLease(leaseID)); err != nil {
+			return err
+		}
+		r.lifecycle.Drain()
+	}
+	r.stopKeepAlive()
+	err := em.DeleteEndpoint(context.TODO(), key)
 	if err != nil {
 		return err
 	}
+	r.regMu.Lock()
+	leaseID := r.leaseID
+	r.leaseID = clientv3.NoLease
+	r.regMu.Unlock()
+	if leaseID != clientv3.NoLease {
+		_, _ = r.client.Revoke(context.TODO(), leaseID)
+	}
+	r.notifyState(StateUnregistered, nil)
 	return nil
 }
 
-// Close closes the etcd client connection
+// Close stops the background goroutines and closes the etcd client connection
 func (r *SvcDiscoveryRegistryImpl) Close() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.wg.Wait()
 	if r.client != nil {
 		_ = r.client.Close()
 	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.resetConnMap()
 }
 
 // Check verifies if etcd is running by checking the existence of the root node and optionally creates it with a lease
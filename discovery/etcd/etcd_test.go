@@ -0,0 +1,169 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
+	"go.etcd.io/etcd/server/v3/embed"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func freeURL(t *testing.T) url.URL {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	u, err := url.Parse("http://" + lis.Addr().String())
+	require.NoError(t, err)
+	return *u
+}
+
+// startEtcd runs an embedded single-node etcd and returns its client endpoint.
+func startEtcd(t *testing.T) string {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, peerURL.String())
+	e, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("embedded etcd did not start")
+	}
+	return clientURL.Host
+}
+
+func listEndpoints(t *testing.T, client *clientv3.Client, prefix string) map[string]endpoints.Endpoint {
+	em, err := endpoints.NewManager(client, prefix)
+	require.NoError(t, err)
+	eps, err := em.List(context.Background())
+	require.NoError(t, err)
+	return eps
+}
+
+func TestLeaseRecovery(t *testing.T) {
+	addr := startEtcd(t)
+	states := make(chan RegistrationState, 16)
+	r, err := NewSvcDiscoveryRegistryWithOptions("openim", []string{addr}, nil,
+		WithLeaseTTL(2*time.Second),
+		WithStateCallback(func(state RegistrationState, err error) { states <- state }),
+	)
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.NoError(t, r.Register("user", "127.0.0.1", 10110))
+	assert.Equal(t, StateRegistered, <-states)
+	assert.Len(t, listEndpoints(t, r.client, "openim/user"), 1)
+
+	// Revoking the lease deletes the endpoint, as an expired lease would.
+	r.regMu.Lock()
+	leaseID := r.leaseID
+	r.regMu.Unlock()
+	_, err = r.client.Revoke(context.Background(), leaseID)
+	require.NoError(t, err)
+
+	expect := func(state RegistrationState) {
+		select {
+		case got := <-states:
+			assert.Equal(t, state, got)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("state %s not reported", state)
+		}
+	}
+	expect(StateLeaseLost)
+	expect(StateRegistered)
+	eps := listEndpoints(t, r.client, "openim/user")
+	require.Len(t, eps, 1)
+	for _, ep := range eps {
+		assert.Equal(t, "127.0.0.1:10110", ep.Addr)
+	}
+	r.regMu.Lock()
+	assert.NotEqual(t, leaseID, r.leaseID)
+	r.regMu.Unlock()
+
+	require.NoError(t, r.UnRegister())
+	expect(StateUnregistered)
+	assert.Empty(t, listEndpoints(t, r.client, "openim/user"))
+}
+
+func TestCloseStopsGoroutines(t *testing.T) {
+	addr := startEtcd(t)
+	r, err := NewSvcDiscoveryRegistry("openim", []string{addr})
+	require.NoError(t, err)
+	require.NoError(t, r.Register("user", "127.0.0.1", 10110))
+
+	closed := make(chan struct{})
+	go func() {
+		r.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not stop the background goroutines")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := backoff{min: time.Second, max: 5 * time.Second}
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		delays = append(delays, b.Next())
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, delays)
+}
+
+func TestIncrementalConnMap(t *testing.T) {
+	ctx := context.Background()
+	addr := startEtcd(t)
+	newRegistry := func() *SvcDiscoveryRegistryImpl {
+		r, err := NewSvcDiscoveryRegistry("openim", []string{addr})
+		require.NoError(t, err)
+		r.AddOption(grpc.WithTransportCredentials(insecure.NewCredentials()))
+		t.Cleanup(r.Close)
+		return r
+	}
+	first, second, client := newRegistry(), newRegistry(), newRegistry()
+	require.NoError(t, first.Register("user", "127.0.0.1", 10110))
+
+	conns, err := client.GetConns(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, conns, 1)
+	kept := conns[0]
+
+	require.NoError(t, second.Register("user", "127.0.0.1", 10111))
+	require.Eventually(t, func() bool {
+		conns, _ = client.GetConns(ctx, "user")
+		return len(conns) == 2
+	}, 10*time.Second, 20*time.Millisecond)
+	assert.Same(t, kept, conns[0], "existing connections are reused")
+	removed := conns[1]
+
+	require.NoError(t, second.UnRegister())
+	require.Eventually(t, func() bool {
+		conns, _ = client.GetConns(ctx, "user")
+		return len(conns) == 1
+	}, 10*time.Second, 20*time.Millisecond)
+	assert.Same(t, kept, conns[0])
+	assert.Equal(t, connectivity.Shutdown, removed.GetState(), "removed connections are closed")
+
+	local := client.GetClientLocalConns()
+	require.Len(t, local["user"], 1)
+	assert.Equal(t, "127.0.0.1:10110", local["user"][0].Target())
+}
@@ -0,0 +1,140 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
+)
+
+// RegistrationState describes the state of the etcd registration of this instance
+type RegistrationState int
+
+const (
+	// StateRegistered is reported when the endpoint is written with a live lease, including after recovery
+	StateRegistered RegistrationState = iota
+	// StateLeaseLost is reported when the keep-alive stops, the endpoint is then re-registered in the background
+	StateLeaseLost
+	// StateUnregistered is reported after UnRegister removed the endpoint
+	StateUnregistered
+)
+
+func (s RegistrationState) String() string {
+	switch s {
+	case StateRegistered:
+		return "registered"
+	case StateLeaseLost:
+		return "lease lost"
+	case StateUnregistered:
+		return "unregistered"
+	default:
+		return "unknown"
+	}
+}
+
+// StateCallback receives registration state changes. err is the cause of a lost lease when known
+type StateCallback func(state RegistrationState, err error)
+
+const (
+	defaultLeaseTTL    = 30
+	minRegisterBackoff = 500 * time.Millisecond
+	maxRegisterBackoff = 30 * time.Second
+)
+
+// backoff produces exponentially growing delays between min and max
+type backoff struct {
+	min, max time.Duration
+	next     time.Duration
+}
+
+func (b *backoff) Next() time.Duration {
+	if b.next < b.min {
+		b.next = b.min
+	}
+	d := b.next
+	b.next *= 2
+	if b.next > b.max {
+		b.next = b.max
+	}
+	return d
+}
+
+func (r *SvcDiscoveryRegistryImpl) notifyState(state RegistrationState, err error) {
+	if r.stateCallback != nil {
+		r.stateCallback(state, err)
+	}
+}
+
+// keepAliveLease keeps the lease alive until ctx is done. When the keep-alive stops, e.g. because
+// the lease expired during a network partition, the endpoint is registered again with a new lease.
+func (r *SvcDiscoveryRegistryImpl) keepAliveLease(ctx context.Context, leaseID clientv3.LeaseID) {
+	defer r.wg.Done()
+	for {
+		ch, err := r.client.KeepAlive(ctx, leaseID)
+		if err == nil {
+			for range ch {
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		r.notifyState(StateLeaseLost, err)
+		leaseID = r.reRegister(ctx)
+		if leaseID == clientv3.NoLease {
+			return
+		}
+		r.notifyState(StateRegistered, nil)
+	}
+}
+
+// reRegister grants a new lease and writes the endpoint again, retrying with exponential backoff.
+// It returns NoLease if ctx is done first.
+func (r *SvcDiscoveryRegistryImpl) reRegister(ctx context.Context) clientv3.LeaseID {
+	b := backoff{min: minRegisterBackoff, max: maxRegisterBackoff}
+	for {
+		leaseID, err := r.putEndpoint(ctx)
+		if err == nil {
+			return leaseID
+		}
+		select {
+		case <-ctx.Done():
+			return clientv3.NoLease
+		case <-time.After(b.Next()):
+		}
+	}
+}
+
+// putEndpoint writes the registered endpoint under a new lease
+func (r *SvcDiscoveryRegistryImpl) putEndpoint(ctx context.Context) (clientv3.LeaseID, error) {
+	leaseResp, err := r.client.Grant(ctx, r.leaseTTL)
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+	r.regMu.Lock()
+	em, key := r.endpointMgr, r.serviceKey
+	endpoint := endpoints.Endpoint{Addr: r.rpcRegisterTarget, Metadata: r.metadata}
+	r.regMu.Unlock()
+	if err := em.AddEndpoint(ctx, key, endpoint, clientv3.WithLease(leaseResp.ID)); err != nil {
+		_, _ = r.client.Revoke(context.Background(), leaseResp.ID)
+		return clientv3.NoLease, err
+	}
+	r.regMu.Lock()
+	r.leaseID = leaseResp.ID
+	r.regMu.Unlock()
+	return leaseResp.ID, nil
+}
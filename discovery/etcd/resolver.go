@@ -0,0 +1,66 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"encoding/json"
+
+	"github.com/openimsdk/tools/discovery"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+// metadataBuilder wraps the etcd naming resolver and turns the JSON endpoint metadata
+// into discovery.Metadata attributes, dropping instances rejected by the filter.
+type metadataBuilder struct {
+	gresolver.Builder
+	filter discovery.MetadataFilter
+}
+
+func (b *metadataBuilder) Build(target gresolver.Target, cc gresolver.ClientConn, opts gresolver.BuildOptions) (gresolver.Resolver, error) {
+	return b.Builder.Build(target, &metadataClientConn{ClientConn: cc, filter: b.filter}, opts)
+}
+
+type metadataClientConn struct {
+	gresolver.ClientConn
+	filter discovery.MetadataFilter
+}
+
+func (c *metadataClientConn) UpdateState(state gresolver.State) error {
+	addrs := make([]gresolver.Address, len(state.Addresses))
+	for i, addr := range state.Addresses {
+		md := endpointMetadata(addr.Metadata)
+		addr.Metadata = nil
+		addrs[i] = discovery.SetAddressMetadata(addr, md)
+	}
+	state.Addresses = discovery.FilterAddresses(addrs, c.filter)
+	return c.ClientConn.UpdateState(state)
+}
+
+// endpointMetadata converts endpoints.Endpoint.Metadata, which the etcd resolver decodes
+// into generic JSON values, back into discovery.Metadata.
+func endpointMetadata(v any) *discovery.Metadata {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	md, err := discovery.ParseMetadata(data)
+	if err != nil {
+		return nil
+	}
+	return md
+}
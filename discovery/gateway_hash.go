@@ -0,0 +1,73 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// DefaultGatewayServiceName is the service name the msg-gateway registers under by default.
+const DefaultGatewayServiceName = "messagegateway"
+
+var ErrNoGatewayAvailable = errs.New("no gateway instance available")
+
+// EndpointSource lists the addresses currently registered for a service.
+type EndpointSource func(ctx context.Context, serviceName string) ([]string, error)
+
+// GatewayHashRouter pins a user ID to one gateway instance using a consistent-hash ring
+// that is refreshed from an EndpointSource on every lookup.
+type GatewayHashRouter struct {
+	serviceName string
+	source      EndpointSource
+	ring        *HashRing
+}
+
+// NewGatewayHashRouter creates a router for serviceName. An empty serviceName uses DefaultGatewayServiceName.
+func NewGatewayHashRouter(serviceName string, source EndpointSource) *GatewayHashRouter {
+	if serviceName == "" {
+		serviceName = DefaultGatewayServiceName
+	}
+	return &GatewayHashRouter{
+		serviceName: serviceName,
+		source:      source,
+		ring:        NewHashRing(DefaultReplicas, nil),
+	}
+}
+
+// ServiceName returns the gateway service name the router resolves.
+func (g *GatewayHashRouter) ServiceName() string {
+	return g.serviceName
+}
+
+// Ring returns the underlying hash ring.
+func (g *GatewayHashRouter) Ring() *HashRing {
+	return g.ring
+}
+
+// GetHost returns the gateway address that owns userID.
+func (g *GatewayHashRouter) GetHost(ctx context.Context, userID string) (string, error) {
+	addrs, err := g.source(ctx, g.serviceName)
+	if err != nil {
+		return "", err
+	}
+	g.ring.Set(addrs)
+	host, ok := g.ring.Get(userID)
+	if !ok {
+		return "", ErrNoGatewayAvailable.WrapMsg("get user gateway host failed", "serviceName", g.serviceName, "userID", userID)
+	}
+	return host, nil
+}
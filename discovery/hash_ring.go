@@ -0,0 +1,187 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultReplicas is the number of virtual nodes placed on the ring for every member.
+const DefaultReplicas = 160
+
+// HashFunc maps a key to a position on the ring.
+type HashFunc func(data []byte) uint32
+
+// HashRing is a consistent-hash ring with virtual nodes. Adding or removing a
+// member only moves the keys owned by that member's virtual nodes.
+type HashRing struct {
+	mu       sync.RWMutex
+	hash     HashFunc
+	replicas int
+	keys     []uint32
+	owners   map[uint32]string
+	members  map[string]struct{}
+}
+
+// NewHashRing creates an empty ring. A non-positive replicas uses DefaultReplicas
+// and a nil fn uses crc32.ChecksumIEEE.
+func NewHashRing(replicas int, fn HashFunc) *HashRing {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &HashRing{
+		hash:     fn,
+		replicas: replicas,
+		owners:   make(map[uint32]string),
+		members:  make(map[string]struct{}),
+	}
+}
+
+// Add places the given members on the ring. Members already present are ignored.
+func (h *HashRing) Add(members ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.add(members) {
+		h.sortKeys()
+	}
+}
+
+// Remove takes the given members off the ring. Unknown members are ignored.
+func (h *HashRing) Remove(members ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.remove(members) {
+		h.rebuildKeys()
+	}
+}
+
+// Set replaces the ring membership with members, only touching the difference
+// between the current and the new member list.
+func (h *HashRing) Set(members []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	want := make(map[string]struct{}, len(members))
+	for _, member := range members {
+		want[member] = struct{}{}
+	}
+	var removed []string
+	for member := range h.members {
+		if _, ok := want[member]; !ok {
+			removed = append(removed, member)
+		}
+	}
+	changed := h.remove(removed)
+	if h.add(members) {
+		changed = true
+	}
+	if changed {
+		h.rebuildKeys()
+	}
+}
+
+// Get returns the member owning key. The second return value is false when the ring is empty.
+func (h *HashRing) Get(key string) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.keys) == 0 {
+		return "", false
+	}
+	sum := h.hash([]byte(key))
+	idx := sort.Search(len(h.keys), func(i int) bool { return h.keys[i] >= sum })
+	if idx == len(h.keys) {
+		idx = 0
+	}
+	return h.owners[h.keys[idx]], true
+}
+
+// Members returns the current members in lexical order.
+func (h *HashRing) Members() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	members := make([]string, 0, len(h.members))
+	for member := range h.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Len returns the number of members on the ring.
+func (h *HashRing) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.members)
+}
+
+func (h *HashRing) add(members []string) bool {
+	var changed bool
+	for _, member := range members {
+		if _, ok := h.members[member]; ok {
+			continue
+		}
+		h.members[member] = struct{}{}
+		for i := 0; i < h.replicas; i++ {
+			sum := h.hash([]byte(virtualNode(member, i)))
+			if _, ok := h.owners[sum]; ok {
+				// Keep the first owner on collision so the mapping stays stable.
+				continue
+			}
+			h.owners[sum] = member
+			h.keys = append(h.keys, sum)
+		}
+		changed = true
+	}
+	return changed
+}
+
+func (h *HashRing) remove(members []string) bool {
+	var changed bool
+	for _, member := range members {
+		if _, ok := h.members[member]; !ok {
+			continue
+		}
+		delete(h.members, member)
+		for i := 0; i < h.replicas; i++ {
+			sum := h.hash([]byte(virtualNode(member, i)))
+			if h.owners[sum] == member {
+				delete(h.owners, sum)
+			}
+		}
+		changed = true
+	}
+	return changed
+}
+
+func (h *HashRing) sortKeys() {
+	sort.Slice(h.keys, func(i, j int) bool { return h.keys[i] < h.keys[j] })
+}
+
+func (h *HashRing) rebuildKeys() {
+	h.keys = h.keys[:0]
+	for sum := range h.owners {
+		h.keys = append(h.keys, sum)
+	}
+	h.sortKeys()
+}
+
+func virtualNode(member string, i int) string {
+	return member + "#" + strconv.Itoa(i)
+}
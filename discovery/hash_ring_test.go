@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryEndpoints is an in-memory endpoint table used as the gateway source.
+type memoryEndpoints struct {
+	mu    sync.Mutex
+	addrs map[string][]string
+}
+
+func (m *memoryEndpoints) set(serviceName string, addrs ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addrs[serviceName] = addrs
+}
+
+func (m *memoryEndpoints) source(ctx context.Context, serviceName string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.addrs[serviceName]...), nil
+}
+
+func TestHashRingGet(t *testing.T) {
+	ring := NewHashRing(0, nil)
+	_, ok := ring.Get("user")
+	assert.False(t, ok)
+
+	ring.Add("a:1", "b:1", "c:1")
+	assert.Equal(t, 3, ring.Len())
+	for i := 0; i < 100; i++ {
+		key := "user" + strconv.Itoa(i)
+		first, ok := ring.Get(key)
+		assert.True(t, ok)
+		second, _ := ring.Get(key)
+		assert.Equal(t, first, second)
+	}
+}
+
+func TestHashRingMinimalRebalance(t *testing.T) {
+	ring := NewHashRing(0, nil)
+	ring.Set([]string{"a:1", "b:1", "c:1"})
+	const total = 10000
+	before := make(map[string]string, total)
+	for i := 0; i < total; i++ {
+		key := "user" + strconv.Itoa(i)
+		before[key], _ = ring.Get(key)
+	}
+
+	ring.Set([]string{"a:1", "b:1", "c:1", "d:1"})
+	var moved int
+	for key, owner := range before {
+		now, _ := ring.Get(key)
+		if now != owner {
+			assert.Equal(t, "d:1", now, "keys may only move to the new member")
+			moved++
+		}
+	}
+	assert.Greater(t, moved, 0)
+	assert.Less(t, moved, total/2)
+
+	ring.Set([]string{"a:1", "b:1", "c:1"})
+	for key, owner := range before {
+		now, _ := ring.Get(key)
+		assert.Equal(t, owner, now)
+	}
+	assert.Equal(t, []string{"a:1", "b:1", "c:1"}, ring.Members())
+}
+
+func TestGatewayHashRouter(t *testing.T) {
+	ctx := context.Background()
+	endpoints := &memoryEndpoints{addrs: make(map[string][]string)}
+	router := NewGatewayHashRouter("", endpoints.source)
+	assert.Equal(t, DefaultGatewayServiceName, router.ServiceName())
+
+	_, err := router.GetHost(ctx, "user1")
+	assert.ErrorIs(t, err, ErrNoGatewayAvailable)
+
+	endpoints.set(DefaultGatewayServiceName, "10.0.0.1:10140", "10.0.0.2:10140")
+	host, err := router.GetHost(ctx, "user1")
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"10.0.0.1:10140", "10.0.0.2:10140"}, host)
+
+	endpoints.set(DefaultGatewayServiceName, host)
+	again, err := router.GetHost(ctx, "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, host, again)
+}
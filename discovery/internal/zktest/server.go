@@ -0,0 +1,621 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package zktest provides an in-process ZooKeeper server for tests.
+// It speaks enough of the wire protocol for github.com/go-zookeeper/zk:
+// sessions, persistent, ephemeral and sequential nodes, and one-shot watches.
+// ACLs, quotas and multi requests are not supported.
+package zktest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	opCreate          = 1
+	opDelete          = 2
+	opExists          = 3
+	opGetData         = 4
+	opSetData         = 5
+	opGetChildren     = 8
+	opSync            = 9
+	opPing            = 11
+	opGetChildren2    = 12
+	opCreateContainer = 19
+	opCreateTTL       = 21
+	opClose           = -11
+	opSetAuth         = 100
+	opSetWatches      = 101
+)
+
+const (
+	errOk                      = 0
+	errUnimplemented           = -6
+	errNoNode                  = -101
+	errBadVersion              = -103
+	errNoChildrenForEphemerals = -108
+	errNodeExists              = -110
+	errNotEmpty                = -111
+)
+
+const (
+	eventNodeCreated         = 1
+	eventNodeDeleted         = 2
+	eventNodeDataChanged     = 3
+	eventNodeChildrenChanged = 4
+
+	stateSyncConnected = 3
+)
+
+const (
+	flagEphemeral = 1
+	flagSequence  = 2
+)
+
+type node struct {
+	data     []byte
+	owner    int64
+	version  int32
+	cversion int32
+	czxid    int64
+	mzxid    int64
+	pzxid    int64
+	ctime    int64
+	mtime    int64
+}
+
+type session struct {
+	id      int64
+	passwd  []byte
+	timeout int32
+	conn    *serverConn
+}
+
+type serverConn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+func (c *serverConn) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(b)))
+	_, err := c.Write(append(size[:], b...))
+	return err
+}
+
+// Server is an in-memory ZooKeeper server listening on a loopback address.
+type Server struct {
+	lis net.Listener
+	wg  sync.WaitGroup
+
+	mu           sync.Mutex
+	closed       bool
+	zxid         int64
+	nextSession  int64
+	nodes        map[string]*node
+	sessions     map[int64]*session
+	conns        map[*serverConn]struct{}
+	dataWatches  map[string]map[int64]struct{}
+	childWatches map[string]map[int64]struct{}
+}
+
+// NewServer starts a server on a random loopback port.
+func NewServer() (*Server, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		lis:          lis,
+		nextSession:  time.Now().UnixNano() & 0xffffffff << 16,
+		nodes:        map[string]*node{"/": {}},
+		sessions:     make(map[int64]*session),
+		conns:        make(map[*serverConn]struct{}),
+		dataWatches:  make(map[string]map[int64]struct{}),
+		childWatches: make(map[string]map[int64]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port clients should connect to.
+func (s *Server) Addr() string {
+	return s.lis.Addr().String()
+}
+
+// Close stops the server and drops every connection.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	_ = s.lis.Close()
+	s.wg.Wait()
+}
+
+// ExpireSession expires a session the way a real server does once the session
+// timeout elapses: its ephemeral nodes are removed, its watches are dropped and
+// its connection is closed. A reconnect with the old session id is refused.
+func (s *Server) ExpireSession(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return false
+	}
+	s.removeSession(sess)
+	if sess.conn != nil {
+		_ = sess.conn.Close()
+	}
+	return true
+}
+
+// Children returns the sorted children of path, or nil when path does not exist.
+func (s *Server) Children(path string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.nodes[path]; !ok {
+		return nil
+	}
+	return s.children(path)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			return
+		}
+		c := &serverConn{Conn: conn}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(c)
+		}()
+	}
+}
+
+func readPacket(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > 1<<24 {
+		return nil, errors.New("zktest: packet too large")
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+func (s *Server) handle(c *serverConn) {
+	var sess *session
+	defer func() {
+		_ = c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		if sess != nil && sess.conn == c {
+			sess.conn = nil
+		}
+		s.mu.Unlock()
+	}()
+
+	buf, err := readPacket(c)
+	if err != nil {
+		return
+	}
+	d := &decoder{buf: buf}
+	d.int32() // protocol version
+	d.int64() // last zxid seen
+	timeout := d.int32()
+	id := d.int64()
+	passwd := d.bytes()
+	if d.err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	if id != 0 {
+		if sess = s.sessions[id]; sess == nil || !bytes.Equal(sess.passwd, passwd) {
+			s.mu.Unlock()
+			// A zero session id tells the client its session has expired.
+			e := &encoder{}
+			e.int32(0)
+			e.int32(0)
+			e.int64(0)
+			e.bytes(make([]byte, 16))
+			_ = c.write(e.Bytes())
+			sess = nil
+			return
+		}
+		if sess.conn != nil && sess.conn != c {
+			_ = sess.conn.Close()
+		}
+	} else {
+		s.nextSession++
+		sess = &session{id: s.nextSession, passwd: []byte(fmt.Sprintf("%016d", s.nextSession)), timeout: timeout}
+		s.sessions[sess.id] = sess
+	}
+	sess.conn = c
+	e := &encoder{}
+	e.int32(0)
+	e.int32(sess.timeout)
+	e.int64(sess.id)
+	e.bytes(sess.passwd)
+	s.mu.Unlock()
+	if err := c.write(e.Bytes()); err != nil {
+		return
+	}
+
+	for {
+		buf, err := readPacket(c)
+		if err != nil {
+			return
+		}
+		d := &decoder{buf: buf}
+		xid := d.int32()
+		op := d.int32()
+		if d.err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.sessions[sess.id] != sess {
+			s.mu.Unlock()
+			return
+		}
+		code, body := s.process(sess, op, d)
+		e := &encoder{}
+		e.int32(xid)
+		e.int64(s.zxid)
+		e.int32(code)
+		e.Write(body)
+		if op == opClose {
+			s.removeSession(sess)
+		}
+		s.mu.Unlock()
+		if err := c.write(e.Bytes()); err != nil || op == opClose {
+			return
+		}
+	}
+}
+
+func (s *Server) process(sess *session, op int32, d *decoder) (int32, []byte) {
+	e := &encoder{}
+	switch op {
+	case opPing, opSetAuth, opSetWatches, opClose:
+		// Watches live on the session here, so they survive reconnects without
+		// being set again.
+		return errOk, nil
+	case opSync:
+		e.string(d.string())
+		return errOk, e.Bytes()
+	case opCreate, opCreateContainer, opCreateTTL:
+		path := d.string()
+		data := d.bytes()
+		for i := d.int32(); i > 0; i-- {
+			d.int32()
+			d.string()
+			d.string()
+		}
+		flags := d.int32()
+		name, code := s.create(sess, path, data, flags)
+		if code != errOk {
+			return code, nil
+		}
+		e.string(name)
+		return errOk, e.Bytes()
+	case opDelete:
+		path := d.string()
+		return s.delete(path, d.int32()), nil
+	case opExists, opGetData:
+		path := d.string()
+		watch := d.bool()
+		n, ok := s.nodes[path]
+		if watch && (ok || op == opExists) {
+			addWatch(s.dataWatches, path, sess.id)
+		}
+		if !ok {
+			return errNoNode, nil
+		}
+		if op == opGetData {
+			e.bytes(n.data)
+		}
+		s.encodeStat(e, path, n)
+		return errOk, e.Bytes()
+	case opSetData:
+		path := d.string()
+		data := d.bytes()
+		version := d.int32()
+		n, ok := s.nodes[path]
+		if !ok {
+			return errNoNode, nil
+		}
+		if version != -1 && version != n.version {
+			return errBadVersion, nil
+		}
+		s.zxid++
+		n.data = data
+		n.version++
+		n.mzxid = s.zxid
+		n.mtime = time.Now().UnixMilli()
+		s.fire(s.dataWatches, path, eventNodeDataChanged)
+		s.encodeStat(e, path, n)
+		return errOk, e.Bytes()
+	case opGetChildren, opGetChildren2:
+		path := d.string()
+		watch := d.bool()
+		n, ok := s.nodes[path]
+		if !ok {
+			return errNoNode, nil
+		}
+		if watch {
+			addWatch(s.childWatches, path, sess.id)
+		}
+		e.strings(s.children(path))
+		if op == opGetChildren2 {
+			s.encodeStat(e, path, n)
+		}
+		return errOk, e.Bytes()
+	default:
+		return errUnimplemented, nil
+	}
+}
+
+func parentOf(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+func (s *Server) children(path string) []string {
+	prefix := path + "/"
+	if path == "/" {
+		prefix = "/"
+	}
+	var children []string
+	for p := range s.nodes {
+		if p != "/" && parentOf(p) == path {
+			children = append(children, strings.TrimPrefix(p, prefix))
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+func (s *Server) create(sess *session, path string, data []byte, flags int32) (string, int32) {
+	parentPath := parentOf(path)
+	parent, ok := s.nodes[parentPath]
+	if !ok {
+		return "", errNoNode
+	}
+	if parent.owner != 0 {
+		return "", errNoChildrenForEphemerals
+	}
+	if flags&flagSequence != 0 {
+		path = fmt.Sprintf("%s%010d", path, parent.cversion)
+	}
+	if _, ok := s.nodes[path]; ok {
+		return "", errNodeExists
+	}
+	s.zxid++
+	now := time.Now().UnixMilli()
+	n := &node{data: data, czxid: s.zxid, mzxid: s.zxid, pzxid: s.zxid, ctime: now, mtime: now}
+	if flags&flagEphemeral != 0 {
+		n.owner = sess.id
+	}
+	s.nodes[path] = n
+	parent.cversion++
+	parent.pzxid = s.zxid
+	s.fire(s.dataWatches, path, eventNodeCreated)
+	s.fire(s.childWatches, parentPath, eventNodeChildrenChanged)
+	return path, errOk
+}
+
+func (s *Server) delete(path string, version int32) int32 {
+	n, ok := s.nodes[path]
+	if !ok || path == "/" {
+		return errNoNode
+	}
+	if version != -1 && version != n.version {
+		return errBadVersion
+	}
+	if len(s.children(path)) > 0 {
+		return errNotEmpty
+	}
+	s.zxid++
+	delete(s.nodes, path)
+	parentPath := parentOf(path)
+	if parent, ok := s.nodes[parentPath]; ok {
+		parent.cversion++
+		parent.pzxid = s.zxid
+	}
+	s.fire(s.dataWatches, path, eventNodeDeleted)
+	s.fire(s.childWatches, path, eventNodeDeleted)
+	s.fire(s.childWatches, parentPath, eventNodeChildrenChanged)
+	return errOk
+}
+
+// removeSession deletes the ephemeral nodes and watches of sess. The caller holds s.mu.
+func (s *Server) removeSession(sess *session) {
+	delete(s.sessions, sess.id)
+	for _, watches := range []map[string]map[int64]struct{}{s.dataWatches, s.childWatches} {
+		for path, ids := range watches {
+			delete(ids, sess.id)
+			if len(ids) == 0 {
+				delete(watches, path)
+			}
+		}
+	}
+	var owned []string
+	for path, n := range s.nodes {
+		if n.owner == sess.id {
+			owned = append(owned, path)
+		}
+	}
+	for _, path := range owned {
+		s.delete(path, -1)
+	}
+}
+
+func addWatch(watches map[string]map[int64]struct{}, path string, id int64) {
+	if watches[path] == nil {
+		watches[path] = make(map[int64]struct{})
+	}
+	watches[path][id] = struct{}{}
+}
+
+// fire triggers and clears the watches set on path. The caller holds s.mu.
+func (s *Server) fire(watches map[string]map[int64]struct{}, path string, eventType int32) {
+	ids := watches[path]
+	delete(watches, path)
+	for id := range ids {
+		sess, ok := s.sessions[id]
+		if !ok || sess.conn == nil {
+			continue
+		}
+		e := &encoder{}
+		e.int32(-1)
+		e.int64(-1)
+		e.int32(errOk)
+		e.int32(eventType)
+		e.int32(stateSyncConnected)
+		e.string(path)
+		// Events are written before the triggering response, as a real server does.
+		_ = sess.conn.write(e.Bytes())
+	}
+}
+
+func (s *Server) encodeStat(e *encoder, path string, n *node) {
+	e.int64(n.czxid)
+	e.int64(n.mzxid)
+	e.int64(n.ctime)
+	e.int64(n.mtime)
+	e.int32(n.version)
+	e.int32(n.cversion)
+	e.int32(0)
+	e.int64(n.owner)
+	e.int32(int32(len(n.data)))
+	e.int32(int32(len(s.children(path))))
+	e.int64(n.pzxid)
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) bool() bool {
+	if b := d.next(1); b != nil {
+		return b[0] != 0
+	}
+	return false
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return append([]byte(nil), d.next(int(n))...)
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) int32(v int32) {
+	_ = binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *encoder) int64(v int64) {
+	_ = binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *encoder) bytes(b []byte) {
+	if b == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(b)))
+	e.Write(b)
+}
+
+func (e *encoder) string(v string) {
+	e.int32(int32(len(v)))
+	e.WriteString(v)
+}
+
+func (e *encoder) strings(v []string) {
+	e.int32(int32(len(v)))
+	for _, s := range v {
+		e.string(s)
+	}
+}
@@ -17,24 +17,50 @@ package kubernetes
 import (
 	"context"
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/openimsdk/tools/discovery"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
+const (
+	defaultResyncPeriod = time.Minute * 10
+	defaultSyncTimeout  = time.Second * 30
+)
+
+var _ discovery.SvcDiscoveryRegistry = (*KubernetesConnManager)(nil)
+
 type KubernetesConnManager struct {
-	clientset   *kubernetes.Clientset
+	clientset   kubernetes.Interface
 	namespace   string
 	dialOptions []grpc.DialOption
+	portName    string
+	resync      time.Duration
+	syncTimeout time.Duration
 
-	selfTarget string
+	gatewayName string
+	gateway     *discovery.GatewayHashRouter
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
 
-	mu      sync.RWMutex
-	connMap map[string][]*grpc.ClientConn
+	mu         sync.RWMutex
+	selfTarget string
+	endpoints  map[string][]string
+	resolvers  map[string]map[*Resolver]struct{}
+	connMap    map[string][]*grpc.ClientConn
 }
 
 // NewKubernetesConnManager creates a new connection manager that uses Kubernetes services for service discovery.
@@ -43,84 +69,247 @@ func NewKubernetesConnManager(namespace string, options ...grpc.DialOption) (*Ku
 	if err != nil {
 		return nil, fmt.Errorf("failed to create in-cluster config: %v", err)
 	}
+	return NewKubernetesConnManagerWithConfig(namespace, config, WithDialOptions(options...))
+}
 
+// NewKubernetesConnManagerWithKubeconfig creates a connection manager from a kubeconfig file.
+// An empty kubeconfig path falls back to the in-cluster config.
+func NewKubernetesConnManagerWithKubeconfig(namespace string, kubeconfig string, options ...Option) (*KubernetesConnManager, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from kubeconfig %s: %v", kubeconfig, err)
+	}
+	return NewKubernetesConnManagerWithConfig(namespace, config, options...)
+}
+
+// NewKubernetesConnManagerWithConfig creates a connection manager from an explicit rest.Config.
+func NewKubernetesConnManagerWithConfig(namespace string, config *rest.Config, options ...Option) (*KubernetesConnManager, error) {
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create clientset: %v", err)
 	}
+	return NewKubernetesConnManagerWithClientset(namespace, clientset, options...)
+}
 
-	return &KubernetesConnManager{
+// NewKubernetesConnManagerWithClientset creates a connection manager on top of an existing clientset,
+// which may be a fake clientset in tests. It starts watching the Endpoints of the namespace and
+// returns once the initial list has been synced.
+func NewKubernetesConnManagerWithClientset(namespace string, clientset kubernetes.Interface, options ...Option) (*KubernetesConnManager, error) {
+	k := &KubernetesConnManager{
 		clientset:   clientset,
 		namespace:   namespace,
-		dialOptions: options,
+		dialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		resync:      defaultResyncPeriod,
+		syncTimeout: defaultSyncTimeout,
+		stopCh:      make(chan struct{}),
+		endpoints:   make(map[string][]string),
+		resolvers:   make(map[string]map[*Resolver]struct{}),
 		connMap:     make(map[string][]*grpc.ClientConn),
-	}, nil
+	}
+	for _, option := range options {
+		option(k)
+	}
+	k.gateway = discovery.NewGatewayHashRouter(k.gatewayName, k.getServiceAddrs)
+	if err := k.startInformer(); err != nil {
+		k.Close()
+		return nil, err
+	}
+	return k, nil
 }
 
-func (k *KubernetesConnManager) initializeConnMap() error {
-	k.mu.Lock()
-	defer k.mu.Unlock()
-
-	services, err := k.clientset.CoreV1().Services(k.namespace).List(context.Background(), metav1.ListOptions{})
+func (k *KubernetesConnManager) startInformer() error {
+	factory := informers.NewSharedInformerFactoryWithOptions(k.clientset, k.resync, informers.WithNamespace(k.namespace))
+	informer := factory.Core().V1().Endpoints().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if ep, ok := obj.(*v1.Endpoints); ok {
+				k.updateEndpoints(ep.Name, k.endpointAddrs(ep))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			if ep, ok := newObj.(*v1.Endpoints); ok {
+				k.updateEndpoints(ep.Name, k.endpointAddrs(ep))
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ep, ok := obj.(*v1.Endpoints); ok {
+				k.updateEndpoints(ep.Name, nil)
+			}
+		},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to list services: %v", err)
+		return fmt.Errorf("failed to add endpoints event handler: %v", err)
 	}
+	factory.Start(k.stopCh)
 
-	for _, service := range services.Items {
-		endpoints, err := k.clientset.CoreV1().Endpoints(k.namespace).Get(context.Background(), service.Name, metav1.GetOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to get endpoints for service %s: %v", service.Name, err)
+	ctx, cancel := context.WithTimeout(context.Background(), k.syncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("failed to sync endpoints in namespace %s", k.namespace)
+	}
+	return nil
+}
+
+// endpointAddrs returns the ready addresses of ep on the configured port, sorted.
+func (k *KubernetesConnManager) endpointAddrs(ep *v1.Endpoints) []string {
+	var addrs []string
+	for _, subset := range ep.Subsets {
+		port, ok := k.selectPort(subset.Ports)
+		if !ok {
+			continue
+		}
+		for _, address := range subset.Addresses {
+			addrs = append(addrs, net.JoinHostPort(address.IP, strconv.Itoa(int(port))))
 		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
 
-		var conns []*grpc.ClientConn
-		for _, subset := range endpoints.Subsets {
-			for _, address := range subset.Addresses {
-				conn, err := grpc.Dial(address.IP, append(k.dialOptions, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
-				if err != nil {
-					return fmt.Errorf("failed to dial endpoint %s: %v", address.IP, err)
-				}
-				conns = append(conns, conn)
+// selectPort picks the port named portName, or the first port when no name is configured.
+func (k *KubernetesConnManager) selectPort(ports []v1.EndpointPort) (int32, bool) {
+	if len(ports) == 0 {
+		return 0, false
+	}
+	if k.portName == "" {
+		return ports[0].Port, true
+	}
+	for _, port := range ports {
+		if port.Name == k.portName {
+			return port.Port, true
+		}
+	}
+	return 0, false
+}
+
+// updateEndpoints stores the new address list of a service, drops connections to removed
+// addresses and pushes the change to every resolver watching the service.
+func (k *KubernetesConnManager) updateEndpoints(serviceName string, addrs []string) {
+	k.mu.Lock()
+	if equalAddrs(k.endpoints[serviceName], addrs) {
+		k.mu.Unlock()
+		return
+	}
+	if len(addrs) == 0 {
+		delete(k.endpoints, serviceName)
+	} else {
+		k.endpoints[serviceName] = addrs
+	}
+	if conns, ok := k.connMap[serviceName]; ok {
+		current := make(map[string]struct{}, len(addrs))
+		for _, addr := range addrs {
+			current[addr] = struct{}{}
+		}
+		kept := make([]*grpc.ClientConn, 0, len(conns))
+		for _, conn := range conns {
+			if _, ok := current[conn.Target()]; ok {
+				kept = append(kept, conn)
+			} else {
+				_ = conn.Close()
 			}
 		}
-		k.connMap[service.Name] = conns
+		if len(kept) == 0 {
+			delete(k.connMap, serviceName)
+		} else {
+			k.connMap[serviceName] = kept
+		}
 	}
+	resolvers := make([]*Resolver, 0, len(k.resolvers[serviceName]))
+	for r := range k.resolvers[serviceName] {
+		resolvers = append(resolvers, r)
+	}
+	k.mu.Unlock()
+	// Resolvers are updated outside the lock, gRPC may call back into the manager.
+	for _, r := range resolvers {
+		r.refresh()
+	}
+}
 
-	return nil
+func equalAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// getServiceAddrs lists the ready endpoint addresses of a Kubernetes service.
+func (k *KubernetesConnManager) getServiceAddrs(ctx context.Context, serviceName string) ([]string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]string(nil), k.endpoints[serviceName]...), nil
+}
+
+// SetGatewayServiceName sets the Kubernetes service name used by GetUserIdHashGatewayHost.
+func (k *KubernetesConnManager) SetGatewayServiceName(serviceName string) {
+	gateway := discovery.NewGatewayHashRouter(serviceName, k.getServiceAddrs)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.gatewayName = serviceName
+	k.gateway = gateway
 }
 
 // GetConns returns gRPC client connections for a given Kubernetes service name.
 func (k *KubernetesConnManager) GetConns(ctx context.Context, serviceName string, opts ...grpc.DialOption) ([]*grpc.ClientConn, error) {
-	// k.mu.RLock()
-	// defer k.mu.RUnlock()
-	// if len(k.connMap) == 0 {
-	// 	if err := k.initializeConnMap(); err != nil {
-	// 		return nil, err
-	// 	}
-	// }
-
-	// return k.connMap[serviceName], nil
-	return nil, nil
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if conns, ok := k.connMap[serviceName]; ok && len(conns) == len(k.endpoints[serviceName]) {
+		return conns, nil
+	}
+	existing := make(map[string]*grpc.ClientConn, len(k.connMap[serviceName]))
+	for _, conn := range k.connMap[serviceName] {
+		existing[conn.Target()] = conn
+	}
+	conns := make([]*grpc.ClientConn, 0, len(k.endpoints[serviceName]))
+	for _, addr := range k.endpoints[serviceName] {
+		if conn, ok := existing[addr]; ok {
+			conns = append(conns, conn)
+			continue
+		}
+		conn, err := grpc.DialContext(ctx, addr, append(append([]grpc.DialOption{}, k.dialOptions...), opts...)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial endpoint %s: %v", addr, err)
+		}
+		conns = append(conns, conn)
+	}
+	k.connMap[serviceName] = conns
+	return conns, nil
 }
 
 // GetConn returns a single gRPC client connection for a given Kubernetes service name.
+// A bare service name is resolved through the endpoints informer, so it follows pods as they
+// come and go. Targets carrying a port or a scheme, such as "svc:port", are dialed as written.
 func (k *KubernetesConnManager) GetConn(ctx context.Context, serviceName string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
-	// k.mu.RLock()
-	// if len(k.connMap) == 0 {
-	// 	k.mu.RUnlock()
-	// 	if err := k.initializeConnMap(); err != nil {
-	// 		return nil, err
-	// 	}
-	// 	k.mu.RLock()
-	// }
-
-	// defer k.mu.RUnlock()
+	k.mu.RLock()
+	dialOptions := append(append([]grpc.DialOption{}, k.dialOptions...), opts...)
+	k.mu.RUnlock()
+	if isDialTarget(serviceName) {
+		return grpc.DialContext(ctx, serviceName, dialOptions...)
+	}
+	target := fmt.Sprintf("%s:///%s", scheme, serviceName)
+	return grpc.DialContext(ctx, target, append(dialOptions, grpc.WithResolvers(k))...)
+}
 
-	// return k.connMap[serviceName][0], nil
-	return grpc.DialContext(ctx, serviceName, append(k.dialOptions, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+// isDialTarget reports whether target is a complete gRPC target rather than a service name.
+func isDialTarget(target string) bool {
+	if strings.Contains(target, "://") {
+		return true
+	}
+	_, _, err := net.SplitHostPort(target)
+	return err == nil
 }
 
 // GetSelfConnTarget returns the connection target for the current service.
 func (k *KubernetesConnManager) GetSelfConnTarget() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	return k.selfTarget
 }
 
@@ -136,8 +325,11 @@ func (k *KubernetesConnManager) CloseConn(conn *grpc.ClientConn) {
 	conn.Close()
 }
 
-// Close closes all gRPC connections managed by KubernetesConnManager.
+// Close stops the endpoints informer and closes all gRPC connections managed by KubernetesConnManager.
 func (k *KubernetesConnManager) Close() {
+	k.stopOnce.Do(func() {
+		close(k.stopCh)
+	})
 	k.mu.Lock()
 	defer k.mu.Unlock()
 	for _, conns := range k.connMap {
@@ -148,13 +340,26 @@ func (k *KubernetesConnManager) Close() {
 	k.connMap = make(map[string][]*grpc.ClientConn)
 }
 
+// Register records the address of the current service. Kubernetes publishes the pod in the
+// service Endpoints once it is ready, so nothing is written to the API server.
 func (k *KubernetesConnManager) Register(serviceName, host string, port int, opts ...grpc.DialOption) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.selfTarget = net.JoinHostPort(host, strconv.Itoa(port))
 	return nil
 }
+
 func (k *KubernetesConnManager) UnRegister() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.selfTarget = ""
 	return nil
 }
 
+// GetUserIdHashGatewayHost returns the gateway address owning the user ID on the consistent-hash ring.
 func (k *KubernetesConnManager) GetUserIdHashGatewayHost(ctx context.Context, userId string) (string, error) {
-	return "", nil
+	k.mu.RLock()
+	gateway := k.gateway
+	k.mu.RUnlock()
+	return gateway.GetHost(ctx, userId)
 }
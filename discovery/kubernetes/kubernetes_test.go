@@ -0,0 +1,195 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const namespace = "openim"
+
+func newEndpoints(name string, ips ...string) *v1.Endpoints {
+	addrs := make([]v1.EndpointAddress, len(ips))
+	for i, ip := range ips {
+		addrs[i] = v1.EndpointAddress{IP: ip}
+	}
+	return &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Subsets: []v1.EndpointSubset{{
+			Addresses: addrs,
+			Ports: []v1.EndpointPort{
+				{Name: "metrics", Port: 9090},
+				{Name: "grpc", Port: 10110},
+			},
+		}},
+	}
+}
+
+type fakeClientConn struct {
+	states chan resolver.State
+}
+
+func (f *fakeClientConn) UpdateState(state resolver.State) error {
+	f.states <- state
+	return nil
+}
+
+func (f *fakeClientConn) ReportError(error) {
+	f.states <- resolver.State{}
+}
+
+func (f *fakeClientConn) NewAddress([]resolver.Address) {}
+
+func (f *fakeClientConn) ParseServiceConfig(string) *serviceconfig.ParseResult { return nil }
+
+func eventually(t *testing.T, fn func() bool) {
+	t.Helper()
+	assert.Eventually(t, fn, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestEndpointsDiscovery(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(newEndpoints("user", "10.0.0.1"))
+	k, err := NewKubernetesConnManagerWithClientset(namespace, clientset, WithPortName("grpc"))
+	require.NoError(t, err)
+	defer k.Close()
+
+	addrs, err := k.getServiceAddrs(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:10110"}, addrs)
+
+	conns, err := k.GetConns(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, conns, 1)
+	assert.Equal(t, "10.0.0.1:10110", conns[0].Target())
+
+	_, err = clientset.CoreV1().Endpoints(namespace).Update(ctx, newEndpoints("user", "10.0.0.1", "10.0.0.2"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	eventually(t, func() bool {
+		conns, err = k.GetConns(ctx, "user")
+		return err == nil && len(conns) == 2
+	})
+
+	require.NoError(t, clientset.CoreV1().Endpoints(namespace).Delete(ctx, "user", metav1.DeleteOptions{}))
+	eventually(t, func() bool {
+		conns, err = k.GetConns(ctx, "user")
+		return err == nil && len(conns) == 0
+	})
+}
+
+func TestResolverUpdates(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(newEndpoints("msg", "10.0.0.1"))
+	k, err := NewKubernetesConnManagerWithClientset(namespace, clientset, WithPortName("grpc"))
+	require.NoError(t, err)
+	defer k.Close()
+
+	cc := &fakeClientConn{states: make(chan resolver.State, 16)}
+	target := resolver.Target{}
+	target.URL.Path = "/msg"
+	r, err := k.Build(target, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	next := func() []string {
+		select {
+		case state := <-cc.states:
+			addrs := make([]string, len(state.Addresses))
+			for i, addr := range state.Addresses {
+				addrs[i] = addr.Addr
+			}
+			return addrs
+		case <-time.After(2 * time.Second):
+			t.Fatal("resolver not updated")
+			return nil
+		}
+	}
+	assert.Equal(t, []string{"10.0.0.1:10110"}, next())
+
+	_, err = clientset.CoreV1().Endpoints(namespace).Update(ctx, newEndpoints("msg", "10.0.0.3", "10.0.0.2"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2:10110", "10.0.0.3:10110"}, next())
+
+	host, err := func() (string, error) {
+		k.SetGatewayServiceName("msg")
+		return k.GetUserIdHashGatewayHost(ctx, "user1")
+	}()
+	require.NoError(t, err)
+	assert.Contains(t, []string{"10.0.0.2:10110", "10.0.0.3:10110"}, host)
+}
+
+func TestSetGatewayServiceNameConcurrently(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(newEndpoints("msg", "10.0.0.1"), newEndpoints("msg2", "10.0.0.2"))
+	k, err := NewKubernetesConnManagerWithClientset(namespace, clientset, WithPortName("grpc"), WithGatewayServiceName("msg"))
+	require.NoError(t, err)
+	defer k.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			k.SetGatewayServiceName([]string{"msg", "msg2"}[i%2])
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		host, err := k.GetUserIdHashGatewayHost(ctx, "user1")
+		require.NoError(t, err)
+		assert.Contains(t, []string{"10.0.0.1:10110", "10.0.0.2:10110"}, host)
+	}
+	<-done
+}
+
+func TestGetConnTargets(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(newEndpoints("user", "10.0.0.1"))
+	k, err := NewKubernetesConnManagerWithClientset(namespace, clientset, WithPortName("grpc"))
+	require.NoError(t, err)
+	defer k.Close()
+
+	for target, want := range map[string]string{
+		"user":                 "kubernetes:///user",
+		"user:10110":           "user:10110",
+		"dns:///user:10110":    "dns:///user:10110",
+		"user.openim.svc:8080": "user.openim.svc:8080",
+	} {
+		conn, err := k.GetConn(ctx, target)
+		require.NoError(t, err)
+		assert.Equal(t, want, conn.Target())
+		require.NoError(t, conn.Close())
+	}
+
+	// A svc:port target is not looked up as a service name.
+	k.mu.RLock()
+	_, ok := k.resolvers["user:10110"]
+	k.mu.RUnlock()
+	assert.False(t, ok)
+}
+
+func TestRegisterConcurrently(t *testing.T) {
+	k, err := NewKubernetesConnManagerWithClientset(namespace, fake.NewSimpleClientset(), WithPortName("grpc"))
+	require.NoError(t, err)
+	defer k.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, k.Register("user", "10.0.0.1", 10110))
+			assert.NoError(t, k.UnRegister())
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.Contains(t, []string{"", "10.0.0.1:10110"}, k.GetSelfConnTarget())
+	}
+	<-done
+	assert.Empty(t, k.GetSelfConnTarget())
+}
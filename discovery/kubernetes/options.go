@@ -0,0 +1,58 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+type Option func(*KubernetesConnManager)
+
+// WithDialOptions appends gRPC dial options used for every connection.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(k *KubernetesConnManager) {
+		k.dialOptions = append(k.dialOptions, opts...)
+	}
+}
+
+// WithPortName selects the endpoint port by name. Without it the first port of each subset is used.
+func WithPortName(portName string) Option {
+	return func(k *KubernetesConnManager) {
+		k.portName = portName
+	}
+}
+
+// WithResyncPeriod sets the resync period of the endpoints informer.
+func WithResyncPeriod(period time.Duration) Option {
+	return func(k *KubernetesConnManager) {
+		k.resync = period
+	}
+}
+
+// WithSyncTimeout bounds how long the constructor waits for the initial endpoints list.
+func WithSyncTimeout(timeout time.Duration) Option {
+	return func(k *KubernetesConnManager) {
+		k.syncTimeout = timeout
+	}
+}
+
+// WithGatewayServiceName sets the service name used by GetUserIdHashGatewayHost.
+func WithGatewayServiceName(serviceName string) Option {
+	return func(k *KubernetesConnManager) {
+		k.gatewayName = serviceName
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/resolver"
+)
+
+const scheme = "kubernetes"
+
+// Resolver pushes the endpoint addresses of one service into a gRPC ClientConn.
+type Resolver struct {
+	manager     *KubernetesConnManager
+	serviceName string
+	cc          resolver.ClientConn
+	mu          sync.Mutex
+}
+
+// refresh pushes the latest addresses of the service. Calls are serialized so an older
+// snapshot can never overwrite a newer one.
+func (r *Resolver) refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	addrs, _ := r.manager.getServiceAddrs(context.Background(), r.serviceName)
+	if len(addrs) == 0 {
+		r.cc.ReportError(fmt.Errorf("no ready endpoints for service %s", r.serviceName))
+		return
+	}
+	state := resolver.State{Addresses: make([]resolver.Address, len(addrs))}
+	for i, addr := range addrs {
+		state.Addresses[i] = resolver.Address{Addr: addr, ServerName: r.serviceName}
+	}
+	_ = r.cc.UpdateState(state)
+}
+
+func (r *Resolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *Resolver) Close() {
+	r.manager.mu.Lock()
+	defer r.manager.mu.Unlock()
+	delete(r.manager.resolvers[r.serviceName], r)
+	if len(r.manager.resolvers[r.serviceName]) == 0 {
+		delete(r.manager.resolvers, r.serviceName)
+	}
+}
+
+func (k *KubernetesConnManager) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	serviceName := strings.TrimLeft(target.URL.Path, "/")
+	r := &Resolver{manager: k, serviceName: serviceName, cc: cc}
+	k.mu.Lock()
+	if _, ok := k.resolvers[serviceName]; !ok {
+		k.resolvers[serviceName] = make(map[*Resolver]struct{})
+	}
+	k.resolvers[serviceName][r] = struct{}{}
+	k.mu.Unlock()
+	r.refresh()
+	return r, nil
+}
+
+func (k *KubernetesConnManager) Scheme() string { return scheme }
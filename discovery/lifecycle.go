@@ -0,0 +1,201 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// CheckHealth runs the grpc.health.v1 check against target until it reports SERVING
+// or ctx is done. service is the health service name, "" checks the whole server.
+func CheckHealth(ctx context.Context, target string, service string, opts ...grpc.DialOption) error {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	conn, err := grpc.DialContext(ctx, target, opts...)
+	if err != nil {
+		return errs.WrapMsg(err, "dial health check target failed", "target", target)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service}, grpc.WaitForReady(true))
+		if err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				return errs.New("service is not serving", "target", target, "status", resp.Status.String()).Wrap()
+			}
+			return errs.WrapMsg(err, "health check failed", "target", target)
+		case <-ticker.C:
+		}
+	}
+}
+
+// InflightTracker counts the RPCs being served so shutdown can wait for them.
+// Install its interceptors on the gRPC server of the registered service.
+type InflightTracker struct {
+	mu    sync.Mutex
+	count int64
+	idle  chan struct{}
+}
+
+// NewInflightTracker creates an idle tracker.
+func NewInflightTracker() *InflightTracker {
+	idle := make(chan struct{})
+	close(idle)
+	return &InflightTracker{idle: idle}
+}
+
+// Start records a new in-flight RPC. The returned function must be called when it ends.
+func (t *InflightTracker) Start() (done func()) {
+	t.mu.Lock()
+	t.count++
+	if t.count == 1 {
+		t.idle = make(chan struct{})
+	}
+	t.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.count--
+			if t.count == 0 {
+				close(t.idle)
+			}
+		})
+	}
+}
+
+// Inflight returns the number of RPCs being served.
+func (t *InflightTracker) Inflight() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count
+}
+
+// Wait blocks until no RPC is in flight or ctx is done.
+func (t *InflightTracker) Wait(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		idle, count := t.idle, t.count
+		t.mu.Unlock()
+		if count == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errs.WrapMsg(ctx.Err(), "wait in-flight rpc timeout", "inflight", t.Inflight())
+		case <-idle:
+		}
+	}
+}
+
+// UnaryServerInterceptor tracks unary RPCs.
+func (t *InflightTracker) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		defer t.Start()()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor tracks streaming RPCs.
+func (t *InflightTracker) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		defer t.Start()()
+		return handler(srv, ss)
+	}
+}
+
+// DefaultDrainGrace is the time a draining instance stays registered before Drain starts
+// waiting for in-flight RPCs, so that clients see it is draining and stop picking it.
+const DefaultDrainGrace = time.Second
+
+// Lifecycle holds the optional health check run after registration and the drain run
+// before deregistration. The zero value does neither.
+type Lifecycle struct {
+	// HealthCheckTimeout enables the health check after Register when positive.
+	HealthCheckTimeout time.Duration
+	// HealthCheckService is the health service name, "" checks the whole server.
+	HealthCheckService string
+	// HealthCheckDialOptions are used to dial the registered target, insecure by default.
+	HealthCheckDialOptions []grpc.DialOption
+
+	// DrainTimeout enables draining on UnRegister when positive: the instance is marked
+	// draining, then UnRegister waits DrainGrace and for Tracker to go idle, at most
+	// DrainTimeout, before removing it. Without a Tracker the whole DrainTimeout is waited.
+	DrainTimeout time.Duration
+	Tracker      *InflightTracker
+	// DrainGrace is the time given to clients to see the draining mark, DefaultDrainGrace if zero.
+	DrainGrace time.Duration
+}
+
+// CheckHealth checks target if the health check is enabled.
+func (l *Lifecycle) CheckHealth(target string) error {
+	if l.HealthCheckTimeout <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.HealthCheckTimeout)
+	defer cancel()
+	return CheckHealth(ctx, target, l.HealthCheckService, l.HealthCheckDialOptions...)
+}
+
+// DrainEnabled reports whether UnRegister should drain the instance.
+func (l *Lifecycle) DrainEnabled() bool {
+	return l.DrainTimeout > 0
+}
+
+// Drain waits DrainGrace for the draining mark to reach clients, then for in-flight RPCs
+// to finish, at most DrainTimeout. Reaching the deadline is not an error, the instance is
+// removed anyway.
+func (l *Lifecycle) Drain() {
+	if !l.DrainEnabled() {
+		return
+	}
+	grace := l.DrainGrace
+	if grace <= 0 {
+		grace = DefaultDrainGrace
+	}
+	time.Sleep(grace)
+	ctx, cancel := context.WithTimeout(context.Background(), l.DrainTimeout)
+	defer cancel()
+	if l.Tracker == nil {
+		<-ctx.Done()
+		return
+	}
+	_ = l.Tracker.Wait(ctx)
+}
+
+// DrainingMetadata returns a copy of md marked as draining.
+func DrainingMetadata(md *Metadata) *Metadata {
+	res := &Metadata{}
+	if md != nil {
+		res = md.Clone()
+	}
+	res.Draining = true
+	return res
+}
@@ -0,0 +1,68 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestInflightTracker(t *testing.T) {
+	tracker := NewInflightTracker()
+	require.NoError(t, tracker.Wait(context.Background()))
+
+	done := tracker.Start()
+	assert.Equal(t, int64(1), tracker.Inflight())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, tracker.Wait(ctx))
+
+	waited := make(chan error, 1)
+	go func() { waited <- tracker.Wait(context.Background()) }()
+	done()
+	done()
+	select {
+	case err := <-waited:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after the rpc finished")
+	}
+	assert.Equal(t, int64(0), tracker.Inflight())
+}
+
+func TestLifecycleDrainGrace(t *testing.T) {
+	l := &Lifecycle{DrainTimeout: 5 * time.Second, Tracker: NewInflightTracker(), DrainGrace: 100 * time.Millisecond}
+	start := time.Now()
+	l.Drain()
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "an idle tracker still waits the grace")
+
+	l.DrainGrace = 0
+	start = time.Now()
+	l.Drain()
+	assert.GreaterOrEqual(t, time.Since(start), DefaultDrainGrace)
+}
+
+func TestCheckHealth(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, CheckHealth(ctx, lis.Addr().String(), ""))
+
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	assert.Error(t, CheckHealth(ctx, lis.Addr().String(), ""))
+}
@@ -0,0 +1,186 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+)
+
+// DefaultWeight is the weight of an instance that did not publish one.
+const DefaultWeight = 100
+
+// Metadata describes a registered service instance. It is stored as JSON next to the
+// address in the registry and surfaced to balancers through resolver.Address Attributes.
+type Metadata struct {
+	Version   string            `json:"version,omitempty"`
+	Zone      string            `json:"zone,omitempty"`
+	Weight    int               `json:"weight,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	StartTime int64             `json:"startTime,omitempty"` // unix milliseconds
+	// Draining is set while the instance shuts down, resolvers stop returning it.
+	Draining bool `json:"draining,omitempty"`
+}
+
+// MetadataRegistry is implemented by registries that can publish Metadata with a registration.
+type MetadataRegistry interface {
+	RegisterWithMetadata(serviceName, host string, port int, md *Metadata, opts ...grpc.DialOption) error
+}
+
+// NewMetadata returns the metadata used when a service registers without any, stamped with the current time.
+func NewMetadata() *Metadata {
+	return &Metadata{
+		Weight:    DefaultWeight,
+		StartTime: time.Now().UnixMilli(),
+	}
+}
+
+// Clone returns a deep copy of m.
+func (m *Metadata) Clone() *Metadata {
+	if m == nil {
+		return nil
+	}
+	res := *m
+	if m.Tags != nil {
+		res.Tags = make(map[string]string, len(m.Tags))
+		for k, v := range m.Tags {
+			res.Tags[k] = v
+		}
+	}
+	return &res
+}
+
+// RegisterMetadata returns the metadata a registry stores for md: a copy stamped with the
+// current time if md has no StartTime, or NewMetadata if md is nil. md itself is not modified.
+func RegisterMetadata(md *Metadata) *Metadata {
+	if md == nil {
+		return NewMetadata()
+	}
+	res := md.Clone()
+	if res.StartTime == 0 {
+		res.StartTime = time.Now().UnixMilli()
+	}
+	return res
+}
+
+// GetWeight returns the weight of the instance, falling back to DefaultWeight.
+func (m *Metadata) GetWeight() int {
+	if m == nil || m.Weight <= 0 {
+		return DefaultWeight
+	}
+	return m.Weight
+}
+
+// Equal reports whether o carries the same metadata. gRPC uses it to compare
+// address attributes, so equal metadata keeps existing sub-connections.
+func (m *Metadata) Equal(o any) bool {
+	other, ok := o.(*Metadata)
+	if !ok {
+		return false
+	}
+	if m == nil || other == nil {
+		return m == other
+	}
+	if m.Version != other.Version || m.Zone != other.Zone || m.Weight != other.Weight || m.StartTime != other.StartTime || m.Draining != other.Draining {
+		return false
+	}
+	if len(m.Tags) != len(other.Tags) {
+		return false
+	}
+	for k, v := range m.Tags {
+		if ov, ok := other.Tags[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Marshal encodes the metadata as JSON.
+func (m *Metadata) Marshal() ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "marshal metadata failed")
+	}
+	return data, nil
+}
+
+// ParseMetadata decodes JSON metadata. Empty data yields nil metadata.
+func ParseMetadata(data []byte) (*Metadata, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var md Metadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, errs.WrapMsg(err, "unmarshal metadata failed", "data", string(data))
+	}
+	return &md, nil
+}
+
+type metadataKey struct{}
+
+// SetAddressMetadata returns addr with md attached to its Attributes.
+func SetAddressMetadata(addr resolver.Address, md *Metadata) resolver.Address {
+	if md == nil {
+		return addr
+	}
+	addr.Attributes = addr.Attributes.WithValue(metadataKey{}, md)
+	return addr
+}
+
+// GetAddressMetadata returns the metadata attached to addr by a registry.
+func GetAddressMetadata(addr resolver.Address) (*Metadata, bool) {
+	md, ok := addr.Attributes.Value(metadataKey{}).(*Metadata)
+	return md, ok && md != nil
+}
+
+// MetadataFilter decides whether an instance is usable. md is nil for instances
+// that registered without metadata.
+type MetadataFilter func(md *Metadata) bool
+
+// VersionFilter accepts instances whose version is one of versions, which is how
+// clients pin themselves to a canary release.
+func VersionFilter(versions ...string) MetadataFilter {
+	set := make(map[string]struct{}, len(versions))
+	for _, version := range versions {
+		set[version] = struct{}{}
+	}
+	return func(md *Metadata) bool {
+		if md == nil {
+			return false
+		}
+		_, ok := set[md.Version]
+		return ok
+	}
+}
+
+// FilterAddresses drops draining instances and keeps the addresses accepted by filter.
+// A nil filter keeps every instance that is not draining.
+func FilterAddresses(addrs []resolver.Address, filter MetadataFilter) []resolver.Address {
+	res := make([]resolver.Address, 0, len(addrs))
+	for _, addr := range addrs {
+		md, _ := GetAddressMetadata(addr)
+		if md != nil && md.Draining {
+			continue
+		}
+		if filter == nil || filter(md) {
+			res = append(res, addr)
+		}
+	}
+	return res
+}
@@ -0,0 +1,64 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	md := &Metadata{Version: "v2", Zone: "zone-a", Weight: 20, Tags: map[string]string{"env": "canary"}, StartTime: 1700000000000}
+	data, err := md.Marshal()
+	require.NoError(t, err)
+	parsed, err := ParseMetadata(data)
+	require.NoError(t, err)
+	assert.True(t, md.Equal(parsed))
+
+	parsed.Tags["env"] = "prod"
+	assert.False(t, md.Equal(parsed))
+
+	empty, err := ParseMetadata(nil)
+	require.NoError(t, err)
+	assert.Nil(t, empty)
+	assert.Equal(t, DefaultWeight, empty.GetWeight())
+
+	_, err = ParseMetadata([]byte("{"))
+	assert.Error(t, err)
+}
+
+func TestRegisterMetadata(t *testing.T) {
+	md := &Metadata{Version: "v1", Tags: map[string]string{"env": "canary"}}
+	registered := RegisterMetadata(md)
+	assert.NotZero(t, registered.StartTime)
+	assert.Zero(t, md.StartTime, "the caller's metadata is not modified")
+	registered.Tags["env"] = "prod"
+	assert.Equal(t, "canary", md.Tags["env"])
+
+	draining := DrainingMetadata(registered)
+	draining.Tags["env"] = "staging"
+	assert.False(t, registered.Draining)
+	assert.Equal(t, "prod", registered.Tags["env"])
+
+	assert.Equal(t, DefaultWeight, RegisterMetadata(nil).Weight)
+	assert.Nil(t, (*Metadata)(nil).Clone())
+}
+
+func TestFilterAddresses(t *testing.T) {
+	addrs := []resolver.Address{
+		SetAddressMetadata(resolver.Address{Addr: "10.0.0.1:10110"}, &Metadata{Version: "v1"}),
+		SetAddressMetadata(resolver.Address{Addr: "10.0.0.2:10110"}, &Metadata{Version: "v2"}),
+		{Addr: "10.0.0.3:10110"},
+	}
+	md, ok := GetAddressMetadata(addrs[1])
+	assert.True(t, ok)
+	assert.Equal(t, "v2", md.Version)
+	_, ok = GetAddressMetadata(addrs[2])
+	assert.False(t, ok)
+
+	assert.Len(t, FilterAddresses(addrs, nil), 3)
+	filtered := FilterAddresses(addrs, VersionFilter("v2"))
+	require.Len(t, filtered, 1)
+	assert.Equal(t, "10.0.0.2:10110", filtered[0].Addr)
+}
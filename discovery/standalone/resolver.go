@@ -0,0 +1,62 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package standalone
+
+import (
+	"strings"
+
+	"github.com/openimsdk/tools/discovery"
+	"google.golang.org/grpc/resolver"
+)
+
+const scheme = "standalone"
+
+// builder is a resolver.Builder backed by a Table.
+type builder struct {
+	table  *Table
+	filter discovery.MetadataFilter
+}
+
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	serviceName := strings.TrimLeft(target.URL.Path, "/")
+	r := &tableResolver{}
+	r.cancel = b.table.Watch(serviceName, func(addrs []string) {
+		state := resolver.State{Addresses: make([]resolver.Address, len(addrs))}
+		for i, addr := range addrs {
+			state.Addresses[i] = discovery.SetAddressMetadata(resolver.Address{Addr: addr, ServerName: serviceName}, b.table.Metadata(serviceName, addr))
+		}
+		state.Addresses = discovery.FilterAddresses(state.Addresses, b.filter)
+		if len(state.Addresses) == 0 {
+			cc.ReportError(errNoAddress(serviceName))
+			return
+		}
+		_ = cc.UpdateState(state)
+	})
+	return r, nil
+}
+
+func (b *builder) Scheme() string {
+	return scheme
+}
+
+type tableResolver struct {
+	cancel func()
+}
+
+func (r *tableResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *tableResolver) Close() {
+	r.cancel()
+}
@@ -0,0 +1,271 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package standalone
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/discovery"
+	"github.com/openimsdk/tools/errs"
+	"google.golang.org/grpc"
+)
+
+var (
+	_ discovery.SvcDiscoveryRegistry = (*SvcDiscoveryRegistryImpl)(nil)
+	_ discovery.MetadataRegistry     = (*SvcDiscoveryRegistryImpl)(nil)
+)
+
+func errNoAddress(serviceName string) error {
+	return errs.New("no address registered", "serviceName", serviceName).Wrap()
+}
+
+// Option configures a SvcDiscoveryRegistryImpl.
+type Option func(*SvcDiscoveryRegistryImpl)
+
+// WithTable binds the registry to table instead of the process-wide default table.
+func WithTable(table *Table) Option {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.table = table
+	}
+}
+
+// WithDialOptions sets the gRPC dial options used for every connection.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.dialOptions = opts
+	}
+}
+
+// WithGatewayServiceName sets the service name used by GetUserIdHashGatewayHost.
+func WithGatewayServiceName(serviceName string) Option {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.gatewayName = serviceName
+	}
+}
+
+// WithMetadataFilter makes GetConn only balance over instances whose metadata is accepted by filter.
+func WithMetadataFilter(filter discovery.MetadataFilter) Option {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.filter = filter
+	}
+}
+
+// WithHealthCheck makes Register run the grpc.health.v1 check against the registered address,
+// removing it again if it does not report SERVING within timeout.
+func WithHealthCheck(timeout time.Duration, opts ...grpc.DialOption) Option {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.lifecycle.HealthCheckTimeout = timeout
+		r.lifecycle.HealthCheckDialOptions = opts
+	}
+}
+
+// WithDrain makes UnRegister mark the instance draining and wait for the RPCs counted by tracker,
+// at most timeout, before removing it.
+func WithDrain(tracker *discovery.InflightTracker, timeout time.Duration) Option {
+	return func(r *SvcDiscoveryRegistryImpl) {
+		r.lifecycle.Tracker = tracker
+		r.lifecycle.DrainTimeout = timeout
+	}
+}
+
+// SvcDiscoveryRegistryImpl is an in-process discovery.SvcDiscoveryRegistry. Services
+// registered through any registry bound to the same Table are visible to all of them.
+type SvcDiscoveryRegistryImpl struct {
+	table       *Table
+	resolver    *builder
+	dialOptions []grpc.DialOption
+	filter      discovery.MetadataFilter
+	lifecycle   discovery.Lifecycle
+
+	gatewayName string
+	gateway     *discovery.GatewayHashRouter
+
+	mu              sync.Mutex
+	rpcRegisterName string
+	rpcRegisterAddr string
+	connMap         map[string]map[string]*grpc.ClientConn
+}
+
+// NewSvcDiscoveryRegistry creates an in-process registry.
+func NewSvcDiscoveryRegistry(options ...Option) *SvcDiscoveryRegistryImpl {
+	r := &SvcDiscoveryRegistryImpl{
+		table:   defaultTable,
+		connMap: make(map[string]map[string]*grpc.ClientConn),
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+	r.resolver = &builder{table: r.table, filter: r.filter}
+	r.gateway = discovery.NewGatewayHashRouter(r.gatewayName, func(ctx context.Context, serviceName string) ([]string, error) {
+		addrs := r.table.Get(serviceName)
+		active := addrs[:0]
+		for _, addr := range addrs {
+			if md := r.table.Metadata(serviceName, addr); md == nil || !md.Draining {
+				active = append(active, addr)
+			}
+		}
+		return active, nil
+	})
+	return r
+}
+
+// Table returns the service table the registry is bound to.
+func (r *SvcDiscoveryRegistryImpl) Table() *Table {
+	return r.table
+}
+
+// Watch calls fn with the addresses of serviceName now and after every change.
+func (r *SvcDiscoveryRegistryImpl) Watch(serviceName string, fn func(addrs []string)) (cancel func()) {
+	return r.table.Watch(serviceName, fn)
+}
+
+// GetConns returns one connection per registered address of serviceName that is not draining.
+// Connections are reused across calls and closed once their address leaves the table.
+func (r *SvcDiscoveryRegistryImpl) GetConns(ctx context.Context, serviceName string, opts ...grpc.DialOption) ([]*grpc.ClientConn, error) {
+	addrs := r.table.Get(serviceName)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conns := r.connMap[serviceName]
+	if conns == nil {
+		conns = make(map[string]*grpc.ClientConn)
+		r.connMap[serviceName] = conns
+	}
+	current := make(map[string]struct{}, len(addrs))
+	result := make([]*grpc.ClientConn, 0, len(addrs))
+	for _, addr := range addrs {
+		current[addr] = struct{}{}
+		if md := r.table.Metadata(serviceName, addr); md != nil && md.Draining {
+			continue
+		}
+		conn, ok := conns[addr]
+		if !ok {
+			var err error
+			conn, err = grpc.DialContext(ctx, addr, append(append([]grpc.DialOption{}, r.dialOptions...), opts...)...)
+			if err != nil {
+				return nil, errs.WrapMsg(err, "DialContext failed", "addr", addr)
+			}
+			conns[addr] = conn
+		}
+		result = append(result, conn)
+	}
+	for addr, conn := range conns {
+		if _, ok := current[addr]; !ok {
+			_ = conn.Close()
+			delete(conns, addr)
+		}
+	}
+	return result, nil
+}
+
+// GetConn returns a connection that load balances over every address of serviceName.
+func (r *SvcDiscoveryRegistryImpl) GetConn(ctx context.Context, serviceName string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	target := fmt.Sprintf("%s:///%s", scheme, serviceName)
+	r.mu.Lock()
+	dialOptions := append([]grpc.DialOption{}, r.dialOptions...)
+	r.mu.Unlock()
+	return grpc.DialContext(ctx, target, append(append(dialOptions, opts...), grpc.WithResolvers(r.resolver))...)
+}
+
+func (r *SvcDiscoveryRegistryImpl) GetSelfConnTarget() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rpcRegisterAddr
+}
+
+func (r *SvcDiscoveryRegistryImpl) AddOption(opts ...grpc.DialOption) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dialOptions = append(r.dialOptions, opts...)
+}
+
+func (r *SvcDiscoveryRegistryImpl) CloseConn(conn *grpc.ClientConn) {
+	_ = conn.Close()
+}
+
+// Register adds host:port under serviceName. A registry holds a single registration,
+// so registering again replaces the previous one.
+func (r *SvcDiscoveryRegistryImpl) Register(serviceName, host string, port int, opts ...grpc.DialOption) error {
+	return r.RegisterWithMetadata(serviceName, host, port, nil, opts...)
+}
+
+// RegisterWithMetadata is like Register and stores md with the address.
+func (r *SvcDiscoveryRegistryImpl) RegisterWithMetadata(serviceName, host string, port int, md *discovery.Metadata, opts ...grpc.DialOption) error {
+	md = discovery.RegisterMetadata(md)
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rpcRegisterName != "" {
+		r.table.Remove(r.rpcRegisterName, r.rpcRegisterAddr)
+	}
+	r.table.AddWithMetadata(serviceName, addr, md)
+	if err := r.lifecycle.CheckHealth(addr); err != nil {
+		r.table.Remove(serviceName, addr)
+		r.rpcRegisterName = ""
+		r.rpcRegisterAddr = ""
+		return err
+	}
+	r.rpcRegisterName = serviceName
+	r.rpcRegisterAddr = addr
+	return nil
+}
+
+// UnRegister removes the registration, draining it first when WithDrain is set.
+func (r *SvcDiscoveryRegistryImpl) UnRegister() error {
+	r.mu.Lock()
+	serviceName, addr := r.rpcRegisterName, r.rpcRegisterAddr
+	r.mu.Unlock()
+	if serviceName == "" {
+		return errs.New("service not registered").Wrap()
+	}
+	if r.lifecycle.DrainEnabled() {
+		r.table.SetMetadata(serviceName, addr, discovery.DrainingMetadata(r.table.Metadata(serviceName, addr)))
+		r.lifecycle.Drain()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rpcRegisterName != serviceName || r.rpcRegisterAddr != addr {
+		return nil
+	}
+	r.table.Remove(r.rpcRegisterName, r.rpcRegisterAddr)
+	r.rpcRegisterName = ""
+	r.rpcRegisterAddr = ""
+	return nil
+}
+
+// Close unregisters the service if needed and closes every connection returned by GetConns.
+func (r *SvcDiscoveryRegistryImpl) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rpcRegisterName != "" {
+		r.table.Remove(r.rpcRegisterName, r.rpcRegisterAddr)
+		r.rpcRegisterName = ""
+		r.rpcRegisterAddr = ""
+	}
+	for _, conns := range r.connMap {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+	r.connMap = make(map[string]map[string]*grpc.ClientConn)
+}
+
+func (r *SvcDiscoveryRegistryImpl) GetUserIdHashGatewayHost(ctx context.Context, userId string) (string, error) {
+	return r.gateway.GetHost(ctx, userId)
+}
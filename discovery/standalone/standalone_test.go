@@ -0,0 +1,242 @@
+package standalone
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/discovery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+)
+
+func startHealthServer(t *testing.T) (string, int) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	host, port, err := net.SplitHostPort(lis.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return host, p
+}
+
+func TestRegisterAndGetConn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	table := NewTable()
+	host, port := startHealthServer(t)
+
+	server := NewSvcDiscoveryRegistry(WithTable(table))
+	require.NoError(t, server.Register("user", host, port))
+	assert.Equal(t, net.JoinHostPort(host, strconv.Itoa(port)), server.GetSelfConnTarget())
+
+	client := NewSvcDiscoveryRegistry(WithTable(table), WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	defer client.Close()
+	conn, err := client.GetConn(ctx, "user")
+	require.NoError(t, err)
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	conns, err := client.GetConns(ctx, "user")
+	require.NoError(t, err)
+	assert.Len(t, conns, 1)
+
+	require.NoError(t, server.UnRegister())
+	conns, err = client.GetConns(ctx, "user")
+	require.NoError(t, err)
+	assert.Empty(t, conns)
+	assert.Error(t, server.UnRegister())
+}
+
+func TestWatch(t *testing.T) {
+	table := NewTable()
+	r := NewSvcDiscoveryRegistry(WithTable(table))
+	updates := make(chan []string, 16)
+	stop := r.Watch("msg", func(addrs []string) { updates <- addrs })
+	defer stop()
+
+	// Notifications are coalesced, so wait until the expected state shows up.
+	waitFor := func(expected ...string) {
+		for {
+			select {
+			case addrs := <-updates:
+				if len(addrs) == len(expected) && (len(expected) == 0 || assert.ObjectsAreEqual(expected, addrs)) {
+					return
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("watch not notified with %v", expected)
+			}
+		}
+	}
+	waitFor()
+
+	require.NoError(t, r.Register("msg", "127.0.0.1", 10130))
+	waitFor("127.0.0.1:10130")
+
+	require.NoError(t, r.Register("msg", "127.0.0.1", 10131))
+	waitFor("127.0.0.1:10131")
+
+	r.Close()
+	waitFor()
+}
+
+func TestGetUserIdHashGatewayHost(t *testing.T) {
+	ctx := context.Background()
+	table := NewTable()
+	gateways := make([]*SvcDiscoveryRegistryImpl, 3)
+	for i := range gateways {
+		gateways[i] = NewSvcDiscoveryRegistry(WithTable(table))
+		require.NoError(t, gateways[i].Register("messagegateway", "10.0.0."+strconv.Itoa(i+1), 10140))
+	}
+	client := NewSvcDiscoveryRegistry(WithTable(table))
+	host, err := client.GetUserIdHashGatewayHost(ctx, "user1")
+	require.NoError(t, err)
+	again, err := client.GetUserIdHashGatewayHost(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, host, again)
+
+	for _, gateway := range gateways {
+		if gateway.GetSelfConnTarget() != host {
+			require.NoError(t, gateway.UnRegister())
+			break
+		}
+	}
+	again, err = client.GetUserIdHashGatewayHost(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, host, again, "removing another gateway must not move the user")
+}
+
+type stateClientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+}
+
+func (c *stateClientConn) UpdateState(state resolver.State) error {
+	c.states <- state
+	return nil
+}
+
+func (c *stateClientConn) ReportError(error) {
+	c.states <- resolver.State{}
+}
+
+func TestRegisterWithMetadata(t *testing.T) {
+	table := NewTable()
+	stable := NewSvcDiscoveryRegistry(WithTable(table))
+	shared := &discovery.Metadata{Version: "v1", Weight: 50}
+	require.NoError(t, stable.RegisterWithMetadata("user", "10.0.0.1", 10110, shared))
+	assert.Zero(t, shared.StartTime, "the caller's metadata is not modified")
+	canary := NewSvcDiscoveryRegistry(WithTable(table))
+	require.NoError(t, canary.Register("user", "10.0.0.2", 10110))
+
+	md := table.Metadata("user", "10.0.0.1:10110")
+	require.NotNil(t, md)
+	assert.Equal(t, 50, md.GetWeight())
+	assert.NotZero(t, md.StartTime)
+	assert.Equal(t, discovery.DefaultWeight, table.Metadata("user", "10.0.0.2:10110").GetWeight())
+
+	cc := &stateClientConn{states: make(chan resolver.State, 8)}
+	b := &builder{table: table, filter: discovery.VersionFilter("v1")}
+	r, err := b.Build(resolver.Target{URL: url.URL{Scheme: scheme, Path: "/user"}}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	select {
+	case state := <-cc.states:
+		require.Len(t, state.Addresses, 1)
+		assert.Equal(t, "10.0.0.1:10110", state.Addresses[0].Addr)
+		got, ok := discovery.GetAddressMetadata(state.Addresses[0])
+		require.True(t, ok)
+		assert.Equal(t, "v1", got.Version)
+	case <-time.After(5 * time.Second):
+		t.Fatal("resolver did not report a state")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	table := NewTable()
+	host, port := startHealthServer(t)
+	healthy := NewSvcDiscoveryRegistry(WithTable(table), WithHealthCheck(5*time.Second))
+	require.NoError(t, healthy.Register("user", host, port))
+	assert.Len(t, table.Get("user"), 1)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	_, deadPort, _ := net.SplitHostPort(lis.Addr().String())
+	p, _ := strconv.Atoi(deadPort)
+	unhealthy := NewSvcDiscoveryRegistry(WithTable(table), WithHealthCheck(300*time.Millisecond))
+	assert.Error(t, unhealthy.Register("user", "127.0.0.1", p))
+	assert.Len(t, table.Get("user"), 1, "an unhealthy instance must not stay registered")
+	assert.Empty(t, unhealthy.GetSelfConnTarget())
+}
+
+func TestDrain(t *testing.T) {
+	table := NewTable()
+	tracker := discovery.NewInflightTracker()
+	server := NewSvcDiscoveryRegistry(WithTable(table), WithDrain(tracker, 5*time.Second))
+	require.NoError(t, server.Register("user", "10.0.0.1", 10110))
+	client := NewSvcDiscoveryRegistry(WithTable(table), WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	defer client.Close()
+	conns, err := client.GetConns(context.Background(), "user")
+	require.NoError(t, err)
+	assert.Len(t, conns, 1)
+
+	done := tracker.Start()
+	unregistered := make(chan error, 1)
+	go func() { unregistered <- server.UnRegister() }()
+
+	assert.Eventually(t, func() bool {
+		md := table.Metadata("user", "10.0.0.1:10110")
+		return md != nil && md.Draining
+	}, 5*time.Second, 10*time.Millisecond)
+	conns, err = client.GetConns(context.Background(), "user")
+	require.NoError(t, err)
+	assert.Empty(t, conns, "a draining instance is not returned")
+	select {
+	case <-unregistered:
+		t.Fatal("UnRegister returned while an rpc was in flight")
+	default:
+	}
+
+	done()
+	select {
+	case err := <-unregistered:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("UnRegister did not return after the rpc finished")
+	}
+	assert.Empty(t, table.Get("user"))
+}
+
+func TestAddOptionConcurrently(t *testing.T) {
+	r := NewSvcDiscoveryRegistry(WithTable(NewTable()), WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	defer r.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			r.AddOption(grpc.WithUserAgent("test"))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		conn, err := r.GetConn(context.Background(), "user")
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+	}
+	<-done
+}
@@ -0,0 +1,212 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package standalone
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/openimsdk/tools/discovery"
+)
+
+var defaultTable = NewTable()
+
+// DefaultTable returns the process-wide table shared by registries created without WithTable.
+func DefaultTable() *Table {
+	return defaultTable
+}
+
+// Table is an in-process service table. Every registry bound to the same table
+// sees the services registered by the others.
+type Table struct {
+	mu       sync.RWMutex
+	services map[string]map[string]*entry
+	watchers map[string]map[*watcher]struct{}
+}
+
+// NewTable creates an empty service table.
+func NewTable() *Table {
+	return &Table{
+		services: make(map[string]map[string]*entry),
+		watchers: make(map[string]map[*watcher]struct{}),
+	}
+}
+
+type entry struct {
+	refs     int
+	metadata *discovery.Metadata
+}
+
+// Add registers addr under serviceName. The same address may be added several times
+// and stays in the table until it has been removed as many times.
+func (t *Table) Add(serviceName string, addr string) {
+	t.AddWithMetadata(serviceName, addr, nil)
+}
+
+// AddWithMetadata is like Add and also stores md for addr, replacing any earlier metadata.
+func (t *Table) AddWithMetadata(serviceName string, addr string, md *discovery.Metadata) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	addrs, ok := t.services[serviceName]
+	if !ok {
+		addrs = make(map[string]*entry)
+		t.services[serviceName] = addrs
+	}
+	e, ok := addrs[addr]
+	if !ok {
+		e = &entry{}
+		addrs[addr] = e
+	}
+	e.refs++
+	if e.refs == 1 || (md != nil && !md.Equal(e.metadata)) {
+		if md != nil {
+			e.metadata = md
+		}
+		t.notify(serviceName)
+	}
+}
+
+// Remove unregisters addr from serviceName.
+func (t *Table) Remove(serviceName string, addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	addrs, ok := t.services[serviceName]
+	if !ok || addrs[addr] == nil {
+		return
+	}
+	addrs[addr].refs--
+	if addrs[addr].refs > 0 {
+		return
+	}
+	delete(addrs, addr)
+	if len(addrs) == 0 {
+		delete(t.services, serviceName)
+	}
+	t.notify(serviceName)
+}
+
+// Get returns the addresses registered under serviceName in lexical order.
+func (t *Table) Get(serviceName string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.get(serviceName)
+}
+
+// SetMetadata replaces the metadata of an address already in the table.
+func (t *Table) SetMetadata(serviceName string, addr string, md *discovery.Metadata) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.services[serviceName][addr]
+	if !ok || md.Equal(e.metadata) {
+		return
+	}
+	e.metadata = md
+	t.notify(serviceName)
+}
+
+// Metadata returns the metadata stored for addr, or nil if it was added without any.
+func (t *Table) Metadata(serviceName string, addr string) *discovery.Metadata {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if e, ok := t.services[serviceName][addr]; ok {
+		return e.metadata
+	}
+	return nil
+}
+
+// Services returns the names of all services that have at least one address.
+func (t *Table) Services() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.services))
+	for name := range t.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Watch calls fn with the current addresses of serviceName and again after every change.
+// Calls are made from a dedicated goroutine and are coalesced, so fn always sees the latest state.
+// The returned function stops the watch.
+func (t *Table) Watch(serviceName string, fn func(addrs []string)) (cancel func()) {
+	w := &watcher{
+		fn:     fn,
+		change: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	t.mu.Lock()
+	ws, ok := t.watchers[serviceName]
+	if !ok {
+		ws = make(map[*watcher]struct{})
+		t.watchers[serviceName] = ws
+	}
+	ws[w] = struct{}{}
+	t.mu.Unlock()
+	w.signal()
+	go w.run(func() []string { return t.Get(serviceName) })
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.watchers[serviceName], w)
+			if len(t.watchers[serviceName]) == 0 {
+				delete(t.watchers, serviceName)
+			}
+			t.mu.Unlock()
+			close(w.done)
+		})
+	}
+}
+
+func (t *Table) get(serviceName string) []string {
+	addrs := make([]string, 0, len(t.services[serviceName]))
+	for addr := range t.services[serviceName] {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+func (t *Table) notify(serviceName string) {
+	for w := range t.watchers[serviceName] {
+		w.signal()
+	}
+}
+
+type watcher struct {
+	fn     func(addrs []string)
+	change chan struct{}
+	done   chan struct{}
+}
+
+func (w *watcher) signal() {
+	select {
+	case w.change <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) run(snapshot func() []string) {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.change:
+			w.fn(snapshot())
+		}
+	}
+}
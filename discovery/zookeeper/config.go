@@ -15,12 +15,17 @@
 package zookeeper
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/go-zookeeper/zk"
+	"github.com/openimsdk/tools/config"
 	"github.com/openimsdk/tools/errs"
 )
 
+var _ config.WatchableSource = (*ConfigSource)(nil)
+
 type Config struct {
 	ZkServers []string
 	Scheme    string
@@ -37,10 +42,12 @@ func (s *ZkClient) RegisterConf2Registry(key string, conf []byte) error {
 		return errs.WrapMsg(err, "Exists failed", "path", path)
 	}
 
+	// Updating in place fires a data watch, so config watchers reload instead of seeing the node vanish.
 	if exists {
-		if err := s.conn.Delete(path, 0); err != nil {
-			return errs.WrapMsg(err, "Delete failed", "path", path)
+		if _, err := s.conn.Set(path, conf, -1); err != nil {
+			return errs.WrapMsg(err, "Set failed", "path", path)
 		}
+		return nil
 	}
 	_, err = s.conn.Create(path, conf, 0, zk.WorldACL(zk.PermAll))
 	if err != nil && err != zk.ErrNodeExists {
@@ -57,3 +64,51 @@ func (s *ZkClient) GetConfFromRegistry(key string) ([]byte, error) {
 	}
 	return bytes, nil
 }
+
+// ConfigSource reads and watches a configuration document stored in a zookeeper node.
+type ConfigSource struct {
+	client *ZkClient
+	key    string
+}
+
+// ConfigSource returns a config.WatchableSource for the node written by RegisterConf2Registry(key, ...).
+func (s *ZkClient) ConfigSource(key string) *ConfigSource {
+	return &ConfigSource{client: s, key: key}
+}
+
+func (c *ConfigSource) Read() ([]byte, error) {
+	return c.client.GetConfFromRegistry(c.key)
+}
+
+// Watch calls onChange with the current document and after every change of the node.
+// Deleting the node is not reported, the last document stays in effect.
+func (c *ConfigSource) Watch(ctx context.Context, onChange func(data []byte)) error {
+	path := c.client.getPath(c.key)
+	for {
+		data, _, ch, err := c.client.conn.GetW(path)
+		if errors.Is(err, zk.ErrNoNode) {
+			var exists bool
+			exists, _, ch, err = c.client.conn.ExistsW(path)
+			if err == nil && exists {
+				continue
+			}
+		} else if err == nil {
+			onChange(data)
+		}
+		if err != nil {
+			c.client.logger.Warn(ctx, "watch config node failed", err, "path", path)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		// The watch also fires with EventNotWatching when the session is lost, which re-arms it.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+	}
+}
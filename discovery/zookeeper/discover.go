@@ -16,10 +16,13 @@ package zookeeper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/go-zookeeper/zk"
+	"github.com/openimsdk/tools/discovery"
+	"github.com/openimsdk/tools/discovery/balancer"
 	"github.com/openimsdk/tools/errs"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/resolver"
@@ -31,6 +34,7 @@ var (
 )
 
 func (s *ZkClient) watch(ctx context.Context) {
+	defer s.wg.Done()
 	for {
 		select {
 		case <-ctx.Done():
@@ -41,15 +45,15 @@ func (s *ZkClient) watch(ctx context.Context) {
 			switch event.Type {
 			case zk.EventSession:
 				switch event.State {
+				case zk.StateExpired:
+					// Ephemeral nodes and watches died with the session, they are restored
+					// once the client has established a new one.
+					s.logger.Warn(ctx, "zk session expired", nil, "event", event)
+					s.sessionExpired = true
 				case zk.StateHasSession:
-					if s.isRegistered && !s.isStateDisconnected {
-						s.logger.Debug(ctx, "zk session event stateHasSession, client prepare to create new temp node", "event", event)
-						node, err := s.CreateTempNode(s.rpcRegisterName, s.rpcRegisterAddr)
-						if err != nil {
-							s.logger.Error(ctx, "zk session event stateHasSession, create temp node error", err, "event", event)
-						} else {
-							s.node = node
-						}
+					if s.sessionExpired {
+						s.sessionExpired = false
+						s.recoverSession(ctx)
 					}
 				case zk.StateDisconnected:
 					s.isStateDisconnected = true
@@ -78,6 +82,27 @@ func (s *ZkClient) watch(ctx context.Context) {
 	}
 }
 
+// recoverSession restores what an expired session lost: the registered node is created
+// again, and every resolver reads its service again, which re-arms the child watches.
+// Cached connections are closed and dropped so GetConns reads and watches the services again too.
+func (s *ZkClient) recoverSession(ctx context.Context) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.isRegistered {
+		node, err := s.CreateTempNode(s.rpcRegisterName, s.rpcRegisterAddr)
+		if err != nil {
+			s.logger.Error(ctx, "zk session recovery, create temp node error", err, "serviceName", s.rpcRegisterName)
+		} else {
+			s.node = node
+		}
+	}
+	for serviceName := range s.resolvers {
+		s.flushResolver(serviceName)
+	}
+	s.closeLocalConns()
+	s.logger.Info(ctx, "zk session recovered", "node", s.node, "resolvers", len(s.resolvers))
+}
+
 func (s *ZkClient) GetConnsRemote(ctx context.Context, serviceName string) (conns []resolver.Address, err error) {
 	err = s.ensureName(serviceName)
 	if err != nil {
@@ -100,15 +125,50 @@ func (s *ZkClient) GetConnsRemote(ctx context.Context, serviceName string) (conn
 				return nil, errs.WrapMsg(err, "get children error", "fullPath", fullPath)
 			}
 			s.logger.Debug(ctx, "get addr from remote", "conn", string(data))
-			conns = append(conns, resolver.Address{Addr: string(data), ServerName: serviceName})
+			nd, err := parseNodeData(data)
+			if err != nil {
+				return nil, err
+			}
+			conns = append(conns, discovery.SetAddressMetadata(resolver.Address{Addr: nd.Addr, ServerName: serviceName}, nd.Metadata))
 		}
 	}
-	return conns, nil
+	return discovery.FilterAddresses(conns, s.filter), nil
 }
 
 func (s *ZkClient) GetUserIdHashGatewayHost(ctx context.Context, userId string) (string, error) {
-	s.logger.Warn(ctx, "not implement", errs.New("zkclinet not implement GetUserIdHashGatewayHost method"))
-	return "", nil
+	return s.gateway.GetHost(ctx, userId)
+}
+
+// getServiceAddrs reads the registered addresses of a service without arming a watch.
+func (s *ZkClient) getServiceAddrs(ctx context.Context, serviceName string) ([]string, error) {
+	path := s.getPath(serviceName)
+	childNodes, _, err := s.conn.Children(path)
+	if err != nil {
+		if errors.Is(err, zk.ErrNoNode) {
+			return nil, nil
+		}
+		return nil, errs.WrapMsg(err, "get children error", "path", path)
+	}
+	addrs := make([]string, 0, len(childNodes))
+	for _, child := range childNodes {
+		fullPath := path + "/" + child
+		data, _, err := s.conn.Get(fullPath)
+		if err != nil {
+			if errors.Is(err, zk.ErrNoNode) {
+				continue
+			}
+			return nil, errs.WrapMsg(err, "get children error", "fullPath", fullPath)
+		}
+		nd, err := parseNodeData(data)
+		if err != nil {
+			return nil, err
+		}
+		if nd.Metadata != nil && nd.Metadata.Draining {
+			continue
+		}
+		addrs = append(addrs, nd.Addr)
+	}
+	return addrs, nil
 }
 
 func (s *ZkClient) GetConns(ctx context.Context, serviceName string, opts ...grpc.DialOption) ([]*grpc.ClientConn, error) {
@@ -140,7 +200,10 @@ func (s *ZkClient) GetConns(ctx context.Context, serviceName string, opts ...grp
 }
 
 func (s *ZkClient) GetConn(ctx context.Context, serviceName string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
-	newOpts := append(s.options, grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"LoadBalancingPolicy": "%s"}`, s.balancerName)))
+	newOpts := append([]grpc.DialOption{}, s.options...)
+	if s.balancerName != "" {
+		newOpts = append(newOpts, balancer.WithPolicy(s.balancerName))
+	}
 	s.logger.Debug(context.Background(), "get conn from client", "serviceName", serviceName)
 	return grpc.DialContext(ctx, fmt.Sprintf("%s:///%s", s.scheme, serviceName), append(newOpts, opts...)...)
 }
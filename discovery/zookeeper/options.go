@@ -17,6 +17,8 @@ package zookeeper
 import (
 	"time"
 
+	"github.com/openimsdk/tools/discovery"
+	"github.com/openimsdk/tools/discovery/balancer"
 	"github.com/openimsdk/tools/log"
 	"google.golang.org/grpc"
 )
@@ -24,8 +26,13 @@ import (
 type ZkOption func(*ZkClient)
 
 func WithRoundRobin() ZkOption {
+	return WithBalancer(balancer.RoundRobin)
+}
+
+// WithBalancer sets the load balancing policy used by GetConn, e.g. one registered by the balancer package.
+func WithBalancer(name string) ZkOption {
 	return func(client *ZkClient) {
-		client.balancerName = "round_robin"
+		client.balancerName = name
 	}
 }
 
@@ -59,3 +66,34 @@ func WithLogger(logger log.Logger) ZkOption {
 		client.logger = logger
 	}
 }
+
+func WithGatewayServiceName(serviceName string) ZkOption {
+	return func(client *ZkClient) {
+		client.gatewayName = serviceName
+	}
+}
+
+// WithMetadataFilter makes resolvers only return instances whose metadata is accepted by filter.
+func WithMetadataFilter(filter discovery.MetadataFilter) ZkOption {
+	return func(client *ZkClient) {
+		client.filter = filter
+	}
+}
+
+// WithHealthCheck makes Register run the grpc.health.v1 check against the registered address,
+// removing the node again if it does not report SERVING within timeout.
+func WithHealthCheck(timeout time.Duration, opts ...grpc.DialOption) ZkOption {
+	return func(client *ZkClient) {
+		client.lifecycle.HealthCheckTimeout = timeout
+		client.lifecycle.HealthCheckDialOptions = opts
+	}
+}
+
+// WithDrain makes UnRegister mark the instance draining and wait for the RPCs counted by tracker,
+// at most timeout, before deleting the node.
+func WithDrain(tracker *discovery.InflightTracker, timeout time.Duration) ZkOption {
+	return func(client *ZkClient) {
+		client.lifecycle.Tracker = tracker
+		client.lifecycle.DrainTimeout = timeout
+	}
+}
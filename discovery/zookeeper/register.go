@@ -15,9 +15,12 @@
 package zookeeper
 
 import (
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/go-zookeeper/zk"
+	"github.com/openimsdk/tools/discovery"
 	"github.com/openimsdk/tools/errs"
 	"google.golang.org/grpc"
 )
@@ -31,10 +34,32 @@ func (s *ZkClient) CreateRpcRootNodes(serviceNames []string) error {
 	return nil
 }
 
+// nodeData is the JSON stored in a service node. Nodes written by older clients hold
+// the bare address instead, parseNodeData accepts both.
+type nodeData struct {
+	Addr     string              `json:"addr"`
+	Metadata *discovery.Metadata `json:"metadata,omitempty"`
+}
+
+func parseNodeData(data []byte) (nodeData, error) {
+	if len(data) == 0 || data[0] != '{' {
+		return nodeData{Addr: string(data)}, nil
+	}
+	var nd nodeData
+	if err := json.Unmarshal(data, &nd); err != nil {
+		return nodeData{}, errs.WrapMsg(err, "unmarshal node data failed", "data", string(data))
+	}
+	return nd, nil
+}
+
 func (s *ZkClient) CreateTempNode(rpcRegisterName, addr string) (node string, err error) {
+	data, err := json.Marshal(nodeData{Addr: addr, Metadata: s.rpcRegisterMetadata})
+	if err != nil {
+		return "", errs.WrapMsg(err, "marshal node data failed", "addr", addr)
+	}
 	node, err = s.conn.CreateProtectedEphemeralSequential(
 		s.getPath(rpcRegisterName)+"/"+addr+"_",
-		[]byte(addr),
+		data,
 		zk.WorldACL(zk.PermAll),
 	)
 	if err != nil {
@@ -44,6 +69,12 @@ func (s *ZkClient) CreateTempNode(rpcRegisterName, addr string) (node string, er
 }
 
 func (s *ZkClient) Register(rpcRegisterName, host string, port int, opts ...grpc.DialOption) error {
+	return s.RegisterWithMetadata(rpcRegisterName, host, port, nil, opts...)
+}
+
+// RegisterWithMetadata registers the service and stores md in the node data.
+func (s *ZkClient) RegisterWithMetadata(rpcRegisterName, host string, port int, md *discovery.Metadata, opts ...grpc.DialOption) error {
+	md = discovery.RegisterMetadata(md)
 	if err := s.ensureName(rpcRegisterName); err != nil {
 		return err
 	}
@@ -52,30 +83,76 @@ func (s *ZkClient) Register(rpcRegisterName, host string, port int, opts ...grpc
 	if err != nil {
 		return errs.WrapMsg(err, "grpc dial error", "addr", addr)
 	}
+	s.lock.Lock()
+	s.rpcRegisterMetadata = md
 	node, err := s.CreateTempNode(rpcRegisterName, addr)
 	if err != nil {
+		s.rpcRegisterMetadata = nil
+		s.lock.Unlock()
 		return err
 	}
 	s.rpcRegisterName = rpcRegisterName
 	s.rpcRegisterAddr = addr
 	s.node = node
 	s.isRegistered = true
+	s.lock.Unlock()
+	// The lock is not held while checking, so session events are still handled.
+	if err := s.lifecycle.CheckHealth(addr); err != nil {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		_ = s.conn.Delete(s.node, -1)
+		s.node = ""
+		s.rpcRegisterName = ""
+		s.rpcRegisterAddr = ""
+		s.rpcRegisterMetadata = nil
+		s.isRegistered = false
+		return err
+	}
+	return nil
+}
+
+// markDraining replaces the registered node with one whose metadata is marked draining.
+// Clients only watch the children of a service, so the node is recreated rather than updated.
+func (s *ZkClient) markDraining() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.isRegistered {
+		return errs.New("service not registered").Wrap()
+	}
+	s.rpcRegisterMetadata = discovery.DrainingMetadata(s.rpcRegisterMetadata)
+	node, err := s.CreateTempNode(s.rpcRegisterName, s.rpcRegisterAddr)
+	if err != nil {
+		return err
+	}
+	if err := s.conn.Delete(s.node, -1); err != nil && !errors.Is(err, zk.ErrNoNode) {
+		return errs.WrapMsg(err, "delete node error", "node", s.node)
+	}
+	s.node = node
 	return nil
 }
 
 func (s *ZkClient) UnRegister() error {
+	if s.lifecycle.DrainEnabled() {
+		if err := s.markDraining(); err != nil {
+			return err
+		}
+		s.lifecycle.Drain()
+	}
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	err := s.conn.Delete(s.node, -1)
 	if err != nil {
 		return errs.WrapMsg(err, "delete node error", "node", s.node)
 	}
-	time.Sleep(time.Second)
+	if !s.lifecycle.DrainEnabled() {
+		time.Sleep(time.Second)
+	}
 	s.node = ""
 	s.rpcRegisterName = ""
 	s.rpcRegisterAddr = ""
+	s.rpcRegisterMetadata = nil
 	s.isRegistered = false
-	s.localConns = make(map[string][]*grpc.ClientConn)
+	s.closeLocalConns()
 	s.resolvers = make(map[string]*Resolver)
 	return nil
 }
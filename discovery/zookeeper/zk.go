@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/go-zookeeper/zk"
+	"github.com/openimsdk/tools/discovery"
 	"github.com/openimsdk/tools/errs"
 	"github.com/openimsdk/tools/log"
 	"google.golang.org/grpc"
@@ -42,7 +43,11 @@ type ZkClient struct {
 	rpcRegisterName string
 	rpcRegisterAddr string
 	isRegistered    bool
-	scheme          string
+
+	rpcRegisterMetadata *discovery.Metadata
+	filter              discovery.MetadataFilter
+	lifecycle           discovery.Lifecycle
+	scheme              string
 
 	timeout   int
 	conn      *zk.Conn
@@ -57,8 +62,13 @@ type ZkClient struct {
 	localConns          map[string][]*grpc.ClientConn
 	cancel              context.CancelFunc
 	isStateDisconnected bool
+	sessionExpired      bool
+	wg                  sync.WaitGroup
 	balancerName        string
 
+	gatewayName string
+	gateway     *discovery.GatewayHashRouter
+
 	logger log.Logger
 }
 
@@ -86,7 +96,9 @@ func NewZkClient(ZkServers []string, scheme string, options ...ZkOption) (*ZkCli
 
 	ctx, cancel := context.WithCancel(context.Background())
 	client.cancel = cancel
-	client.ticker = time.NewTicker(defaultFreq)
+	if client.ticker == nil {
+		client.ticker = time.NewTicker(defaultFreq)
+	}
 
 	// Ensure authentication is set if credentials are provided.
 	if client.username != "" && client.password != "" {
@@ -107,17 +119,22 @@ func NewZkClient(ZkServers []string, scheme string, options ...ZkOption) (*ZkCli
 		return nil, err
 	}
 
+	client.gateway = discovery.NewGatewayHashRouter(client.gatewayName, client.getServiceAddrs)
+
 	resolver.Register(client)
+	client.wg.Add(2)
 	go client.refresh(ctx)
 	go client.watch(ctx)
 
 	return client, nil
 }
 
+// Close stops the background goroutines and closes the zookeeper connection.
 func (s *ZkClient) Close() {
 	s.logger.Info(context.Background(), "close zk called")
 	s.cancel()
 	s.ticker.Stop()
+	s.wg.Wait()
 	s.conn.Close()
 }
 
@@ -136,7 +153,13 @@ func (s *ZkClient) ensureAndCreate(node string) error {
 }
 
 func (s *ZkClient) refresh(ctx context.Context) {
-	for range s.ticker.C {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.ticker.C:
+		}
 		s.logger.Debug(ctx, "zk refresh local conns")
 		s.lock.Lock()
 		for rpcName := range s.resolvers {
@@ -156,6 +179,16 @@ func (s *ZkClient) flushResolverAndDeleteLocal(serviceName string) {
 	delete(s.localConns, serviceName)
 }
 
+// closeLocalConns closes and drops the connections cached by GetConns. The caller holds s.lock.
+func (s *ZkClient) closeLocalConns() {
+	for serviceName, conns := range s.localConns {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+		delete(s.localConns, serviceName)
+	}
+}
+
 func (s *ZkClient) flushResolver(serviceName string) {
 	r, ok := s.resolvers[serviceName]
 	if ok {
@@ -167,6 +200,11 @@ func (s *ZkClient) GetZkConn() *zk.Conn {
 	return s.conn
 }
 
+// GetLogger returns the logger set by WithLogger.
+func (s *ZkClient) GetLogger() log.Logger {
+	return s.logger
+}
+
 func (s *ZkClient) GetRootPath() string {
 	return s.zkRoot
 }
@@ -0,0 +1,108 @@
+package zookeeper
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/discovery/internal/zktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+)
+
+type stateClientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+}
+
+func (c *stateClientConn) UpdateState(state resolver.State) error {
+	c.states <- state
+	return nil
+}
+
+func (c *stateClientConn) ReportError(error) {}
+
+func newTestClient(t *testing.T, server *zktest.Server) *ZkClient {
+	client, err := NewZkClient([]string{server.Addr()}, "openim", WithTimeout(2))
+	require.NoError(t, err)
+	return client
+}
+
+// waitAddrs reads states until one resolves exactly want.
+func waitAddrs(t *testing.T, states <-chan resolver.State, want ...string) {
+	t.Helper()
+	sort.Strings(want)
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case state := <-states:
+			var addrs []string
+			for _, addr := range state.Addresses {
+				addrs = append(addrs, addr.Addr)
+			}
+			sort.Strings(addrs)
+			if assert.ObjectsAreEqual(want, addrs) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("resolver did not resolve %v", want)
+		}
+	}
+}
+
+func TestSessionExpiredRecovery(t *testing.T) {
+	server, err := zktest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+	insecureOpt := grpc.WithTransportCredentials(insecure.NewCredentials())
+
+	client := newTestClient(t, server)
+	require.NoError(t, client.Register("user", "127.0.0.1", 10001, insecureOpt))
+	cc := &stateClientConn{states: make(chan resolver.State, 16)}
+	_, err = client.Build(resolver.Target{URL: url.URL{Scheme: "openim", Path: "/user"}}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	waitAddrs(t, cc.states, "127.0.0.1:10001")
+
+	conns, err := client.GetConns(context.Background(), "user", insecureOpt)
+	require.NoError(t, err)
+	require.Len(t, conns, 1)
+
+	node := client.GetNode()
+	require.True(t, server.ExpireSession(client.GetZkConn().SessionID()))
+
+	// The registered node is created again in the new session.
+	assert.Eventually(t, func() bool {
+		return len(server.Children("/openim/user")) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	waitAddrs(t, cc.states, "127.0.0.1:10001")
+	client.lock.Lock()
+	assert.NotEqual(t, node, client.node)
+	assert.Empty(t, client.localConns)
+	client.lock.Unlock()
+	assert.Equal(t, connectivity.Shutdown, conns[0].GetState(), "dropped connections are closed")
+
+	// The child watch is armed again: another instance shows up in the resolver.
+	other := newTestClient(t, server)
+	require.NoError(t, other.Register("user", "127.0.0.1", 10002, insecureOpt))
+	waitAddrs(t, cc.states, "127.0.0.1:10001", "127.0.0.1:10002")
+	other.Close()
+	waitAddrs(t, cc.states, "127.0.0.1:10001")
+
+	closed := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	assert.Empty(t, server.Children("/openim/user"))
+}
@@ -334,7 +334,7 @@ func TestGHIssue16(t *testing.T) {
 
 	rl, err := rotatelogs.New(
 		filepath.Join(dir, "log%Y%m%d%H%M%S"),
-		rotatelogs.WithLinkName("./test.log"),
+		rotatelogs.WithLinkName(filepath.Join(dir, "test.log")),
 		rotatelogs.WithRotationTime(10*time.Second),
 		rotatelogs.WithRotationCount(3),
 		rotatelogs.WithMaxAge(-1),
@@ -10,6 +10,22 @@ import (
 	"go.uber.org/zap"
 )
 
+// logDir receives the log files written by the tests instead of ./logs of the source tree.
+var logDir string
+
+func TestMain(m *testing.M) {
+	var err error
+	if logDir, err = os.MkdirTemp("", "log-test"); err != nil {
+		panic(err)
+	}
+	if err := InitLoggerFromConfig("DefaultLogger", "DefaultLoggerModule", "", "", LevelDebug, true, false, logDir, rotateCount, hoursPerDay, version, isSimplify); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = os.RemoveAll(logDir)
+	os.Exit(code)
+}
+
 // TestSDKLog tests the SDKLog function for proper log output including custom [file:line] information
 func TestSDKLog(t *testing.T) {
 	sdkType := "TestSDK"
@@ -23,8 +39,7 @@ func TestSDKLog(t *testing.T) {
 		5,            // logLevel (Debug)
 		true,         // isStdout
 		false,        // isJson
-		// "./logs",     // logLocation
-		".",     // logLocation
+		logDir,  // logLocation
 		5,       // rotateCount
 		24,      // rotationTime
 		"1.0.0", // moduleVersion
@@ -80,7 +95,7 @@ func TestDefaultLog(t *testing.T) {
 		int(5),            // logLevel (Debug)
 		true,         // isStdout
 		false,        // isJson
-		"./logs",     // logLocation
+		logDir,       // logLocation
 		uint(5),       // rotateCount
 		uint(24),      // rotationTime
 		"1.0.0", // moduleVersion
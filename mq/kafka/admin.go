@@ -0,0 +1,230 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/IBM/sarama"
+	"github.com/openimsdk/tools/errs"
+)
+
+// TopicSpec describes a topic managed by EnsureTopics.
+type TopicSpec struct {
+	Name              string
+	Partitions        int32
+	ReplicationFactor int16
+	// Config holds topic level settings such as retention.ms, applied when the topic is created.
+	Config map[string]string
+}
+
+// TopicInfo describes an existing topic.
+type TopicInfo struct {
+	Name       string
+	Partitions []PartitionInfo
+}
+
+// PartitionInfo describes one partition of a topic.
+type PartitionInfo struct {
+	ID       int32
+	Leader   int32
+	Replicas []int32
+	ISR      []int32
+}
+
+// PartitionLag is the lag of a consumer group on one partition.
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	Committed int64 // -1 when the group did not commit an offset
+	End       int64
+	// Lag counts from the oldest retained offset when the group did not commit an offset.
+	Lag int64
+}
+
+// Admin manages topics and inspects consumer groups.
+type Admin struct {
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+}
+
+// NewAdmin connects to the cluster with the same SASL and TLS settings as producers and consumers.
+func NewAdmin(conf *Config) (*Admin, error) {
+	kfk, err := BuildAdminConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(conf.Addr, kfk)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "NewClient failed", "addr", conf.Addr)
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, errs.WrapMsg(err, "NewClusterAdminFromClient failed", "addr", conf.Addr)
+	}
+	return &Admin{client: client, admin: admin}, nil
+}
+
+// EnsureTopics creates the missing topics and adds partitions to topics that have fewer
+// partitions than specified. Existing topics are never shrunk or reconfigured.
+func (a *Admin) EnsureTopics(ctx context.Context, specs ...TopicSpec) error {
+	names := make([]string, len(specs))
+	for i, spec := range specs {
+		names[i] = spec.Name
+	}
+	metadata, err := a.admin.DescribeTopics(names)
+	if err != nil {
+		return errs.WrapMsg(err, "DescribeTopics failed", "topics", names)
+	}
+	existing := make(map[string]int32, len(metadata))
+	for _, topic := range metadata {
+		if errors.Is(topic.Err, sarama.ErrNoError) {
+			existing[topic.Name] = int32(len(topic.Partitions))
+		}
+	}
+	for _, spec := range specs {
+		partitions, ok := existing[spec.Name]
+		if !ok {
+			if err := a.createTopic(spec); err != nil {
+				return err
+			}
+			continue
+		}
+		if partitions < spec.Partitions {
+			if err := a.admin.CreatePartitions(spec.Name, spec.Partitions, nil, false); err != nil {
+				return errs.WrapMsg(err, "CreatePartitions failed", "topic", spec.Name, "partitions", spec.Partitions)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Admin) createTopic(spec TopicSpec) error {
+	detail := &sarama.TopicDetail{
+		NumPartitions:     spec.Partitions,
+		ReplicationFactor: spec.ReplicationFactor,
+		ConfigEntries:     make(map[string]*string, len(spec.Config)),
+	}
+	for key, value := range spec.Config {
+		value := value
+		detail.ConfigEntries[key] = &value
+	}
+	err := a.admin.CreateTopic(spec.Name, detail, false)
+	if err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		return errs.WrapMsg(err, "CreateTopic failed", "topic", spec.Name, "partitions", spec.Partitions, "replicationFactor", spec.ReplicationFactor)
+	}
+	return nil
+}
+
+// DescribeTopics returns the partitions of topics, sorted by partition ID.
+func (a *Admin) DescribeTopics(ctx context.Context, topics ...string) ([]*TopicInfo, error) {
+	metadata, err := a.admin.DescribeTopics(topics)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "DescribeTopics failed", "topics", topics)
+	}
+	res := make([]*TopicInfo, 0, len(metadata))
+	for _, topic := range metadata {
+		if !errors.Is(topic.Err, sarama.ErrNoError) {
+			return nil, errs.WrapMsg(topic.Err, "describe topic failed", "topic", topic.Name)
+		}
+		info := &TopicInfo{Name: topic.Name, Partitions: make([]PartitionInfo, 0, len(topic.Partitions))}
+		for _, partition := range topic.Partitions {
+			info.Partitions = append(info.Partitions, PartitionInfo{
+				ID:       partition.ID,
+				Leader:   partition.Leader,
+				Replicas: partition.Replicas,
+				ISR:      partition.Isr,
+			})
+		}
+		sort.Slice(info.Partitions, func(i, j int) bool { return info.Partitions[i].ID < info.Partitions[j].ID })
+		res = append(res, info)
+	}
+	return res, nil
+}
+
+// AlterPartitions grows topic to count partitions. Kafka cannot remove partitions, so a
+// smaller count fails and an equal count does nothing.
+func (a *Admin) AlterPartitions(ctx context.Context, topic string, count int32) error {
+	infos, err := a.DescribeTopics(ctx, topic)
+	if err != nil {
+		return err
+	}
+	current := int32(len(infos[0].Partitions))
+	if current == count {
+		return nil
+	}
+	if current > count {
+		return errs.ErrArgs.WrapMsg(fmt.Sprintf("topic has %d partitions, partitions cannot be removed", current), "topic", topic, "count", count)
+	}
+	if err := a.admin.CreatePartitions(topic, count, nil, false); err != nil {
+		return errs.WrapMsg(err, "CreatePartitions failed", "topic", topic, "count", count)
+	}
+	return nil
+}
+
+// ConsumerGroupLag returns the lag of groupID on every partition of topics, sorted by topic and partition.
+func (a *Admin) ConsumerGroupLag(ctx context.Context, groupID string, topics ...string) ([]PartitionLag, error) {
+	infos, err := a.DescribeTopics(ctx, topics...)
+	if err != nil {
+		return nil, err
+	}
+	topicPartitions := make(map[string][]int32, len(infos))
+	for _, info := range infos {
+		for _, partition := range info.Partitions {
+			topicPartitions[info.Name] = append(topicPartitions[info.Name], partition.ID)
+		}
+	}
+	offsets, err := a.admin.ListConsumerGroupOffsets(groupID, topicPartitions)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "ListConsumerGroupOffsets failed", "groupID", groupID)
+	}
+	var res []PartitionLag
+	for _, info := range infos {
+		for _, partition := range info.Partitions {
+			end, err := a.client.GetOffset(info.Name, partition.ID, sarama.OffsetNewest)
+			if err != nil {
+				return nil, errs.WrapMsg(err, "GetOffset failed", "topic", info.Name, "partition", partition.ID)
+			}
+			lag := PartitionLag{Topic: info.Name, Partition: partition.ID, Committed: -1, End: end}
+			if block := offsets.GetBlock(info.Name, partition.ID); block != nil && errors.Is(block.Err, sarama.ErrNoError) && block.Offset >= 0 {
+				lag.Committed = block.Offset
+				lag.Lag = end - block.Offset
+			} else {
+				oldest, err := a.client.GetOffset(info.Name, partition.ID, sarama.OffsetOldest)
+				if err != nil {
+					return nil, errs.WrapMsg(err, "GetOffset failed", "topic", info.Name, "partition", partition.ID)
+				}
+				lag.Lag = end - oldest
+			}
+			res = append(res, lag)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Topic != res[j].Topic {
+			return res[i].Topic < res[j].Topic
+		}
+		return res[i].Partition < res[j].Partition
+	})
+	return res, nil
+}
+
+// Close releases the connections of the admin.
+func (a *Admin) Close() error {
+	return a.admin.Close()
+}
@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAdmin(t *testing.T) (*sarama.MockBroker, *Admin) {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()).
+			SetLeader("events", 1, broker.BrokerID()),
+		"CreateTopicsRequest":     sarama.NewMockCreateTopicsResponse(t),
+		"CreatePartitionsRequest": sarama.NewMockCreatePartitionsResponse(t),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("group", "events", 0, 40, "", sarama.ErrNoError).
+			SetOffset("group", "events", 1, -1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("events", 0, sarama.OffsetNewest, 100).
+			SetOffset("events", 1, sarama.OffsetNewest, 30).
+			SetOffset("events", 1, sarama.OffsetOldest, 10),
+	})
+	admin, err := NewAdmin(&Config{Addr: []string{broker.Addr()}})
+	assert.NoError(t, err)
+	return broker, admin
+}
+
+func requestCount(broker *sarama.MockBroker, match func(body any) bool) int {
+	var n int
+	for _, pair := range broker.History() {
+		if match(pair.Request) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestAdminEnsureTopics(t *testing.T) {
+	broker, admin := newMockAdmin(t)
+	defer broker.Close()
+	defer admin.Close()
+	ctx := context.Background()
+
+	err := admin.EnsureTopics(ctx,
+		TopicSpec{Name: "events", Partitions: 4, ReplicationFactor: 1},
+		TopicSpec{Name: "created", Partitions: 2, ReplicationFactor: 1, Config: map[string]string{"retention.ms": "1000"}},
+	)
+	assert.NoError(t, err)
+	var created map[string]*sarama.TopicDetail
+	for _, pair := range broker.History() {
+		if req, ok := pair.Request.(*sarama.CreateTopicsRequest); ok {
+			created = req.TopicDetails
+		}
+	}
+	assert.Contains(t, created, "created")
+	assert.NotContains(t, created, "events")
+	assert.Equal(t, "1000", *created["created"].ConfigEntries["retention.ms"])
+	assert.Equal(t, 1, requestCount(broker, func(body any) bool {
+		req, ok := body.(*sarama.CreatePartitionsRequest)
+		return ok && req.TopicPartitions["events"].Count == 4
+	}))
+
+	infos, err := admin.DescribeTopics(ctx, "events")
+	assert.NoError(t, err)
+	assert.Len(t, infos, 1)
+	assert.Equal(t, []int32{0, 1}, []int32{infos[0].Partitions[0].ID, infos[0].Partitions[1].ID})
+
+	_, err = admin.DescribeTopics(ctx, "missing")
+	assert.Error(t, err)
+}
+
+func TestAdminAlterPartitions(t *testing.T) {
+	broker, admin := newMockAdmin(t)
+	defer broker.Close()
+	defer admin.Close()
+	ctx := context.Background()
+	isCreatePartitions := func(body any) bool {
+		_, ok := body.(*sarama.CreatePartitionsRequest)
+		return ok
+	}
+
+	assert.NoError(t, admin.AlterPartitions(ctx, "events", 2))
+	assert.Zero(t, requestCount(broker, isCreatePartitions))
+	assert.Error(t, admin.AlterPartitions(ctx, "events", 1))
+	assert.NoError(t, admin.AlterPartitions(ctx, "events", 8))
+	assert.Equal(t, 1, requestCount(broker, isCreatePartitions))
+}
+
+func TestAdminConsumerGroupLag(t *testing.T) {
+	broker, admin := newMockAdmin(t)
+	defer broker.Close()
+	defer admin.Close()
+
+	lags, err := admin.ConsumerGroupLag(context.Background(), "group", "events")
+	assert.NoError(t, err)
+	assert.Equal(t, []PartitionLag{
+		{Topic: "events", Partition: 0, Committed: 40, End: 100, Lag: 60},
+		{Topic: "events", Partition: 1, Committed: -1, End: 30, Lag: 20},
+	}, lags)
+}
@@ -0,0 +1,210 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/openimsdk/tools/errs"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrProducerClosed is returned when sending through a closed AsyncProducer.
+var ErrProducerClosed = errors.New("kafka producer closed")
+
+// SendCallback receives the result of an asynchronous send. It runs on the goroutine
+// that collects results and must not block.
+type SendCallback func(partition int32, offset int64, err error)
+
+// SendFuture is the pending result of an asynchronous send.
+type SendFuture struct {
+	done      chan struct{}
+	partition int32
+	offset    int64
+	err       error
+}
+
+// Done is closed once the result is available.
+func (f *SendFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the message was acknowledged or failed, or ctx is done.
+func (f *SendFuture) Wait(ctx context.Context) (int32, int64, error) {
+	select {
+	case <-f.done:
+		return f.partition, f.offset, f.err
+	case <-ctx.Done():
+		return 0, 0, errs.WrapMsg(ctx.Err(), "wait kafka send result")
+	}
+}
+
+// Message is one entry of AsyncProducer.SendMessages.
+type Message struct {
+	Key   string
+	Value proto.Message
+}
+
+// SendResult is the outcome of one message sent by SendMessages.
+type SendResult struct {
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+// SendError is the failure of one message of a batch.
+type SendError struct {
+	Index int
+	Err   error
+}
+
+// SendErrors reports the messages of a batch that failed, the others were delivered.
+type SendErrors []*SendError
+
+func (e SendErrors) Error() string {
+	return fmt.Sprintf("kafka: failed to deliver %d messages, first error: %v", len(e), e[0].Err)
+}
+
+type pendingMessage struct {
+	future   *SendFuture
+	callback SendCallback
+}
+
+// AsyncProducer sends messages without waiting for each round trip, letting sarama batch
+// them according to Config.Batch. Results are reported through futures and callbacks.
+type AsyncProducer struct {
+	topic    string
+	producer sarama.AsyncProducer
+	mu       sync.RWMutex
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewKafkaAsyncProducer creates an AsyncProducer for topic. Successes and errors are
+// always returned by sarama, since they resolve the futures.
+func NewKafkaAsyncProducer(config *sarama.Config, addr []string, topic string) (*AsyncProducer, error) {
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	producer, err := NewAsyncProducer(config, addr)
+	if err != nil {
+		return nil, err
+	}
+	return newKafkaAsyncProducer(producer, topic), nil
+}
+
+func newKafkaAsyncProducer(producer sarama.AsyncProducer, topic string) *AsyncProducer {
+	p := &AsyncProducer{topic: topic, producer: producer}
+	p.wg.Add(2)
+	go p.collectSuccesses()
+	go p.collectErrors()
+	return p
+}
+
+func (p *AsyncProducer) collectSuccesses() {
+	defer p.wg.Done()
+	for msg := range p.producer.Successes() {
+		p.complete(msg, nil)
+	}
+}
+
+func (p *AsyncProducer) collectErrors() {
+	defer p.wg.Done()
+	for perr := range p.producer.Errors() {
+		p.complete(perr.Msg, errs.WrapMsg(perr.Err, "kafka async send failed", "topic", perr.Msg.Topic))
+	}
+}
+
+func (p *AsyncProducer) complete(msg *sarama.ProducerMessage, err error) {
+	pending, ok := msg.Metadata.(*pendingMessage)
+	if !ok {
+		return
+	}
+	future := pending.future
+	future.partition, future.offset, future.err = msg.Partition, msg.Offset, err
+	if err != nil {
+		future.partition, future.offset = 0, 0
+	}
+	close(future.done)
+	if pending.callback != nil {
+		pending.callback(future.partition, future.offset, future.err)
+	}
+}
+
+// SendMessageAsync queues a message for the configured topic with the same context headers
+// as Producer.SendMessage. The callback is optional, the returned future resolves either way.
+func (p *AsyncProducer) SendMessageAsync(ctx context.Context, key string, msg proto.Message, callback SendCallback) (*SendFuture, error) {
+	kMsg, err := newProducerMessage(ctx, p.topic, key, msg)
+	if err != nil {
+		return nil, err
+	}
+	future := &SendFuture{done: make(chan struct{})}
+	kMsg.Metadata = &pendingMessage{future: future, callback: callback}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil, errs.Wrap(ErrProducerClosed)
+	}
+	select {
+	case p.producer.Input() <- kMsg:
+		return future, nil
+	case <-ctx.Done():
+		return nil, errs.WrapMsg(ctx.Err(), "kafka async send canceled")
+	}
+}
+
+// SendMessages sends msgs and waits until all of them were acknowledged or failed.
+// The partitions and offsets are returned in the order of msgs. If some messages failed
+// the error is SendErrors, the other messages were still delivered.
+func (p *AsyncProducer) SendMessages(ctx context.Context, msgs []Message) ([]SendResult, error) {
+	futures := make([]*SendFuture, len(msgs))
+	results := make([]SendResult, len(msgs))
+	for i, msg := range msgs {
+		futures[i], results[i].Err = p.SendMessageAsync(ctx, msg.Key, msg.Value, nil)
+	}
+	var failed SendErrors
+	for i, future := range futures {
+		if future != nil {
+			results[i].Partition, results[i].Offset, results[i].Err = future.Wait(ctx)
+		}
+		if results[i].Err != nil {
+			failed = append(failed, &SendError{Index: i, Err: results[i].Err})
+		}
+	}
+	if len(failed) > 0 {
+		return results, failed
+	}
+	return results, nil
+}
+
+// Close stops accepting messages, flushes the buffered ones and waits for their results.
+func (p *AsyncProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+	// AsyncClose flushes the buffered messages and leaves their results to the collectors,
+	// which return once sarama closed both channels. Close would consume the errors itself.
+	p.producer.AsyncClose()
+	p.wg.Wait()
+	return nil
+}
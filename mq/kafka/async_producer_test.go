@@ -0,0 +1,107 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newMockAsyncProducer(t *testing.T) (*mocks.AsyncProducer, *AsyncProducer) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	mock := mocks.NewAsyncProducer(t, config)
+	return mock, newKafkaAsyncProducer(mock, "topic")
+}
+
+func TestAsyncProducerSend(t *testing.T) {
+	mock, producer := newMockAsyncProducer(t)
+	mock.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		for _, h := range msg.Headers {
+			if string(h.Key) == constant.OperationID && string(h.Value) == "op" {
+				return nil
+			}
+		}
+		return errors.New("missing operationID header")
+	})
+	mock.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	ctx := mcontext.NewCtx("op")
+	future, err := producer.SendMessageAsync(ctx, "key", wrapperspb.String("a"), nil)
+	assert.NoError(t, err)
+	_, offset, err := future.Wait(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), offset)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	_, err = producer.SendMessageAsync(ctx, "key", wrapperspb.String("b"), func(partition int32, offset int64, err error) {
+		defer wg.Done()
+		assert.ErrorIs(t, err, sarama.ErrOutOfBrokers)
+	})
+	assert.NoError(t, err)
+	wg.Wait()
+
+	_, err = producer.SendMessageAsync(context.Background(), "key", wrapperspb.String("c"), nil)
+	assert.Error(t, err, "operationID is required")
+
+	assert.NoError(t, producer.Close())
+	_, err = producer.SendMessageAsync(ctx, "key", wrapperspb.String("d"), nil)
+	assert.ErrorIs(t, err, ErrProducerClosed)
+}
+
+func TestAsyncProducerSendMessages(t *testing.T) {
+	mock, producer := newMockAsyncProducer(t)
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(sarama.ErrMessageSizeTooLarge)
+	mock.ExpectInputAndSucceed()
+
+	ctx := mcontext.NewCtx("op")
+	results, err := producer.SendMessages(ctx, []Message{
+		{Key: "a", Value: wrapperspb.String("a")},
+		{Key: "b", Value: wrapperspb.String("b")},
+		{Key: "c", Value: wrapperspb.String("c")},
+		{Key: "d", Value: wrapperspb.String("")},
+	})
+	var sendErrs SendErrors
+	assert.ErrorAs(t, err, &sendErrs)
+	assert.Len(t, sendErrs, 2)
+	assert.Equal(t, 1, sendErrs[0].Index)
+	assert.ErrorIs(t, sendErrs[0].Err, sarama.ErrMessageSizeTooLarge)
+	assert.Equal(t, 3, sendErrs[1].Index, "empty messages are rejected before sending")
+	assert.Len(t, results, 4)
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[2].Err)
+	assert.NotEqual(t, results[0].Offset, results[2].Offset)
+	assert.NoError(t, producer.Close())
+}
+
+func TestAsyncProducerCloseFlushes(t *testing.T) {
+	mock, producer := newMockAsyncProducer(t)
+	const total = 50
+	for i := 0; i < total; i++ {
+		mock.ExpectInputAndSucceed()
+	}
+	ctx := mcontext.NewCtx("op")
+	futures := make([]*SendFuture, 0, total)
+	for i := 0; i < total; i++ {
+		future, err := producer.SendMessageAsync(ctx, "key", wrapperspb.String("v"), nil)
+		assert.NoError(t, err)
+		futures = append(futures, future)
+	}
+	assert.NoError(t, producer.Close())
+	for _, future := range futures {
+		select {
+		case <-future.Done():
+		default:
+			t.Fatal("Close returned before all results were reported")
+		}
+	}
+}
@@ -14,6 +14,12 @@
 
 package kafka
 
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
 type TLSConfig struct {
 	EnableTLS          bool   `yaml:"enableTLS"`
 	CACrt              string `yaml:"caCrt"`
@@ -24,10 +30,24 @@ type TLSConfig struct {
 }
 
 type Config struct {
-	Username     string    `yaml:"username"`
-	Password     string    `yaml:"password"`
-	ProducerAck  string    `yaml:"producerAck"`
-	CompressType string    `yaml:"compressType"`
-	Addr         []string  `yaml:"addr"`
-	TLS          TLSConfig `yaml:"tls"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Mechanism is the SASL mechanism: PLAIN (default), SCRAM-SHA-256, SCRAM-SHA-512 or OAUTHBEARER.
+	Mechanism string `yaml:"mechanism"`
+	// TokenProvider supplies the OAUTHBEARER tokens, it cannot be set from a config file.
+	TokenProvider sarama.AccessTokenProvider `yaml:"-"`
+	ProducerAck   string                     `yaml:"producerAck"`
+	CompressType  string                     `yaml:"compressType"`
+	Addr          []string                   `yaml:"addr"`
+	TLS           TLSConfig                  `yaml:"tls"`
+	Batch         BatchConfig                `yaml:"batch"`
+}
+
+// BatchConfig controls how producers batch messages before sending them to a broker.
+// Zero values keep the sarama defaults.
+type BatchConfig struct {
+	Messages    int           `yaml:"messages"`    // messages that trigger a flush
+	Bytes       int           `yaml:"bytes"`       // buffered bytes that trigger a flush
+	Frequency   time.Duration `yaml:"frequency"`   // longest time a message is buffered, e.g. 10ms
+	MaxMessages int           `yaml:"maxMessages"` // upper bound of messages in one request
 }
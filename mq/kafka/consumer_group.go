@@ -24,8 +24,9 @@ import (
 
 type MConsumerGroup struct {
 	sarama.ConsumerGroup
-	groupID string
-	topics  []string
+	groupID    string
+	topics     []string
+	autoCommit bool
 }
 
 func NewMConsumerGroup(conf *Config, groupID string, topics []string, autoCommitEnable bool) (*MConsumerGroup, error) {
@@ -37,6 +38,24 @@ func NewMConsumerGroup(conf *Config, groupID string, topics []string, autoCommit
 	if err != nil {
 		return nil, err
 	}
+	return &MConsumerGroup{
+		ConsumerGroup: group,
+		groupID:       groupID,
+		topics:        topics,
+		autoCommit:    autoCommitEnable,
+	}, nil
+}
+
+// NewTxnMConsumerGroup creates a consumer group for TxnProcessor, see BuildTxnConsumerGroupConfig.
+func NewTxnMConsumerGroup(conf *Config, groupID string, topics []string) (*MConsumerGroup, error) {
+	config, err := BuildTxnConsumerGroupConfig(conf, sarama.OffsetNewest)
+	if err != nil {
+		return nil, err
+	}
+	group, err := NewConsumerGroup(config, conf.Addr, groupID)
+	if err != nil {
+		return nil, err
+	}
 	return &MConsumerGroup{
 		ConsumerGroup: group,
 		groupID:       groupID,
@@ -0,0 +1,235 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// Headers added to messages forwarded to a dead-letter topic.
+const (
+	DLQHeaderError     = "dlq-error"
+	DLQHeaderTopic     = "dlq-original-topic"
+	DLQHeaderPartition = "dlq-original-partition"
+	DLQHeaderOffset    = "dlq-original-offset"
+	DLQHeaderAttempts  = "dlq-attempts"
+)
+
+// MessageHandler handles a decoded message. A returned error makes the message retried.
+type MessageHandler[T proto.Message] func(ctx context.Context, key string, msg T) error
+
+type handlerOptions struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	dlqProducer    sarama.SyncProducer
+	dlqTopic       string
+	commitBatch    int
+	commitInterval time.Duration
+}
+
+// HandlerOption configures a TypedConsumer.
+type HandlerOption func(*handlerOptions)
+
+// WithRetry sets how many times a failed message is retried, waiting initialBackoff
+// before the first retry and doubling up to maxBackoff. The default is 3 retries from 100ms to 5s.
+func WithRetry(maxRetries int, initialBackoff, maxBackoff time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.maxRetries = maxRetries
+		o.initialBackoff = initialBackoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithDeadLetter forwards messages that cannot be decoded or still fail after the last
+// retry to topic, with the failure described in the DLQHeader* headers.
+// Without a dead-letter topic such messages are logged and skipped.
+func WithDeadLetter(producer sarama.SyncProducer, topic string) HandlerOption {
+	return func(o *handlerOptions) {
+		o.dlqProducer = producer
+		o.dlqTopic = topic
+	}
+}
+
+// WithCommitThreshold sets when marked offsets are committed while auto commit is disabled:
+// once messages offsets were marked since the last commit, or every interval, whichever comes
+// first. A non-positive value disables that threshold. Marked offsets are always committed when
+// the session ends. The default is 100 messages or 1s.
+func WithCommitThreshold(messages int, interval time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.commitBatch = messages
+		o.commitInterval = interval
+	}
+}
+
+// TypedConsumer decodes protobuf messages of type T and passes them to a MessageHandler.
+// An offset is marked only after its message was handled or forwarded to the dead-letter topic.
+// When auto commit is disabled, marked offsets are committed as set by WithCommitThreshold.
+type TypedConsumer[T proto.Message] struct {
+	group   *MConsumerGroup
+	handler MessageHandler[T]
+	opts    handlerOptions
+}
+
+// NewTypedConsumer creates a consumer handling the messages of group with handler.
+func NewTypedConsumer[T proto.Message](group *MConsumerGroup, handler MessageHandler[T], opts ...HandlerOption) *TypedConsumer[T] {
+	c := &TypedConsumer[T]{
+		group:   group,
+		handler: handler,
+		opts: handlerOptions{
+			maxRetries:     3,
+			initialBackoff: 100 * time.Millisecond,
+			maxBackoff:     5 * time.Second,
+			commitBatch:    100,
+			commitInterval: time.Second,
+		},
+	}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	return c
+}
+
+// Start consumes until ctx is done or the consumer group is closed.
+func (c *TypedConsumer[T]) Start(ctx context.Context) {
+	c.group.RegisterHandleAndConsumer(ctx, c)
+}
+
+func (c *TypedConsumer[T]) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+// Cleanup commits the offsets marked since the last commit threshold was reached.
+func (c *TypedConsumer[T]) Cleanup(session sarama.ConsumerGroupSession) error {
+	if !c.group.autoCommit {
+		session.Commit()
+	}
+	return nil
+}
+
+func (c *TypedConsumer[T]) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	var (
+		uncommitted int
+		tick        <-chan time.Time
+	)
+	if !c.group.autoCommit && c.opts.commitInterval > 0 {
+		ticker := time.NewTicker(c.opts.commitInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case <-tick:
+			if uncommitted > 0 {
+				session.Commit()
+				uncommitted = 0
+			}
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if err := c.handle(session.Context(), msg); err != nil {
+				// The offset is not marked, the message is consumed again after the rebalance.
+				return err
+			}
+			session.MarkMessage(msg, "")
+			if c.group.autoCommit {
+				continue
+			}
+			if uncommitted++; c.opts.commitBatch > 0 && uncommitted >= c.opts.commitBatch {
+				session.Commit()
+				uncommitted = 0
+			}
+		}
+	}
+}
+
+// handle processes one message. It only fails when the message could neither be handled
+// nor forwarded, or when the session ended while retrying.
+func (c *TypedConsumer[T]) handle(sessionCtx context.Context, msg *sarama.ConsumerMessage) error {
+	ctx := GetContextWithMQHeader(msg.Headers)
+	key := string(msg.Key)
+	var zero T
+	value := zero.ProtoReflect().New().Interface().(T)
+	if err := proto.Unmarshal(msg.Value, value); err != nil {
+		return c.deadLetter(ctx, msg, errs.WrapMsg(err, "kafka proto Unmarshal err"), 0)
+	}
+	backoff := c.opts.initialBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = c.call(ctx, key, value); err == nil {
+			return nil
+		}
+		if attempt >= c.opts.maxRetries {
+			return c.deadLetter(ctx, msg, err, attempt+1)
+		}
+		log.ZWarn(ctx, "kafka handle message failed, retrying", err, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "attempt", attempt+1)
+		select {
+		case <-sessionCtx.Done():
+			return errs.WrapMsg(sessionCtx.Err(), "session ended while retrying", "topic", msg.Topic, "offset", msg.Offset)
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > c.opts.maxBackoff {
+			backoff = c.opts.maxBackoff
+		}
+	}
+}
+
+// call runs the handler, turning a panic into an error.
+func (c *TypedConsumer[T]) call(ctx context.Context, key string, msg T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errs.New("kafka handler panic", "panic", fmt.Sprint(r)).Wrap()
+		}
+	}()
+	return c.handler(ctx, key, msg)
+}
+
+func (c *TypedConsumer[T]) deadLetter(ctx context.Context, msg *sarama.ConsumerMessage, cause error, attempts int) error {
+	if c.opts.dlqProducer == nil {
+		log.ZError(ctx, "kafka message dropped", cause, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+		return nil
+	}
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+5)
+	for _, h := range msg.Headers {
+		headers = append(headers, *h)
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(DLQHeaderError), Value: []byte(cause.Error())},
+		sarama.RecordHeader{Key: []byte(DLQHeaderTopic), Value: []byte(msg.Topic)},
+		sarama.RecordHeader{Key: []byte(DLQHeaderPartition), Value: []byte(strconv.Itoa(int(msg.Partition)))},
+		sarama.RecordHeader{Key: []byte(DLQHeaderOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		sarama.RecordHeader{Key: []byte(DLQHeaderAttempts), Value: []byte(strconv.Itoa(attempts))},
+	)
+	_, _, err := c.opts.dlqProducer.SendMessage(&sarama.ProducerMessage{
+		Topic:   c.opts.dlqTopic,
+		Key:     sarama.ByteEncoder(msg.Key),
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "send to dead-letter topic failed", "dlqTopic", c.opts.dlqTopic, "topic", msg.Topic, "offset", msg.Offset)
+	}
+	log.ZWarn(ctx, "kafka message sent to dead-letter topic", cause, "dlqTopic", c.opts.dlqTopic, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+	return nil
+}
@@ -0,0 +1,171 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type fakeSession struct {
+	ctx     context.Context
+	marked  []int64
+	commits int
+}
+
+func (s *fakeSession) Claims() map[string][]int32               { return nil }
+func (s *fakeSession) MemberID() string                         { return "member" }
+func (s *fakeSession) GenerationID() int32                      { return 1 }
+func (s *fakeSession) MarkOffset(string, int32, int64, string)  {}
+func (s *fakeSession) ResetOffset(string, int32, int64, string) {}
+func (s *fakeSession) Commit()                                  { s.commits++ }
+func (s *fakeSession) Context() context.Context                 { return s.ctx }
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "topic" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func newClaim(t *testing.T, values ...[]byte) *fakeClaim {
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(values))}
+	for i, value := range values {
+		claim.messages <- &sarama.ConsumerMessage{
+			Topic:   "topic",
+			Offset:  int64(i),
+			Key:     []byte("key"),
+			Value:   value,
+			Headers: []*sarama.RecordHeader{{Key: []byte("operationID"), Value: []byte("op")}},
+		}
+	}
+	close(claim.messages)
+	return claim
+}
+
+func marshal(t *testing.T, value string) []byte {
+	data, err := proto.Marshal(wrapperspb.String(value))
+	assert.NoError(t, err)
+	return data
+}
+
+func TestTypedConsumerRetry(t *testing.T) {
+	var calls int
+	var got []string
+	handler := func(ctx context.Context, key string, msg *wrapperspb.StringValue) error {
+		calls++
+		if msg.Value == "flaky" && calls < 3 {
+			return errors.New("temporary")
+		}
+		assert.Equal(t, "key", key)
+		got = append(got, msg.Value)
+		return nil
+	}
+	consumer := NewTypedConsumer(&MConsumerGroup{}, handler, WithRetry(3, time.Millisecond, time.Millisecond))
+	session := &fakeSession{ctx: context.Background()}
+	assert.NoError(t, consumer.ConsumeClaim(session, newClaim(t, marshal(t, "flaky"), marshal(t, "ok"))))
+	assert.Equal(t, []string{"flaky", "ok"}, got)
+	assert.Equal(t, []int64{0, 1}, session.marked)
+	assert.Zero(t, session.commits)
+	assert.NoError(t, consumer.Cleanup(session))
+	assert.Equal(t, 1, session.commits)
+}
+
+func TestTypedConsumerCommitThreshold(t *testing.T) {
+	handler := func(ctx context.Context, key string, msg *wrapperspb.StringValue) error { return nil }
+	consumer := NewTypedConsumer(&MConsumerGroup{}, handler, WithCommitThreshold(2, 0))
+	session := &fakeSession{ctx: context.Background()}
+	values := make([][]byte, 5)
+	for i := range values {
+		values[i] = marshal(t, "ok")
+	}
+	assert.NoError(t, consumer.ConsumeClaim(session, newClaim(t, values...)))
+	assert.Len(t, session.marked, 5)
+	assert.Equal(t, 2, session.commits)
+	assert.NoError(t, consumer.Cleanup(session))
+	assert.Equal(t, 3, session.commits)
+
+	consumer = NewTypedConsumer(&MConsumerGroup{}, handler, WithCommitThreshold(0, 10*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session = &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "topic", Value: marshal(t, "ok")}
+	done := make(chan error, 1)
+	go func() { done <- consumer.ConsumeClaim(session, claim) }()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 1, session.commits, "only an interval with marked offsets commits")
+}
+
+func TestTypedConsumerDeadLetter(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	var dead []*sarama.ProducerMessage
+	record := func(msg *sarama.ProducerMessage) error {
+		dead = append(dead, msg)
+		return nil
+	}
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+	defer producer.Close()
+
+	handler := func(ctx context.Context, key string, msg *wrapperspb.StringValue) error {
+		if msg.Value == "panic" {
+			panic("boom")
+		}
+		return nil
+	}
+	consumer := NewTypedConsumer(&MConsumerGroup{autoCommit: true}, handler,
+		WithRetry(1, time.Millisecond, time.Millisecond), WithDeadLetter(producer, "dlq"))
+	session := &fakeSession{ctx: context.Background()}
+	claim := newClaim(t, []byte{0xff, 0xff}, marshal(t, "panic"), marshal(t, "ok"))
+	assert.NoError(t, consumer.ConsumeClaim(session, claim))
+	assert.Equal(t, []int64{0, 1, 2}, session.marked)
+	assert.Zero(t, session.commits)
+
+	assert.Len(t, dead, 2)
+	headers := func(msg *sarama.ProducerMessage) map[string]string {
+		res := make(map[string]string)
+		for _, h := range msg.Headers {
+			res[string(h.Key)] = string(h.Value)
+		}
+		return res
+	}
+	decodeFailure := headers(dead[0])
+	assert.Equal(t, "dlq", dead[0].Topic)
+	assert.Equal(t, "0", decodeFailure[DLQHeaderAttempts])
+	assert.Equal(t, "op", decodeFailure["operationID"])
+	panicked := headers(dead[1])
+	assert.Equal(t, "topic", panicked[DLQHeaderTopic])
+	assert.Equal(t, "1", panicked[DLQHeaderOffset])
+	assert.Equal(t, "2", panicked[DLQHeaderAttempts])
+	assert.Contains(t, panicked[DLQHeaderError], "boom")
+}
+
+func TestTypedConsumerDeadLetterFailure(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	defer producer.Close()
+
+	handler := func(ctx context.Context, key string, msg *wrapperspb.StringValue) error {
+		return errors.New("permanent")
+	}
+	consumer := NewTypedConsumer(&MConsumerGroup{}, handler,
+		WithRetry(0, time.Millisecond, time.Millisecond), WithDeadLetter(producer, "dlq"))
+	session := &fakeSession{ctx: context.Background()}
+	assert.Error(t, consumer.ConsumeClaim(session, newClaim(t, marshal(t, "a"))))
+	assert.Empty(t, session.marked)
+}
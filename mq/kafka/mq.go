@@ -0,0 +1,189 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mq"
+)
+
+// NewMQProducer adapts p to mq.Producer.
+func NewMQProducer(p *Producer) mq.Producer {
+	return &mqProducer{producer: p}
+}
+
+type mqProducer struct {
+	producer *Producer
+}
+
+func (p *mqProducer) SendMessage(ctx context.Context, key string, value []byte) error {
+	header, err := mqHeader(ctx)
+	if err != nil {
+		return err
+	}
+	kMsg := &sarama.ProducerMessage{
+		Topic:   p.producer.topic,
+		Key:     sarama.StringEncoder(key),
+		Value:   sarama.ByteEncoder(value),
+		Headers: header,
+	}
+	if _, _, err := p.producer.producer.SendMessage(kMsg); err != nil {
+		return errs.WrapMsg(err, "p.producer.SendMessage error")
+	}
+	return nil
+}
+
+func (p *mqProducer) Close() error {
+	return p.producer.Close()
+}
+
+// mqHeader returns the headers of ctx like GetMQHeaderWithContext, except that mq.Producer does
+// not require an operationID: without one the header is left out.
+func mqHeader(ctx context.Context) ([]sarama.RecordHeader, error) {
+	if _, ok := ctx.Value(constant.OperationID).(string); ok {
+		return GetMQHeaderWithContext(ctx)
+	}
+	header, err := GetMQHeaderWithContext(context.WithValue(ctx, constant.OperationID, ""))
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range header {
+		if bytes.Equal(h.Key, []byte(constant.OperationID)) {
+			return append(header[:i], header[i+1:]...), nil
+		}
+	}
+	return header, nil
+}
+
+// NewMQConsumer adapts group to mq.Consumer. Kafka only stores one offset per partition, so
+// Ack may be called in any order but an offset is only marked, and committed when auto commit
+// is disabled, once every message delivered before it on its partition was acknowledged too.
+// A message that is never acknowledged holds back the offsets of its partition.
+func NewMQConsumer(group *MConsumerGroup) mq.Consumer {
+	return &mqConsumer{group: group}
+}
+
+type mqConsumer struct {
+	group *MConsumerGroup
+}
+
+func (c *mqConsumer) Subscribe(ctx context.Context, handler mq.Handler) error {
+	c.group.RegisterHandleAndConsumer(ctx, &mqHandler{group: c.group, handler: handler})
+	return nil
+}
+
+func (c *mqConsumer) Close() error {
+	return c.group.Close()
+}
+
+type mqHandler struct {
+	group   *MConsumerGroup
+	handler mq.Handler
+}
+
+func (h *mqHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *mqHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *mqHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	acks := &partitionAcks{session: session, autoCommit: h.group.autoCommit, acked: make(map[int64]bool)}
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			m := &mqMessage{ctx: GetContextWithMQHeader(msg.Headers), msg: msg, acks: acks}
+			acks.deliver(msg)
+			if err := h.handler(m.ctx, m); err != nil {
+				log.ZWarn(m.ctx, "mq handler failed", err, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+			}
+		}
+	}
+}
+
+// partitionAcks marks the offsets of one claimed partition in delivery order.
+type partitionAcks struct {
+	session    sarama.ConsumerGroupSession
+	autoCommit bool
+
+	mu      sync.Mutex
+	pending []*sarama.ConsumerMessage
+	acked   map[int64]bool
+}
+
+func (a *partitionAcks) deliver(msg *sarama.ConsumerMessage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = append(a.pending, msg)
+}
+
+// ack marks the longest run of acknowledged messages at the head of the delivered ones.
+func (a *partitionAcks) ack(msg *sarama.ConsumerMessage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.pending) == 0 || msg.Offset < a.pending[0].Offset {
+		// Acknowledged and marked before.
+		return
+	}
+	a.acked[msg.Offset] = true
+	var last *sarama.ConsumerMessage
+	for len(a.pending) > 0 && a.acked[a.pending[0].Offset] {
+		last = a.pending[0]
+		delete(a.acked, last.Offset)
+		a.pending = a.pending[1:]
+	}
+	if last == nil {
+		return
+	}
+	a.session.MarkMessage(last, "")
+	if !a.autoCommit {
+		a.session.Commit()
+	}
+}
+
+type mqMessage struct {
+	ctx  context.Context
+	msg  *sarama.ConsumerMessage
+	acks *partitionAcks
+}
+
+func (m *mqMessage) Context() context.Context { return m.ctx }
+
+func (m *mqMessage) Key() string { return string(m.msg.Key) }
+
+func (m *mqMessage) Value() []byte { return m.msg.Value }
+
+func (m *mqMessage) Headers() map[string]string {
+	headers := make(map[string]string, len(m.msg.Headers))
+	for _, h := range m.msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	return headers
+}
+
+func (m *mqMessage) Ack() error {
+	m.acks.ack(m.msg)
+	return nil
+}
@@ -0,0 +1,86 @@
+package kafka
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/mq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// Log to stdout only instead of the ./logs directory of the default logger.
+	if err := log.InitLoggerFromConfig("test", "kafka", "", "", log.LevelDebug, true, false, "", 1, 24, "test", false); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestMQProducer(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "topic", msg.Topic)
+		assert.Equal(t, constant.OperationID, string(msg.Headers[0].Key))
+		assert.Equal(t, "op", string(msg.Headers[0].Value))
+		return nil
+	})
+	p := NewMQProducer(&Producer{topic: "topic", producer: producer})
+	assert.NoError(t, p.SendMessage(mcontext.NewCtx("op"), "key", []byte("value")))
+
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		for _, h := range msg.Headers {
+			assert.NotEqual(t, constant.OperationID, string(h.Key))
+		}
+		return nil
+	})
+	assert.NoError(t, p.SendMessage(context.Background(), "key", []byte("value")))
+	assert.NoError(t, p.Close())
+}
+
+func TestMQConsumerAck(t *testing.T) {
+	var acked []mq.Message
+	handler := &mqHandler{group: &MConsumerGroup{}, handler: func(ctx context.Context, msg mq.Message) error {
+		assert.Equal(t, "op", mcontext.GetOperationID(ctx))
+		assert.Equal(t, "key", msg.Key())
+		assert.Equal(t, "op", msg.Headers()["operationID"])
+		if string(msg.Value()) == "skip" {
+			return nil
+		}
+		acked = append(acked, msg)
+		return msg.Ack()
+	}}
+	session := &fakeSession{ctx: context.Background()}
+	assert.NoError(t, handler.ConsumeClaim(session, newClaim(t, []byte("a"), []byte("skip"), []byte("b"))))
+	assert.Len(t, acked, 2)
+	// The unacknowledged message holds back the offset of the message after it.
+	assert.Equal(t, []int64{0}, session.marked)
+	assert.Equal(t, 1, session.commits)
+}
+
+func TestMQConsumerAckOutOfOrder(t *testing.T) {
+	var delivered []mq.Message
+	handler := &mqHandler{group: &MConsumerGroup{}, handler: func(ctx context.Context, msg mq.Message) error {
+		delivered = append(delivered, msg)
+		return nil
+	}}
+	session := &fakeSession{ctx: context.Background()}
+	assert.NoError(t, handler.ConsumeClaim(session, newClaim(t, []byte("a"), []byte("b"), []byte("c"), []byte("d"))))
+	assert.Len(t, delivered, 4)
+
+	assert.NoError(t, delivered[2].Ack())
+	assert.Empty(t, session.marked)
+	assert.NoError(t, delivered[0].Ack())
+	assert.Equal(t, []int64{0}, session.marked)
+	assert.NoError(t, delivered[0].Ack())
+	assert.NoError(t, delivered[1].Ack())
+	assert.Equal(t, []int64{0, 2}, session.marked)
+	assert.NoError(t, delivered[3].Ack())
+	assert.Equal(t, []int64{0, 2, 3}, session.marked)
+	assert.Equal(t, 3, session.commits)
+}
@@ -44,39 +44,53 @@ func NewKafkaProducer(config *sarama.Config, addr []string, topic string) (*Prod
 
 // SendMessage sends a message to the Kafka topic configured in the Producer.
 func (p *Producer) SendMessage(ctx context.Context, key string, msg proto.Message) (int32, int64, error) {
+	kMsg, err := newProducerMessage(ctx, p.topic, key, msg)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Send the message
+	partition, offset, err := p.producer.SendMessage(kMsg)
+	if err != nil {
+		return 0, 0, errs.WrapMsg(err, "p.producer.SendMessage error")
+	}
+
+	return partition, offset, nil
+}
+
+// newProducerMessage marshals msg and attaches the context metadata as headers.
+func newProducerMessage(ctx context.Context, topic string, key string, msg proto.Message) (*sarama.ProducerMessage, error) {
 	// Marshal the protobuf message
 	bMsg, err := proto.Marshal(msg)
 	if err != nil {
-		return 0, 0, errs.WrapMsg(err, "kafka proto Marshal err")
+		return nil, errs.WrapMsg(err, "kafka proto Marshal err")
 	}
 	if len(bMsg) == 0 {
-		return 0, 0, errs.WrapMsg(errEmptyMsg, "kafka proto Marshal err")
+		return nil, errs.WrapMsg(errEmptyMsg, "kafka proto Marshal err")
 	}
 
 	// Prepare Kafka message
 	kMsg := &sarama.ProducerMessage{
-		Topic: p.topic,
+		Topic: topic,
 		Key:   sarama.StringEncoder(key),
 		Value: sarama.ByteEncoder(bMsg),
 	}
 
 	// Validate message key and value
 	if kMsg.Key.Length() == 0 || kMsg.Value.Length() == 0 {
-		return 0, 0, errs.Wrap(errEmptyMsg)
+		return nil, errs.Wrap(errEmptyMsg)
 	}
 
 	// Attach context metadata as headers
 	header, err := GetMQHeaderWithContext(ctx)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 	kMsg.Headers = header
+	return kMsg, nil
+}
 
-	// Send the message
-	partition, offset, err := p.producer.SendMessage(kMsg)
-	if err != nil {
-		return 0, 0, errs.WrapMsg(err, "p.producer.SendMessage error")
-	}
-
-	return partition, offset, nil
+// Close closes the underlying producer.
+func (p *Producer) Close() error {
+	return p.producer.Close()
 }
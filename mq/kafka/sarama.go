@@ -14,18 +14,30 @@ func BuildConsumerGroupConfig(conf *Config, initial int64, autoCommitEnable bool
 	kfk.Consumer.Offsets.Initial = initial
 	kfk.Consumer.Offsets.AutoCommit.Enable = autoCommitEnable
 	kfk.Consumer.Return.Errors = false
-	if conf.Username != "" || conf.Password != "" {
-		kfk.Net.SASL.Enable = true
-		kfk.Net.SASL.User = conf.Username
-		kfk.Net.SASL.Password = conf.Password
+	if err := configureNet(kfk, conf); err != nil {
+		return nil, err
 	}
-	if conf.TLS.EnableTLS {
-		tls, err := newTLSConfig(conf.TLS.ClientCrt, conf.TLS.ClientKey, conf.TLS.CACrt, []byte(conf.TLS.ClientKeyPwd), conf.TLS.InsecureSkipVerify)
-		if err != nil {
-			return nil, err
-		}
-		kfk.Net.TLS.Config = tls
-		kfk.Net.TLS.Enable = true
+	return kfk, nil
+}
+
+// BuildTxnConsumerGroupConfig builds a consumer group config for TxnProcessor. It only reads
+// committed transactions and leaves offset commits to the producer transactions.
+func BuildTxnConsumerGroupConfig(conf *Config, initial int64) (*sarama.Config, error) {
+	kfk, err := BuildConsumerGroupConfig(conf, initial, false)
+	if err != nil {
+		return nil, err
+	}
+	kfk.Version = sarama.V2_0_0_0
+	kfk.Consumer.IsolationLevel = sarama.ReadCommitted
+	return kfk, nil
+}
+
+// BuildAdminConfig builds the config of Admin.
+func BuildAdminConfig(conf *Config) (*sarama.Config, error) {
+	kfk := sarama.NewConfig()
+	kfk.Version = sarama.V2_0_0_0
+	if err := configureNet(kfk, conf); err != nil {
+		return nil, err
 	}
 	return kfk, nil
 }
@@ -43,11 +55,6 @@ func BuildProducerConfig(conf Config) (*sarama.Config, error) {
 	kfk.Producer.Return.Successes = true
 	kfk.Producer.Return.Errors = true
 	kfk.Producer.Partitioner = sarama.NewHashPartitioner
-	if conf.Username != "" || conf.Password != "" {
-		kfk.Net.SASL.Enable = true
-		kfk.Net.SASL.User = conf.Username
-		kfk.Net.SASL.Password = conf.Password
-	}
 	switch strings.ToLower(conf.ProducerAck) {
 	case "no_response":
 		kfk.Producer.RequiredAcks = sarama.NoResponse
@@ -65,14 +72,44 @@ func BuildProducerConfig(conf Config) (*sarama.Config, error) {
 			return nil, errs.WrapMsg(err, "UnmarshalText failed", "compressType", conf.CompressType)
 		}
 	}
-	if conf.TLS.EnableTLS {
-		tls, err := newTLSConfig(conf.TLS.ClientCrt, conf.TLS.ClientKey, conf.TLS.CACrt, []byte(conf.TLS.ClientKeyPwd), conf.TLS.InsecureSkipVerify)
-		if err != nil {
-			return nil, err
-		}
-		kfk.Net.TLS.Config = tls
-		kfk.Net.TLS.Enable = true
+	kfk.Producer.Flush.Messages = conf.Batch.Messages
+	kfk.Producer.Flush.Bytes = conf.Batch.Bytes
+	kfk.Producer.Flush.Frequency = conf.Batch.Frequency
+	kfk.Producer.Flush.MaxMessages = conf.Batch.MaxMessages
+	if err := configureNet(kfk, &conf); err != nil {
+		return nil, err
+	}
+	return kfk, nil
+}
+
+// BuildIdempotentProducerConfig builds a producer config whose retries cannot duplicate
+// or reorder messages within a partition.
+func BuildIdempotentProducerConfig(conf Config) (*sarama.Config, error) {
+	kfk, err := BuildProducerConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	kfk.Version = sarama.V2_0_0_0
+	kfk.Producer.Idempotent = true
+	kfk.Producer.RequiredAcks = sarama.WaitForAll
+	kfk.Net.MaxOpenRequests = 1
+	if kfk.Producer.Retry.Max < 1 {
+		kfk.Producer.Retry.Max = 1
+	}
+	return kfk, nil
+}
+
+// BuildTransactionalProducerConfig builds an idempotent producer config using transactionalID,
+// which must be stable across restarts of the same instance and unique between instances.
+func BuildTransactionalProducerConfig(conf Config, transactionalID string) (*sarama.Config, error) {
+	if transactionalID == "" {
+		return nil, errs.ErrArgs.WrapMsg("transactionalID is empty")
+	}
+	kfk, err := BuildIdempotentProducerConfig(conf)
+	if err != nil {
+		return nil, err
 	}
+	kfk.Producer.Transaction.ID = transactionalID
 	return kfk, nil
 }
 
@@ -83,3 +120,11 @@ func NewProducer(conf *sarama.Config, addr []string) (sarama.SyncProducer, error
 	}
 	return producer, nil
 }
+
+func NewAsyncProducer(conf *sarama.Config, addr []string) (sarama.AsyncProducer, error) {
+	producer, err := sarama.NewAsyncProducer(addr, conf)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "NewAsyncProducer failed", "addr", addr, "conf", *conf)
+	}
+	return producer, nil
+}
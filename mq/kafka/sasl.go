@@ -0,0 +1,109 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/openimsdk/tools/errs"
+	"github.com/xdg-go/scram"
+)
+
+// SASL mechanisms accepted in Config.Mechanism. An empty mechanism means PLAIN.
+const (
+	MechanismPlain       = sarama.SASLTypePlaintext
+	MechanismSCRAMSHA256 = sarama.SASLTypeSCRAMSHA256
+	MechanismSCRAMSHA512 = sarama.SASLTypeSCRAMSHA512
+	MechanismOAuthBearer = sarama.SASLTypeOAuth
+)
+
+// scramClient implements sarama.SCRAMClient with xdg-go/scram.
+type scramClient struct {
+	hashGen      scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hashGen.NewClient(userName, password, authzID)
+	if err != nil {
+		return errs.WrapMsg(err, "create scram client failed")
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
+
+// NewSCRAMSHA256Client is the sarama SCRAMClientGeneratorFunc of SCRAM-SHA-256.
+func NewSCRAMSHA256Client() sarama.SCRAMClient {
+	return &scramClient{hashGen: scram.SHA256}
+}
+
+// NewSCRAMSHA512Client is the sarama SCRAMClientGeneratorFunc of SCRAM-SHA-512.
+func NewSCRAMSHA512Client() sarama.SCRAMClient {
+	return &scramClient{hashGen: scram.SHA512}
+}
+
+// configureNet applies the SASL and TLS settings of conf, shared by every config builder.
+func configureNet(kfk *sarama.Config, conf *Config) error {
+	mechanism := sarama.SASLMechanism(strings.ToUpper(conf.Mechanism))
+	switch mechanism {
+	case "", MechanismPlain:
+		if conf.Username != "" || conf.Password != "" {
+			kfk.Net.SASL.Enable = true
+			kfk.Net.SASL.Mechanism = MechanismPlain
+			kfk.Net.SASL.User = conf.Username
+			kfk.Net.SASL.Password = conf.Password
+		}
+	case MechanismSCRAMSHA256, MechanismSCRAMSHA512:
+		if conf.Username == "" || conf.Password == "" {
+			return errs.ErrArgs.WrapMsg("username and password are required for SCRAM", "mechanism", conf.Mechanism)
+		}
+		kfk.Net.SASL.Enable = true
+		kfk.Net.SASL.Mechanism = mechanism
+		kfk.Net.SASL.User = conf.Username
+		kfk.Net.SASL.Password = conf.Password
+		if mechanism == MechanismSCRAMSHA256 {
+			kfk.Net.SASL.SCRAMClientGeneratorFunc = NewSCRAMSHA256Client
+		} else {
+			kfk.Net.SASL.SCRAMClientGeneratorFunc = NewSCRAMSHA512Client
+		}
+	case MechanismOAuthBearer:
+		if conf.TokenProvider == nil {
+			return errs.ErrArgs.WrapMsg("token provider is required for OAUTHBEARER")
+		}
+		kfk.Net.SASL.Enable = true
+		kfk.Net.SASL.Mechanism = mechanism
+		kfk.Net.SASL.TokenProvider = conf.TokenProvider
+	default:
+		return errs.ErrArgs.WrapMsg("unsupported SASL mechanism", "mechanism", conf.Mechanism)
+	}
+	if conf.TLS.EnableTLS {
+		tls, err := newTLSConfig(conf.TLS.ClientCrt, conf.TLS.ClientKey, conf.TLS.CACrt, []byte(conf.TLS.ClientKeyPwd), conf.TLS.InsecureSkipVerify)
+		if err != nil {
+			return err
+		}
+		kfk.Net.TLS.Config = tls
+		kfk.Net.TLS.Enable = true
+	}
+	return nil
+}
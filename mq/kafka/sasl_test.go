@@ -0,0 +1,75 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/xdg-go/scram"
+)
+
+type staticToken string
+
+func (s staticToken) Token() (*sarama.AccessToken, error) {
+	return &sarama.AccessToken{Token: string(s)}, nil
+}
+
+func TestBuildConfigSASL(t *testing.T) {
+	config, err := BuildProducerConfig(Config{Username: "u", Password: "p"})
+	assert.NoError(t, err)
+	assert.Equal(t, sarama.SASLMechanism(MechanismPlain), config.Net.SASL.Mechanism)
+
+	config, err = BuildProducerConfig(Config{Username: "u", Password: "p", Mechanism: "scram-sha-512"})
+	assert.NoError(t, err)
+	assert.Equal(t, sarama.SASLMechanism(MechanismSCRAMSHA512), config.Net.SASL.Mechanism)
+	assert.NoError(t, config.Validate())
+
+	config, err = BuildConsumerGroupConfig(&Config{Mechanism: MechanismOAuthBearer, TokenProvider: staticToken("t")}, sarama.OffsetNewest, false)
+	assert.NoError(t, err)
+	assert.True(t, config.Net.SASL.Enable)
+	assert.NoError(t, config.Validate())
+
+	_, err = BuildConsumerGroupConfig(&Config{Mechanism: MechanismOAuthBearer}, sarama.OffsetNewest, false)
+	assert.Error(t, err)
+	_, err = BuildProducerConfig(Config{Mechanism: MechanismSCRAMSHA256})
+	assert.Error(t, err)
+	_, err = BuildProducerConfig(Config{Mechanism: "GSSAPI"})
+	assert.Error(t, err)
+}
+
+func TestSCRAMClient(t *testing.T) {
+	for name, gen := range map[string]struct {
+		client sarama.SCRAMClient
+		hash   scram.HashGeneratorFcn
+	}{
+		"sha256": {NewSCRAMSHA256Client(), scram.SHA256},
+		"sha512": {NewSCRAMSHA512Client(), scram.SHA512},
+	} {
+		t.Run(name, func(t *testing.T) {
+			kf := scram.KeyFactors{Salt: "salt", Iters: 4096}
+			server, err := gen.hash.NewServer(func(user string) (scram.StoredCredentials, error) {
+				client, err := gen.hash.NewClient(user, "secret", "")
+				if err != nil {
+					return scram.StoredCredentials{}, err
+				}
+				return client.GetStoredCredentials(kf), nil
+			})
+			assert.NoError(t, err)
+			conversation := server.NewConversation()
+
+			client := gen.client
+			assert.NoError(t, client.Begin("user", "secret", ""))
+			challenge := ""
+			for !client.Done() {
+				response, err := client.Step(challenge)
+				assert.NoError(t, err)
+				if client.Done() {
+					break
+				}
+				challenge, err = conversation.Step(response)
+				assert.NoError(t, err)
+			}
+			assert.True(t, conversation.Valid())
+		})
+	}
+}
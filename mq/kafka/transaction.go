@@ -0,0 +1,258 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+// ErrNotTransactional is returned when TxnProcessor is given a producer without a transactional ID.
+var ErrNotTransactional = errors.New("kafka producer is not transactional")
+
+// TransformFunc turns a consumed message into the messages produced in the same transaction.
+// Produced messages without headers inherit the headers of the consumed message, so the
+// context metadata travels with them.
+type TransformFunc func(ctx context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error)
+
+type txnOptions struct {
+	batchSize      int
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// TxnOption configures a TxnProcessor.
+type TxnOption func(*txnOptions)
+
+// WithTxnBatchSize sets how many already fetched messages may share one transaction.
+// The processor never waits for a batch to fill up. The default is 100.
+func WithTxnBatchSize(size int) TxnOption {
+	return func(o *txnOptions) {
+		if size > 0 {
+			o.batchSize = size
+		}
+	}
+}
+
+// WithTxnRetry sets how many times a failing transform is retried before its message is
+// skipped, and the backoff between retries of transforms and of failed transactions.
+// The default is 3 retries from 100ms to 5s.
+func WithTxnRetry(maxRetries int, initialBackoff, maxBackoff time.Duration) TxnOption {
+	return func(o *txnOptions) {
+		o.maxRetries = maxRetries
+		o.initialBackoff = initialBackoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// TxnProcessor consumes messages, transforms them and produces the results together with the
+// consumer offsets in one Kafka transaction, so a rebalance or restart never duplicates output.
+// Create the consumer group with NewTxnMConsumerGroup and the producer with
+// BuildTransactionalProducerConfig. The claims of a session share the producer, which runs one
+// transaction at a time, so their transactions are serialized.
+type TxnProcessor struct {
+	group     *MConsumerGroup
+	producer  sarama.SyncProducer
+	transform TransformFunc
+	opts      txnOptions
+
+	// txnMu guards the producer from BeginTxn to CommitTxn or AbortTxn.
+	txnMu sync.Mutex
+}
+
+// NewTxnProcessor creates a processor consuming group and producing through producer.
+func NewTxnProcessor(group *MConsumerGroup, producer sarama.SyncProducer, transform TransformFunc, opts ...TxnOption) (*TxnProcessor, error) {
+	if !producer.IsTransactional() {
+		return nil, errs.Wrap(ErrNotTransactional)
+	}
+	p := &TxnProcessor{
+		group:     group,
+		producer:  producer,
+		transform: transform,
+		opts: txnOptions{
+			batchSize:      100,
+			maxRetries:     3,
+			initialBackoff: 100 * time.Millisecond,
+			maxBackoff:     5 * time.Second,
+		},
+	}
+	for _, opt := range opts {
+		opt(&p.opts)
+	}
+	return p, nil
+}
+
+// Start consumes until ctx is done or the consumer group is closed.
+func (p *TxnProcessor) Start(ctx context.Context) {
+	p.group.RegisterHandleAndConsumer(ctx, p)
+}
+
+func (p *TxnProcessor) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (p *TxnProcessor) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (p *TxnProcessor) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			batch := p.fillBatch(claim, msg)
+			if err := p.process(session.Context(), batch); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// fillBatch adds the messages that are already waiting in the claim, up to the batch size.
+func (p *TxnProcessor) fillBatch(claim sarama.ConsumerGroupClaim, first *sarama.ConsumerMessage) []*sarama.ConsumerMessage {
+	batch := []*sarama.ConsumerMessage{first}
+	for len(batch) < p.opts.batchSize {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return batch
+			}
+			batch = append(batch, msg)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// process commits the output of batch and its offsets in one transaction. Failed transactions
+// are aborted and retried until the session ends, a fatal producer error is returned.
+func (p *TxnProcessor) process(ctx context.Context, batch []*sarama.ConsumerMessage) error {
+	var outputs []*sarama.ProducerMessage
+	for _, msg := range batch {
+		out, ok := p.transformMessage(ctx, msg)
+		if !ok {
+			// The session ended, the new owner of the partition consumes the batch again.
+			return nil
+		}
+		outputs = append(outputs, out...)
+	}
+	backoff := p.opts.initialBackoff
+	for {
+		fatal, err := p.commit(batch, outputs)
+		if err == nil {
+			return nil
+		}
+		if fatal {
+			return errs.WrapMsg(err, "kafka transactional producer failed", "groupID", p.group.groupID)
+		}
+		log.ZWarn(ctx, "kafka transaction failed, retrying", err, "topic", batch[0].Topic, "partition", batch[0].Partition, "offset", batch[0].Offset)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > p.opts.maxBackoff {
+			backoff = p.opts.maxBackoff
+		}
+	}
+}
+
+// transformMessage runs the transform with retries. Messages that keep failing are skipped and
+// their offset is committed with the batch. It reports false when the session ended.
+func (p *TxnProcessor) transformMessage(sessionCtx context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, bool) {
+	ctx := GetContextWithMQHeader(msg.Headers)
+	backoff := p.opts.initialBackoff
+	for attempt := 0; ; attempt++ {
+		out, err := p.transform(ctx, msg)
+		if err == nil {
+			for _, m := range out {
+				if m.Headers == nil {
+					m.Headers = make([]sarama.RecordHeader, 0, len(msg.Headers))
+					for _, h := range msg.Headers {
+						m.Headers = append(m.Headers, *h)
+					}
+				}
+			}
+			return out, true
+		}
+		if attempt >= p.opts.maxRetries {
+			log.ZError(ctx, "kafka transform failed, message skipped", err, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+			return nil, true
+		}
+		select {
+		case <-sessionCtx.Done():
+			return nil, false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > p.opts.maxBackoff {
+			backoff = p.opts.maxBackoff
+		}
+	}
+}
+
+// commit runs the transaction of batch, reporting whether a failure left the producer unusable.
+func (p *TxnProcessor) commit(batch []*sarama.ConsumerMessage, outputs []*sarama.ProducerMessage) (bool, error) {
+	p.txnMu.Lock()
+	defer p.txnMu.Unlock()
+	if err := p.runTxn(batch, outputs); err != nil {
+		return p.producer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0, err
+	}
+	return false, nil
+}
+
+// runTxn produces outputs and the offset of batch in one transaction. The caller holds p.txnMu.
+func (p *TxnProcessor) runTxn(batch []*sarama.ConsumerMessage, outputs []*sarama.ProducerMessage) error {
+	if err := p.producer.BeginTxn(); err != nil {
+		return errs.WrapMsg(err, "BeginTxn failed")
+	}
+	if len(outputs) > 0 {
+		// sarama keeps per-attempt state in the messages, retries send fresh copies.
+		msgs := make([]*sarama.ProducerMessage, len(outputs))
+		for i, m := range outputs {
+			msgs[i] = &sarama.ProducerMessage{Topic: m.Topic, Key: m.Key, Value: m.Value, Headers: m.Headers, Partition: m.Partition, Timestamp: m.Timestamp}
+		}
+		if err := p.producer.SendMessages(msgs); err != nil {
+			p.abort()
+			return errs.WrapMsg(err, "send transactional messages failed")
+		}
+	}
+	// A batch comes from one partition, committing the last offset covers all of it.
+	if err := p.producer.AddMessageToTxn(batch[len(batch)-1], p.group.groupID, nil); err != nil {
+		p.abort()
+		return errs.WrapMsg(err, "AddMessageToTxn failed")
+	}
+	if err := p.producer.CommitTxn(); err != nil {
+		p.abort()
+		return errs.WrapMsg(err, "CommitTxn failed")
+	}
+	return nil
+}
+
+func (p *TxnProcessor) abort() {
+	if p.producer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0 {
+		return
+	}
+	if err := p.producer.AbortTxn(); err != nil {
+		log.ZWarn(context.Background(), "AbortTxn failed", err, "groupID", p.group.groupID)
+	}
+}
@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxnProcessor(t *testing.T) {
+	config, err := BuildTransactionalProducerConfig(Config{}, "txn")
+	assert.NoError(t, err)
+	producer := mocks.NewSyncProducer(t, config)
+	defer producer.Close()
+
+	var sent []*sarama.ProducerMessage
+	record := func(msg *sarama.ProducerMessage) error {
+		sent = append(sent, msg)
+		return nil
+	}
+	// The first transaction fails and is retried with the same output.
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+
+	transform := func(ctx context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+		if string(msg.Value) == "bad" {
+			return nil, errors.New("cannot transform")
+		}
+		return []*sarama.ProducerMessage{{Topic: "out", Key: sarama.ByteEncoder(msg.Key), Value: sarama.ByteEncoder(msg.Value)}}, nil
+	}
+	processor, err := NewTxnProcessor(&MConsumerGroup{groupID: "group"}, producer, transform,
+		WithTxnRetry(1, time.Millisecond, time.Millisecond))
+	assert.NoError(t, err)
+
+	claim := newClaim(t, []byte("a"), []byte("bad"), []byte("b"))
+	assert.NoError(t, processor.ConsumeClaim(&fakeSession{ctx: context.Background()}, claim))
+	assert.Len(t, sent, 2)
+	assert.Equal(t, "out", sent[0].Topic)
+	assert.Equal(t, sarama.ByteEncoder("b"), sent[1].Value)
+	assert.Equal(t, "operationID", string(sent[0].Headers[0].Key))
+	assert.Equal(t, sarama.ProducerTxnFlagReady, producer.TxnStatus())
+
+	_, err = NewTxnProcessor(&MConsumerGroup{}, mocks.NewSyncProducer(t, nil), transform)
+	assert.ErrorIs(t, err, ErrNotTransactional)
+}
+
+// exclusiveTxnProducer records transactions begun while another one is still open.
+type exclusiveTxnProducer struct {
+	sarama.SyncProducer
+	open       atomic.Bool
+	overlapped atomic.Bool
+}
+
+func (p *exclusiveTxnProducer) BeginTxn() error {
+	if !p.open.CompareAndSwap(false, true) {
+		p.overlapped.Store(true)
+	}
+	return p.SyncProducer.BeginTxn()
+}
+
+func (p *exclusiveTxnProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	// Widen the window in which another claim could interleave.
+	time.Sleep(time.Millisecond)
+	return p.SyncProducer.SendMessages(msgs)
+}
+
+func (p *exclusiveTxnProducer) CommitTxn() error {
+	p.open.Store(false)
+	return p.SyncProducer.CommitTxn()
+}
+
+func (p *exclusiveTxnProducer) AbortTxn() error {
+	p.open.Store(false)
+	return p.SyncProducer.AbortTxn()
+}
+
+func TestTxnProcessorConcurrentClaims(t *testing.T) {
+	config, err := BuildTransactionalProducerConfig(Config{}, "txn")
+	assert.NoError(t, err)
+	mock := mocks.NewSyncProducer(t, config)
+	defer mock.Close()
+	const claims, messages = 4, 20
+	for i := 0; i < claims*messages; i++ {
+		mock.ExpectSendMessageAndSucceed()
+	}
+	producer := &exclusiveTxnProducer{SyncProducer: mock}
+
+	transform := func(ctx context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+		return []*sarama.ProducerMessage{{Topic: "out", Value: sarama.ByteEncoder(msg.Value)}}, nil
+	}
+	processor, err := NewTxnProcessor(&MConsumerGroup{groupID: "group"}, producer, transform, WithTxnBatchSize(1))
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < claims; i++ {
+		values := make([][]byte, messages)
+		for j := range values {
+			values[j] = []byte("value")
+		}
+		claim := newClaim(t, values...)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, processor.ConsumeClaim(&fakeSession{ctx: context.Background()}, claim))
+		}()
+	}
+	wg.Wait()
+	assert.False(t, producer.overlapped.Load(), "transactions of different claims interleaved")
+	assert.Equal(t, sarama.ProducerTxnFlagReady, producer.TxnStatus())
+}
+
+func TestBuildTransactionalProducerConfig(t *testing.T) {
+	_, err := BuildTransactionalProducerConfig(Config{}, "")
+	assert.Error(t, err)
+	config, err := BuildTransactionalProducerConfig(Config{ProducerAck: "wait_for_local"}, "transfer-0")
+	assert.NoError(t, err)
+	assert.True(t, config.Producer.Idempotent)
+	assert.Equal(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.NoError(t, config.Validate())
+}
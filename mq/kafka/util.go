@@ -3,32 +3,138 @@ package kafka
 import (
 	"context"
 	"errors"
+	"sync"
+
 	"github.com/IBM/sarama"
 	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/errs"
 	"github.com/openimsdk/tools/mcontext"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 var errEmptyMsg = errors.New("kafka binary msg is empty")
 
+var (
+	propagatorMu    sync.RWMutex
+	tracePropagator propagation.TextMapPropagator = propagation.TraceContext{}
+)
+
+// SetTracePropagator replaces the propagator that carries the trace context in message headers.
+// The default writes the W3C traceparent and tracestate headers.
+func SetTracePropagator(p propagation.TextMapPropagator) {
+	propagatorMu.Lock()
+	defer propagatorMu.Unlock()
+	tracePropagator = p
+}
+
+func getTracePropagator() propagation.TextMapPropagator {
+	propagatorMu.RLock()
+	defer propagatorMu.RUnlock()
+	return tracePropagator
+}
+
 // GetMQHeaderWithContext extracts message queue headers from the context.
+// Besides the mcontext values it carries the custom keys listed under constant.RpcCustomHeader
+// and the trace context.
 func GetMQHeaderWithContext(ctx context.Context) ([]sarama.RecordHeader, error) {
 	operationID, opUserID, platform, connID, err := mcontext.GetCtxInfos(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return []sarama.RecordHeader{
+	header := []sarama.RecordHeader{
 		{Key: []byte(constant.OperationID), Value: []byte(operationID)},
 		{Key: []byte(constant.OpUserID), Value: []byte(opUserID)},
 		{Key: []byte(constant.OpUserPlatform), Value: []byte(platform)},
 		{Key: []byte(constant.ConnID), Value: []byte(connID)},
-	}, nil
+	}
+	if keys, _ := ctx.Value(constant.RpcCustomHeader).([]string); len(keys) > 0 {
+		for _, key := range keys {
+			values, ok := ctx.Value(key).([]string)
+			if !ok || len(values) == 0 {
+				return nil, errs.ErrInternalServer.WrapMsg("ctx missing key", "key", key)
+			}
+			header = append(header, sarama.RecordHeader{Key: []byte(constant.RpcCustomHeader), Value: []byte(key)})
+			for _, value := range values {
+				header = append(header, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+			}
+		}
+	}
+	getTracePropagator().Inject(ctx, &producerCarrier{header: &header})
+	return header, nil
 }
 
-// GetContextWithMQHeader creates a context from message queue headers.
+// GetContextWithMQHeader creates a context from message queue headers, looking the values up by key.
 func GetContextWithMQHeader(header []*sarama.RecordHeader) context.Context {
-	var values []string
+	values := make(consumerCarrier, len(header))
 	for _, recordHeader := range header {
-		values = append(values, string(recordHeader.Value))
+		key := string(recordHeader.Key)
+		values[key] = append(values[key], string(recordHeader.Value))
+	}
+	ctx := context.Background()
+	for _, key := range []string{constant.OperationID, constant.OpUserID, constant.OpUserPlatform, constant.ConnID} {
+		if v, ok := values[key]; ok {
+			ctx = context.WithValue(ctx, key, v[0])
+		}
+	}
+	if keys := values[constant.RpcCustomHeader]; len(keys) > 0 {
+		ctx = context.WithValue(ctx, constant.RpcCustomHeader, keys)
+		for _, key := range keys {
+			ctx = context.WithValue(ctx, key, values[key])
+		}
+	}
+	return getTracePropagator().Extract(ctx, values)
+}
+
+// producerCarrier exposes record headers to a propagator.
+type producerCarrier struct {
+	header *[]sarama.RecordHeader
+}
+
+func (c *producerCarrier) Get(key string) string {
+	for _, h := range *c.header {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c *producerCarrier) Set(key, value string) {
+	for i, h := range *c.header {
+		if string(h.Key) == key {
+			(*c.header)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.header = append(*c.header, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c *producerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.header))
+	for _, h := range *c.header {
+		keys = append(keys, string(h.Key))
+	}
+	return keys
+}
+
+// consumerCarrier holds the decoded headers of a consumed message.
+type consumerCarrier map[string][]string
+
+func (c consumerCarrier) Get(key string) string {
+	if values := c[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c consumerCarrier) Set(key, value string) {
+	c[key] = []string{value}
+}
+
+func (c consumerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
 	}
-	return mcontext.WithMustInfoCtx(values) // Attach extracted values to context
+	return keys
 }
@@ -0,0 +1,65 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func toConsumerHeaders(header []sarama.RecordHeader) []*sarama.RecordHeader {
+	res := make([]*sarama.RecordHeader, len(header))
+	for i := range header {
+		res[i] = &header[i]
+	}
+	return res
+}
+
+func TestMQHeaderRoundTrip(t *testing.T) {
+	ctx := mcontext.NewCtx("op")
+	ctx = mcontext.SetOpUserID(ctx, "user")
+	ctx = context.WithValue(ctx, constant.RpcCustomHeader, []string{"tenant"})
+	ctx = context.WithValue(ctx, "tenant", []string{"a", "b"})
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx = trace.ContextWithSpanContext(ctx, spanCtx)
+
+	header, err := GetMQHeaderWithContext(ctx)
+	assert.NoError(t, err)
+	// Unknown headers, such as the ones added to dead letters, must not disturb decoding.
+	header = append([]sarama.RecordHeader{{Key: []byte(DLQHeaderError), Value: []byte("failed")}}, header...)
+
+	decoded := GetContextWithMQHeader(toConsumerHeaders(header))
+	assert.Equal(t, "op", mcontext.GetOperationID(decoded))
+	assert.Equal(t, "user", mcontext.GetOpUserID(decoded))
+	assert.Equal(t, []string{"tenant"}, decoded.Value(constant.RpcCustomHeader))
+	assert.Equal(t, []string{"a", "b"}, decoded.Value("tenant"))
+
+	remote := trace.SpanContextFromContext(decoded)
+	assert.True(t, remote.IsRemote())
+	assert.Equal(t, spanCtx.TraceID(), remote.TraceID())
+	assert.Equal(t, spanCtx.SpanID(), remote.SpanID())
+
+	_, err = GetMQHeaderWithContext(context.WithValue(mcontext.NewCtx("op"), constant.RpcCustomHeader, []string{"missing"}))
+	assert.Error(t, err)
+}
+
+func TestSetTracePropagator(t *testing.T) {
+	defer SetTracePropagator(propagation.TraceContext{})
+	SetTracePropagator(propagation.Baggage{})
+
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}})
+	header, err := GetMQHeaderWithContext(trace.ContextWithSpanContext(mcontext.NewCtx("op"), spanCtx))
+	assert.NoError(t, err)
+	for _, h := range header {
+		assert.NotEqual(t, "traceparent", string(h.Key))
+	}
+}
@@ -0,0 +1,199 @@
+package memamq
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/log"
+)
+
+// DelayTask is a task scheduled on a DelayQueue.
+type DelayTask struct {
+	dq    *DelayQueue
+	at    time.Time
+	seq   uint64
+	fn    func()
+	opts  []TaskOption
+	index int // position in the heap, -1 once the task fired, was canceled or dropped
+}
+
+// When returns the time the task is due.
+func (t *DelayTask) When() time.Time {
+	return t.at
+}
+
+// Cancel removes the task if it has not been handed to the queue yet and reports whether it did.
+func (t *DelayTask) Cancel() bool {
+	t.dq.mu.Lock()
+	defer t.dq.mu.Unlock()
+	if t.index < 0 {
+		return false
+	}
+	heap.Remove(&t.dq.tasks, t.index)
+	return true
+}
+
+type taskHeap []*DelayTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x any) {
+	t := x.(*DelayTask)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *taskHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	t.index = -1
+	return t
+}
+
+// DelayQueue holds tasks until they are due and then pushes them to a MemoryQueue, which
+// runs them on its workers. Tasks due at the same time are pushed in scheduling order.
+type DelayQueue struct {
+	queue   *MemoryQueue
+	mu      sync.Mutex
+	tasks   taskHeap
+	seq     uint64
+	stopped bool
+	wake    chan struct{}
+	// ctx is canceled by Stop, releasing the loop when it is blocked on a full lane.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDelayQueue creates a delay queue feeding queue. Stopping the delay queue leaves queue running.
+func NewDelayQueue(queue *MemoryQueue) *DelayQueue {
+	dq := &DelayQueue{
+		queue: queue,
+		wake:  make(chan struct{}, 1),
+	}
+	dq.ctx, dq.cancel = context.WithCancel(context.Background())
+	dq.wg.Add(1)
+	go dq.loop()
+	return dq
+}
+
+// PushAfter schedules task to run after delay.
+func (dq *DelayQueue) PushAfter(delay time.Duration, task func(), opts ...TaskOption) (*DelayTask, error) {
+	return dq.PushAt(time.Now().Add(delay), task, opts...)
+}
+
+// PushAt schedules task to run at at. A time in the past makes it due immediately.
+// The options are applied when the task is pushed to the MemoryQueue.
+func (dq *DelayQueue) PushAt(at time.Time, task func(), opts ...TaskOption) (*DelayTask, error) {
+	dq.mu.Lock()
+	if dq.stopped {
+		dq.mu.Unlock()
+		return nil, ErrStop
+	}
+	dq.seq++
+	t := &DelayTask{dq: dq, at: at, seq: dq.seq, fn: task, opts: opts}
+	heap.Push(&dq.tasks, t)
+	first := t.index == 0
+	dq.mu.Unlock()
+	if first {
+		select {
+		case dq.wake <- struct{}{}:
+		default:
+		}
+	}
+	return t, nil
+}
+
+// Len returns the number of pending tasks.
+func (dq *DelayQueue) Len() int {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+	return len(dq.tasks)
+}
+
+func (dq *DelayQueue) loop() {
+	defer dq.wg.Done()
+	for {
+		dq.mu.Lock()
+		var due *DelayTask
+		wait := time.Hour
+		if len(dq.tasks) > 0 {
+			if wait = time.Until(dq.tasks[0].at); wait <= 0 {
+				due = heap.Pop(&dq.tasks).(*DelayTask)
+			}
+		}
+		dq.mu.Unlock()
+		if due != nil {
+			if err := dq.dispatch(dq.ctx, due); err != nil && dq.ctx.Err() != nil {
+				// Stop interrupted the push, the task is left to Stop.
+				dq.mu.Lock()
+				heap.Push(&dq.tasks, due)
+				dq.mu.Unlock()
+				return
+			}
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-dq.ctx.Done():
+			timer.Stop()
+			return
+		case <-dq.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (dq *DelayQueue) dispatch(ctx context.Context, t *DelayTask) error {
+	err := dq.queue.PushTask(ctx, t.fn, t.opts...)
+	if err != nil && ctx.Err() == nil {
+		log.ZWarn(ctx, "delay queue push failed, task dropped", err, "when", t.at)
+	}
+	return err
+}
+
+// Stop stops scheduling. With drain the pending tasks are pushed to the MemoryQueue right away,
+// otherwise they are discarded. A task the loop could not push yet because its lane is full counts
+// as pending. It returns the number of pending tasks it drained or discarded.
+func (dq *DelayQueue) Stop(drain bool) int {
+	dq.mu.Lock()
+	if dq.stopped {
+		dq.mu.Unlock()
+		return 0
+	}
+	dq.stopped = true
+	dq.mu.Unlock()
+	dq.cancel()
+	dq.wg.Wait()
+
+	dq.mu.Lock()
+	pending := make([]*DelayTask, 0, len(dq.tasks))
+	for len(dq.tasks) > 0 {
+		pending = append(pending, heap.Pop(&dq.tasks).(*DelayTask))
+	}
+	dq.mu.Unlock()
+	if drain {
+		for _, t := range pending {
+			_ = dq.dispatch(context.Background(), t)
+		}
+	}
+	return len(pending)
+}
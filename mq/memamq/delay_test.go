@@ -0,0 +1,120 @@
+package memamq
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mu   sync.Mutex
+	runs []int
+}
+
+func (r *recorder) task(i int) func() {
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.runs = append(r.runs, i)
+	}
+}
+
+func (r *recorder) get() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.runs...)
+}
+
+func TestDelayQueueOrder(t *testing.T) {
+	queue := NewMemoryQueue(1, 16)
+	defer queue.Stop()
+	dq := NewDelayQueue(queue)
+	defer dq.Stop(false)
+
+	rec := &recorder{}
+	now := time.Now()
+	_, err := dq.PushAt(now.Add(60*time.Millisecond), rec.task(3))
+	assert.NoError(t, err)
+	_, err = dq.PushAfter(20*time.Millisecond, rec.task(1))
+	assert.NoError(t, err)
+	_, err = dq.PushAt(now.Add(40*time.Millisecond), rec.task(2))
+	assert.NoError(t, err)
+	_, err = dq.PushAt(now.Add(-time.Second), rec.task(0))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return len(rec.get()) == 4 }, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []int{0, 1, 2, 3}, rec.get())
+	assert.Equal(t, 0, dq.Len())
+}
+
+func TestDelayQueueCancel(t *testing.T) {
+	queue := NewMemoryQueue(1, 16)
+	defer queue.Stop()
+	dq := NewDelayQueue(queue)
+	defer dq.Stop(false)
+
+	rec := &recorder{}
+	canceled, err := dq.PushAfter(30*time.Millisecond, rec.task(1))
+	assert.NoError(t, err)
+	kept, err := dq.PushAfter(30*time.Millisecond, rec.task(2))
+	assert.NoError(t, err)
+	assert.True(t, canceled.Cancel())
+	assert.False(t, canceled.Cancel())
+
+	assert.Eventually(t, func() bool { return len(rec.get()) == 1 }, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []int{2}, rec.get())
+	assert.False(t, kept.Cancel(), "a fired task cannot be canceled")
+}
+
+func TestDelayQueueStop(t *testing.T) {
+	queue := NewMemoryQueue(1, 16)
+	defer queue.Stop()
+
+	rec := &recorder{}
+	discard := NewDelayQueue(queue)
+	_, err := discard.PushAfter(time.Hour, rec.task(1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, discard.Stop(false))
+	_, err = discard.PushAfter(time.Millisecond, rec.task(1))
+	assert.ErrorIs(t, err, ErrStop)
+
+	drain := NewDelayQueue(queue)
+	_, err = drain.PushAfter(2*time.Hour, rec.task(3))
+	assert.NoError(t, err)
+	_, err = drain.PushAfter(time.Hour, rec.task(2))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, drain.Stop(true))
+	assert.Equal(t, 0, drain.Stop(true))
+
+	assert.Eventually(t, func() bool { return len(rec.get()) == 2 }, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []int{2, 3}, rec.get())
+}
+
+func TestDelayQueueStopBlockedDispatch(t *testing.T) {
+	queue := NewMemoryQueue(1, 1)
+	defer queue.Stop()
+	gate := make(chan struct{})
+	defer close(gate)
+	started := make(chan struct{})
+	assert.NoError(t, queue.Push(func() { close(started); <-gate }))
+	<-started
+	assert.NoError(t, queue.Push(func() {}))
+
+	rec := &recorder{}
+	dq := NewDelayQueue(queue)
+	_, err := dq.PushAfter(0, rec.task(1))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return dq.Len() == 0 }, 10*time.Second, 5*time.Millisecond)
+
+	stopped := make(chan int, 1)
+	go func() { stopped <- dq.Stop(false) }()
+	select {
+	case n := <-stopped:
+		assert.Equal(t, 1, n, "the blocked task is discarded")
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	assert.Empty(t, rec.get())
+}
@@ -6,6 +6,9 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/openimsdk/tools/mw"
+	"github.com/openimsdk/tools/utils/stringutil"
 )
 
 var (
@@ -24,12 +27,18 @@ const (
 //}
 
 // MemoryQueue is an implementation of the AsyncQueue interface using a channel to process functions.
+// Every worker serves the priority lanes shared by all workers and its own lane of keyed tasks.
 type MemoryQueue struct {
-	taskChan  chan func()
+	lanes     [priorityCount]chan *task
+	keyed     []chan *task // keyed tasks, one lane per worker
 	wg        sync.WaitGroup
 	isStopped atomic.Bool
-	count     atomic.Int64
-	//stopMutex sync.Mutex // Mutex to protect access to isStopped
+	// stop is closed by Stop before it takes pushMu, releasing pushers blocked on a full lane.
+	stop chan struct{}
+	// pushMu is held for reading while sending, Stop takes it for writing before closing the
+	// lanes. A waiting writer blocks new readers, so pushers that keep retrying cannot starve Stop.
+	pushMu sync.RWMutex
+	stats  counters
 }
 
 func NewMemoryQueue(workerCount int, bufferSize int) *MemoryQueue {
@@ -44,100 +53,220 @@ func NewMemoryQueue(workerCount int, bufferSize int) *MemoryQueue {
 // Initialize sets up the worker nodes and the buffer size of the channel,
 // starting internal goroutines to handle tasks from the channel.
 func (mq *MemoryQueue) initialize(workerCount int, bufferSize int) {
-	mq.taskChan = make(chan func(), bufferSize) // Initialize the channel with the provided buffer size.
+	mq.stop = make(chan struct{})
+	for i := range mq.lanes {
+		mq.lanes[i] = make(chan *task, bufferSize) // Initialize the channels with the provided buffer size.
+	}
+	mq.keyed = make([]chan *task, workerCount)
 	// Start multiple goroutines based on the specified workerCount.
 	for i := 0; i < workerCount; i++ {
+		mq.keyed[i] = make(chan *task, bufferSize)
 		mq.wg.Add(1)
-		go func() {
+		go func(i int) {
 			defer mq.wg.Done()
-			for task := range mq.taskChan {
-				task() // Execute the function
+			// Lanes in the order they are served.
+			lanes := []chan *task{mq.lanes[PriorityHigh], mq.keyed[i], mq.lanes[PriorityNormal], mq.lanes[PriorityLow]}
+			for {
+				t, ok := next(lanes)
+				if !ok {
+					return
+				}
+				mq.run(t) // Execute the function
+			}
+		}(i)
+	}
+}
+
+// next returns a task of the first lane that has one, waiting on all lanes when they are empty.
+// Closed lanes are set to nil, it reports false once every lane is closed and drained.
+func next(lanes []chan *task) (*task, bool) {
+	for {
+		open := false
+		for i, lane := range lanes {
+			if lane == nil {
+				continue
 			}
-		}()
+			select {
+			case t, ok := <-lane:
+				if ok {
+					return t, true
+				}
+				lanes[i] = nil
+			default:
+				open = true
+			}
+		}
+		if !open {
+			return nil, false
+		}
+		var (
+			t     *task
+			ok    bool
+			index int
+		)
+		select {
+		case t, ok = <-lanes[0]:
+		case t, ok = <-lanes[1]:
+			index = 1
+		case t, ok = <-lanes[2]:
+			index = 2
+		case t, ok = <-lanes[3]:
+			index = 3
+		}
+		if ok {
+			return t, true
+		}
+		lanes[index] = nil
+	}
+}
+
+// run executes a task, logging a panic instead of letting it kill the worker.
+func (mq *MemoryQueue) run(t *task) {
+	mq.stats.queued.Add(-1)
+	mq.stats.running.Add(1)
+	defer func() {
+		if r := recover(); r != nil {
+			mq.stats.panicked.Add(1)
+			mw.PanicStackToLog(t.ctx, r)
+		}
+		mq.stats.running.Add(-1)
+		mq.stats.completed.Add(1)
+		mq.stats.observe(time.Since(t.enqueued))
+	}()
+	t.fn()
+}
+
+func newTask(ctx context.Context, fn func()) *task {
+	return &task{fn: fn, ctx: ctx, enqueued: time.Now()}
+}
+
+// reject records a failed push. Tasks count as queued before they are sent, so a worker
+// can never see the counter go negative.
+func (mq *MemoryQueue) reject(err error, queued bool) error {
+	if queued {
+		mq.stats.queued.Add(-1)
+	}
+	mq.stats.rejected.Add(1)
+	return err
+}
+
+// beginPush takes pushMu for reading unless the queue is stopped. A stopped queue is detected
+// before locking, so pushers do not queue up behind Stop.
+func (mq *MemoryQueue) beginPush() bool {
+	if mq.isStopped.Load() {
+		return false
+	}
+	mq.pushMu.RLock()
+	if mq.isStopped.Load() {
+		mq.pushMu.RUnlock()
+		return false
 	}
+	return true
 }
 
 // Push submits a function to the queue.
 // Returns an error if the queue is stopped or if the queue is full.
 func (mq *MemoryQueue) Push(task func()) error {
-	mq.count.Add(1)
-	defer mq.count.Add(-1)
-	if mq.isStopped.Load() {
-		return ErrStop
+	if !mq.beginPush() {
+		return mq.reject(ErrStop, false)
 	}
+	defer mq.pushMu.RUnlock()
 	timer := time.NewTimer(pushWait)
 	defer timer.Stop()
+	mq.stats.queued.Add(1)
 	select {
-	case mq.taskChan <- task:
+	case mq.lanes[PriorityNormal] <- newTask(context.Background(), task):
 		return nil
 	case <-timer.C: // Timeout to prevent deadlock/blocking
-		return ErrFull
+		return mq.reject(ErrFull, true)
+	case <-mq.stop:
+		return mq.reject(ErrStop, true)
 	}
 }
 
 func (mq *MemoryQueue) PushCtx(ctx context.Context, task func()) error {
-	mq.count.Add(1)
-	defer mq.count.Add(-1)
-	if mq.isStopped.Load() {
-		return ErrStop
+	return mq.PushTask(ctx, task)
+}
+
+// PushTask submits a function with options, waiting for room in its lane until ctx is done.
+func (mq *MemoryQueue) PushTask(ctx context.Context, task func(), opts ...TaskOption) error {
+	if !mq.beginPush() {
+		return mq.reject(ErrStop, false)
 	}
+	defer mq.pushMu.RUnlock()
+	mq.stats.queued.Add(1)
 	select {
-	case mq.taskChan <- task:
+	case mq.lane(opts) <- newTask(ctx, task):
 		return nil
 	case <-ctx.Done():
-		return context.Cause(ctx)
+		return mq.reject(context.Cause(ctx), true)
+	case <-mq.stop:
+		return mq.reject(ErrStop, true)
+	}
+}
+
+func (mq *MemoryQueue) lane(opts []TaskOption) chan *task {
+	o := taskOptions{priority: PriorityNormal}
+	for _, opt := range opts {
+		opt(&o)
 	}
+	if o.keyed {
+		return mq.keyed[stringutil.GetHashCode(o.key)%uint32(len(mq.keyed))]
+	}
+	return mq.lanes[o.priority]
 }
 
 func (mq *MemoryQueue) BatchPushCtx(ctx context.Context, tasks ...func()) (int, error) {
-	mq.count.Add(1)
-	defer mq.count.Add(-1)
-	if mq.isStopped.Load() {
-		return 0, ErrStop
+	if !mq.beginPush() {
+		return 0, mq.reject(ErrStop, false)
 	}
+	defer mq.pushMu.RUnlock()
 	for i := range tasks {
+		mq.stats.queued.Add(1)
 		select {
 		case <-ctx.Done():
-			return i, context.Cause(ctx)
-		case mq.taskChan <- tasks[i]:
+			return i, mq.reject(context.Cause(ctx), true)
+		case <-mq.stop:
+			return i, mq.reject(ErrStop, true)
+		case mq.lanes[PriorityNormal] <- newTask(ctx, tasks[i]):
 		}
 	}
 	return len(tasks), nil
 }
 
 func (mq *MemoryQueue) NotWaitPush(task func()) error {
-	mq.count.Add(1)
-	defer mq.count.Add(-1)
-	if mq.isStopped.Load() {
-		return ErrStop
+	if !mq.beginPush() {
+		return mq.reject(ErrStop, false)
 	}
+	defer mq.pushMu.RUnlock()
+	mq.stats.queued.Add(1)
 	select {
-	case mq.taskChan <- task:
+	case mq.lanes[PriorityNormal] <- newTask(context.Background(), task):
 		return nil
 	default:
-		return ErrFull
+		return mq.reject(ErrFull, true)
 	}
 }
 
+// Stats returns a snapshot of the queue counters.
+func (mq *MemoryQueue) Stats() Stats {
+	return mq.stats.snapshot()
+}
+
 // Stop is used to terminate the internal goroutines and close the channel.
+// Pushes waiting for room in a lane fail with ErrStop, queued tasks still run.
 func (mq *MemoryQueue) Stop() {
 	if !mq.isStopped.CompareAndSwap(false, true) {
 		return
 	}
-	mq.waitSafeClose()
-	close(mq.taskChan)
-	mq.wg.Wait()
-}
-
-func (mq *MemoryQueue) waitSafeClose() {
-	if mq.count.Load() == 0 {
-		return
+	close(mq.stop)
+	mq.pushMu.Lock()
+	for _, lane := range mq.lanes {
+		close(lane)
 	}
-	ticker := time.NewTicker(time.Second / 10)
-	defer ticker.Stop()
-	for range ticker.C {
-		if mq.count.Load() == 0 {
-			return
-		}
+	for _, lane := range mq.keyed {
+		close(lane)
 	}
+	mq.pushMu.Unlock()
+	mq.wg.Wait()
 }
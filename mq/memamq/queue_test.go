@@ -1,12 +1,27 @@
 package memamq
 
 import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/openimsdk/tools/log"
+	"github.com/stretchr/testify/assert"
 )
 
+func TestMain(m *testing.M) {
+	// Log to stdout only instead of the ./logs directory of the default logger.
+	if err := log.InitLoggerFromConfig("test", "memamq", "", "", log.LevelDebug, true, false, "", 1, 24, "test", false); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
 //func TestNewMemoryQueue(t *testing.T) {
 //	workerCount := 3
 //	bufferSize := 10
@@ -80,3 +95,129 @@ func TestName(t *testing.T) {
 	t.Log("stop 2", time.Now())
 	t.Log(count.Load(), time.Now())
 }
+
+func TestPriorityLanes(t *testing.T) {
+	queue := NewMemoryQueue(1, 8)
+	ctx := context.Background()
+	gate := make(chan struct{})
+	queue.Push(func() { <-gate })
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+	queue.PushTask(ctx, record("low"), WithPriority(PriorityLow))
+	queue.PushTask(ctx, record("normal"))
+	queue.PushTask(ctx, record("keyed"), WithKey("conversation"))
+	queue.PushTask(ctx, record("high"), WithPriority(PriorityHigh))
+	close(gate)
+	queue.Stop()
+
+	assert.Equal(t, []string{"high", "keyed", "normal", "low"}, order)
+}
+
+func TestKeyedOrder(t *testing.T) {
+	queue := NewMemoryQueue(8, 64)
+	ctx := context.Background()
+	const keys, perKey = 16, 50
+
+	var mu sync.Mutex
+	seen := make(map[string][]int)
+	var running sync.Map
+	for i := 0; i < perKey; i++ {
+		for k := 0; k < keys; k++ {
+			key, seq := strconv.Itoa(k), i
+			err := queue.PushTask(ctx, func() {
+				if _, busy := running.LoadOrStore(key, true); busy {
+					t.Errorf("tasks of key %s overlap", key)
+				}
+				mu.Lock()
+				seen[key] = append(seen[key], seq)
+				mu.Unlock()
+				running.Delete(key)
+			}, WithKey(key))
+			assert.NoError(t, err)
+		}
+	}
+	queue.Stop()
+
+	for k := 0; k < keys; k++ {
+		got := seen[strconv.Itoa(k)]
+		assert.Len(t, got, perKey)
+		assert.True(t, sort.IntsAreSorted(got), "key %d ran out of order", k)
+	}
+}
+
+func TestPanicRecoveryAndStats(t *testing.T) {
+	queue := NewMemoryQueue(1, 1)
+	gate := make(chan struct{})
+	assert.NoError(t, queue.Push(func() { <-gate }))
+	assert.NoError(t, queue.Push(func() { panic("boom") }))
+	assert.ErrorIs(t, queue.NotWaitPush(func() {}), ErrFull)
+
+	stats := queue.Stats()
+	assert.Equal(t, int64(1), stats.Running)
+	assert.Equal(t, int64(1), stats.Queued)
+	assert.Equal(t, int64(1), stats.Rejected)
+
+	close(gate)
+	var done sync.WaitGroup
+	done.Add(1)
+	assert.NoError(t, queue.Push(done.Done))
+	done.Wait()
+	queue.Stop()
+
+	stats = queue.Stats()
+	assert.Equal(t, int64(3), stats.Completed)
+	assert.Equal(t, int64(1), stats.Panicked)
+	assert.Zero(t, stats.Queued)
+	assert.Zero(t, stats.Running)
+	assert.Greater(t, stats.MaxLatency, time.Duration(0))
+	assert.ErrorIs(t, queue.Push(func() {}), ErrStop)
+	assert.Equal(t, int64(2), queue.Stats().Rejected)
+}
+
+func TestStopReleasesBlockedPush(t *testing.T) {
+	queue := NewMemoryQueue(1, 1)
+	ctx := context.Background()
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	assert.NoError(t, queue.PushCtx(ctx, func() { close(started); <-gate }))
+	<-started
+	assert.NoError(t, queue.PushCtx(ctx, func() {}))
+
+	pushed := make(chan error, 2)
+	go func() { pushed <- queue.PushCtx(ctx, func() {}) }()
+	go func() {
+		_, err := queue.BatchPushCtx(ctx, func() {})
+		pushed <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		queue.Stop()
+		close(stopped)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-pushed:
+			assert.ErrorIs(t, err, ErrStop)
+		case <-time.After(10 * time.Second):
+			t.Fatal("blocked push not released by Stop")
+		}
+	}
+	close(gate)
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	assert.Equal(t, int64(2), queue.Stats().Completed)
+	assert.Zero(t, queue.Stats().Queued)
+}
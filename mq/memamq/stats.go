@@ -0,0 +1,54 @@
+package memamq
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the counters of a MemoryQueue.
+type Stats struct {
+	Queued    int64 // accepted tasks that have not started yet
+	Running   int64 // tasks being executed
+	Rejected  int64 // pushes that failed because the queue was stopped, full or the context ended
+	Completed int64 // finished tasks, including the ones that panicked
+	Panicked  int64 // tasks that panicked
+	// AvgLatency is the average time from push to completion of the completed tasks.
+	AvgLatency time.Duration
+	// MaxLatency is the longest time from push to completion of a task.
+	MaxLatency time.Duration
+}
+
+type counters struct {
+	queued       atomic.Int64
+	running      atomic.Int64
+	rejected     atomic.Int64
+	completed    atomic.Int64
+	panicked     atomic.Int64
+	totalLatency atomic.Int64
+	maxLatency   atomic.Int64
+}
+
+func (c *counters) observe(latency time.Duration) {
+	c.totalLatency.Add(int64(latency))
+	for {
+		max := c.maxLatency.Load()
+		if int64(latency) <= max || c.maxLatency.CompareAndSwap(max, int64(latency)) {
+			return
+		}
+	}
+}
+
+func (c *counters) snapshot() Stats {
+	stats := Stats{
+		Queued:     c.queued.Load(),
+		Running:    c.running.Load(),
+		Rejected:   c.rejected.Load(),
+		Completed:  c.completed.Load(),
+		Panicked:   c.panicked.Load(),
+		MaxLatency: time.Duration(c.maxLatency.Load()),
+	}
+	if stats.Completed > 0 {
+		stats.AvgLatency = time.Duration(c.totalLatency.Load() / stats.Completed)
+	}
+	return stats
+}
@@ -0,0 +1,51 @@
+package memamq
+
+import (
+	"context"
+	"time"
+)
+
+// Priority selects the lane of a task. Workers always take waiting tasks of a higher lane first.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	priorityCount = iota
+)
+
+type task struct {
+	fn       func()
+	ctx      context.Context
+	enqueued time.Time
+}
+
+type taskOptions struct {
+	priority Priority
+	key      string
+	keyed    bool
+}
+
+// TaskOption configures a task pushed with PushTask.
+type TaskOption func(*taskOptions)
+
+// WithPriority puts the task in the given lane. The default is PriorityNormal.
+func WithPriority(priority Priority) TaskOption {
+	return func(o *taskOptions) {
+		if priority >= PriorityLow && priority <= PriorityHigh {
+			o.priority = priority
+		}
+	}
+}
+
+// WithKey runs the task after every task pushed before it with the same key, for example a
+// conversationID. Tasks with different keys still run in parallel. Keyed tasks are served
+// between the high and the normal lane and ignore WithPriority, so their order is kept.
+func WithKey(key string) TaskOption {
+	return func(o *taskOptions) {
+		o.key = key
+		o.keyed = true
+	}
+}
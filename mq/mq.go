@@ -0,0 +1,81 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mq defines the producer and consumer interfaces implemented by the message queue
+// backends: mq/kafka, mq/simmq for in-process use and mq/redismq for Redis Streams.
+package mq
+
+import (
+	"context"
+	"errors"
+
+	"github.com/openimsdk/protocol/constant"
+)
+
+// ErrClosed is returned when using a closed producer or consumer.
+var ErrClosed = errors.New("mq: closed")
+
+// Producer sends messages to one topic.
+type Producer interface {
+	// SendMessage sends value with key. The mcontext values of ctx travel in the headers.
+	SendMessage(ctx context.Context, key string, value []byte) error
+	Close() error
+}
+
+// Message is a message delivered to a Handler.
+type Message interface {
+	// Context carries the mcontext values of the producer.
+	Context() context.Context
+	Key() string
+	Value() []byte
+	Headers() map[string]string
+	// Ack marks the message as processed. Backends deliver messages that were never
+	// acknowledged again, how soon depends on the backend.
+	Ack() error
+}
+
+// Handler processes a message. A returned error is logged, the message is only
+// acknowledged by calling Ack.
+type Handler func(ctx context.Context, msg Message) error
+
+// Consumer receives the messages of one topic as a member of a consumer group.
+type Consumer interface {
+	// Subscribe calls handler for each message until ctx is done or the consumer is closed.
+	Subscribe(ctx context.Context, handler Handler) error
+	Close() error
+}
+
+var contextKeys = []string{constant.OperationID, constant.OpUserID, constant.OpUserPlatform, constant.ConnID}
+
+// HeadersFromContext returns the mcontext values of ctx as message headers.
+func HeadersFromContext(ctx context.Context) map[string]string {
+	headers := make(map[string]string, len(contextKeys))
+	for _, key := range contextKeys {
+		if value, ok := ctx.Value(key).(string); ok && value != "" {
+			headers[key] = value
+		}
+	}
+	return headers
+}
+
+// ContextFromHeaders rebuilds the mcontext values of message headers.
+func ContextFromHeaders(headers map[string]string) context.Context {
+	ctx := context.Background()
+	for _, key := range contextKeys {
+		if value, ok := headers[key]; ok {
+			ctx = context.WithValue(ctx, key, value)
+		}
+	}
+	return ctx
+}
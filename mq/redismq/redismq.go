@@ -0,0 +1,277 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redismq implements the mq interfaces on Redis Streams. Each topic is a stream and
+// each consumer group a stream consumer group, messages left pending by a crashed consumer
+// are reclaimed by the other consumers of the group.
+package redismq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mq"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	fieldKey     = "key"
+	fieldValue   = "value"
+	headerPrefix = "h:"
+)
+
+type producerOptions struct {
+	maxLen int64
+}
+
+type ProducerOption func(*producerOptions)
+
+// WithMaxLen caps the stream at about maxLen entries, trimming the oldest ones.
+func WithMaxLen(maxLen int64) ProducerOption {
+	return func(o *producerOptions) {
+		o.maxLen = maxLen
+	}
+}
+
+type producer struct {
+	rdb    redis.UniversalClient
+	stream string
+	opts   producerOptions
+}
+
+// NewProducer returns a producer appending to stream.
+func NewProducer(rdb redis.UniversalClient, stream string, opts ...ProducerOption) mq.Producer {
+	p := &producer{rdb: rdb, stream: stream}
+	for _, opt := range opts {
+		opt(&p.opts)
+	}
+	return p
+}
+
+func (p *producer) SendMessage(ctx context.Context, key string, value []byte) error {
+	headers := mq.HeadersFromContext(ctx)
+	values := make([]any, 0, 4+2*len(headers))
+	values = append(values, fieldKey, key, fieldValue, value)
+	for k, v := range headers {
+		values = append(values, headerPrefix+k, v)
+	}
+	args := &redis.XAddArgs{Stream: p.stream, Values: values}
+	if p.opts.maxLen > 0 {
+		args.MaxLen = p.opts.maxLen
+		args.Approx = true
+	}
+	if err := p.rdb.XAdd(ctx, args).Err(); err != nil {
+		return errs.WrapMsg(err, "XAdd failed", "stream", p.stream)
+	}
+	return nil
+}
+
+func (p *producer) Close() error {
+	return nil
+}
+
+type consumerOptions struct {
+	batchSize       int64
+	block           time.Duration
+	minIdle         time.Duration
+	reclaimInterval time.Duration
+}
+
+type ConsumerOption func(*consumerOptions)
+
+// WithBatchSize sets how many messages are read per request. The default is 16.
+func WithBatchSize(size int64) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.batchSize = size
+	}
+}
+
+// WithBlock sets how long a read waits for new messages. The default is 2s.
+func WithBlock(block time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.block = block
+	}
+}
+
+// WithReclaim sets how long a message stays pending before another consumer claims it and
+// how often pending messages are checked. The default is 1m, checked every 30s.
+func WithReclaim(minIdle, interval time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.minIdle = minIdle
+		o.reclaimInterval = interval
+	}
+}
+
+type consumer struct {
+	rdb       redis.UniversalClient
+	stream    string
+	group     string
+	name      string
+	opts      consumerOptions
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewConsumer joins consumer group of stream as name, creating the stream and the group when
+// missing. A new group receives the messages added after its creation.
+func NewConsumer(ctx context.Context, rdb redis.UniversalClient, stream, group, name string, opts ...ConsumerOption) (mq.Consumer, error) {
+	c := &consumer{
+		rdb:    rdb,
+		stream: stream,
+		group:  group,
+		name:   name,
+		opts: consumerOptions{
+			batchSize:       16,
+			block:           2 * time.Second,
+			minIdle:         time.Minute,
+			reclaimInterval: 30 * time.Second,
+		},
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	err := rdb.XGroupCreateMkStream(ctx, stream, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, errs.WrapMsg(err, "XGroupCreateMkStream failed", "stream", stream, "group", group)
+	}
+	return c, nil
+}
+
+func (c *consumer) Subscribe(ctx context.Context, handler mq.Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var lastReclaim time.Time
+	for ctx.Err() == nil {
+		if time.Since(lastReclaim) >= c.opts.reclaimInterval {
+			c.reclaim(ctx, handler)
+			lastReclaim = time.Now()
+		}
+		streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.name,
+			Streams:  []string{c.stream, ">"},
+			Count:    c.opts.batchSize,
+			Block:    c.opts.block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.ZWarn(ctx, "XReadGroup failed", err, "stream", c.stream, "group", c.group)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				c.handle(handler, msg)
+			}
+		}
+	}
+	return nil
+}
+
+// reclaim claims the messages that other consumers left pending for longer than minIdle.
+func (c *consumer) reclaim(ctx context.Context, handler mq.Handler) {
+	start := "0-0"
+	for {
+		msgs, next, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			MinIdle:  c.opts.minIdle,
+			Start:    start,
+			Count:    c.opts.batchSize,
+			Consumer: c.name,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.ZWarn(ctx, "XAutoClaim failed", err, "stream", c.stream, "group", c.group)
+			}
+			return
+		}
+		for _, msg := range msgs {
+			c.handle(handler, msg)
+		}
+		if next == "0-0" || next == "" {
+			return
+		}
+		start = next
+	}
+}
+
+func (c *consumer) handle(handler mq.Handler, msg redis.XMessage) {
+	m := &message{consumer: c, id: msg.ID, headers: make(map[string]string)}
+	for field, value := range msg.Values {
+		s, _ := value.(string)
+		switch {
+		case field == fieldKey:
+			m.key = s
+		case field == fieldValue:
+			m.value = []byte(s)
+		case strings.HasPrefix(field, headerPrefix):
+			m.headers[strings.TrimPrefix(field, headerPrefix)] = s
+		}
+	}
+	m.ctx = mq.ContextFromHeaders(m.headers)
+	if err := handler(m.ctx, m); err != nil {
+		log.ZWarn(m.ctx, "redismq handler failed", err, "stream", c.stream, "id", msg.ID)
+	}
+}
+
+func (c *consumer) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+type message struct {
+	consumer *consumer
+	ctx      context.Context
+	id       string
+	key      string
+	value    []byte
+	headers  map[string]string
+}
+
+func (m *message) Context() context.Context { return m.ctx }
+
+func (m *message) Key() string { return m.key }
+
+func (m *message) Value() []byte { return m.value }
+
+func (m *message) Headers() map[string]string { return m.headers }
+
+func (m *message) Ack() error {
+	if err := m.consumer.rdb.XAck(context.Background(), m.consumer.stream, m.consumer.group, m.id).Err(); err != nil {
+		return errs.WrapMsg(err, "XAck failed", "stream", m.consumer.stream, "id", m.id)
+	}
+	return nil
+}
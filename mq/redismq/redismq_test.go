@@ -0,0 +1,85 @@
+package redismq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/mq"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedis(t *testing.T) redis.UniversalClient {
+	srv := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func TestSendAndAck(t *testing.T) {
+	rdb := newRedis(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	consumer, err := NewConsumer(ctx, rdb, "stream", "group", "c1", WithBlock(50*time.Millisecond))
+	assert.NoError(t, err)
+	_, err = NewConsumer(ctx, rdb, "stream", "group", "c2")
+	assert.NoError(t, err, "joining an existing group")
+
+	producer := NewProducer(rdb, "stream", WithMaxLen(100))
+	assert.NoError(t, producer.SendMessage(mcontext.NewCtx("op"), "key", []byte("value")))
+
+	received := make(chan mq.Message, 1)
+	go consumer.Subscribe(ctx, func(ctx context.Context, msg mq.Message) error {
+		assert.Equal(t, "op", mcontext.GetOperationID(ctx))
+		received <- msg
+		return msg.Ack()
+	})
+	msg := <-received
+	assert.Equal(t, "key", msg.Key())
+	assert.Equal(t, []byte("value"), msg.Value())
+	assert.Equal(t, "op", msg.Headers()["operationID"])
+
+	assert.Eventually(t, func() bool {
+		pending, err := rdb.XPending(ctx, "stream", "group").Result()
+		return err == nil && pending.Count == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, consumer.Close())
+}
+
+func TestReclaimPending(t *testing.T) {
+	rdb := newRedis(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	crashed, err := NewConsumer(ctx, rdb, "stream", "group", "crashed", WithBlock(50*time.Millisecond))
+	assert.NoError(t, err)
+	assert.NoError(t, NewProducer(rdb, "stream").SendMessage(context.Background(), "key", []byte("value")))
+
+	taken := make(chan struct{})
+	crashCtx, crash := context.WithCancel(ctx)
+	go crashed.Subscribe(crashCtx, func(ctx context.Context, msg mq.Message) error {
+		close(taken)
+		crash()
+		return nil
+	})
+	<-taken
+
+	survivor, err := NewConsumer(ctx, rdb, "stream", "group", "survivor",
+		WithBlock(50*time.Millisecond), WithReclaim(100*time.Millisecond, 50*time.Millisecond))
+	assert.NoError(t, err)
+	received := make(chan string, 1)
+	go survivor.Subscribe(ctx, func(ctx context.Context, msg mq.Message) error {
+		received <- msg.Key()
+		return msg.Ack()
+	})
+	select {
+	case key := <-received:
+		assert.Equal(t, "key", key)
+	case <-ctx.Done():
+		t.Fatal("pending message was not reclaimed")
+	}
+}
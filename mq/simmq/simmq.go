@@ -0,0 +1,281 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package simmq is an in-process implementation of the mq interfaces for tests and single node installs.
+package simmq
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mq"
+)
+
+const defaultAckTimeout = 30 * time.Second
+
+type Option func(*Broker)
+
+// WithAckTimeout sets how long a delivered message may stay unacknowledged before it is
+// delivered again. The default is 30s.
+func WithAckTimeout(timeout time.Duration) Option {
+	return func(b *Broker) {
+		b.ackTimeout = timeout
+	}
+}
+
+// Broker holds the topics of one process. Every consumer group of a topic receives the
+// messages sent after the group was created, the consumers of one group share them.
+// Messages are kept in memory until they are acknowledged.
+type Broker struct {
+	mu         sync.Mutex
+	topics     map[string]*topic
+	ackTimeout time.Duration
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+func New(opts ...Option) *Broker {
+	b := &Broker{
+		topics:     make(map[string]*topic),
+		ackTimeout: defaultAckTimeout,
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *Broker) topic(name string) *topic {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{groups: make(map[string]*group)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// NewProducer returns a producer sending to topic.
+func (b *Broker) NewProducer(topic string) mq.Producer {
+	return &producer{broker: b, topic: b.topic(topic)}
+}
+
+// NewConsumer returns a consumer of topic in group, creating the group if it does not exist.
+func (b *Broker) NewConsumer(topic, group string) mq.Consumer {
+	return &consumer{broker: b, group: b.topic(topic).group(group, b.ackTimeout), done: make(chan struct{})}
+}
+
+// Close stops every producer and consumer of the broker.
+func (b *Broker) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+	return nil
+}
+
+type topic struct {
+	mu     sync.Mutex
+	groups map[string]*group
+}
+
+func (t *topic) group(name string, ackTimeout time.Duration) *group {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	g, ok := t.groups[name]
+	if !ok {
+		g = &group{
+			inflight:   make(map[*delivery]time.Time),
+			notify:     make(chan struct{}, 1),
+			ackTimeout: ackTimeout,
+		}
+		t.groups[name] = g
+	}
+	return g
+}
+
+func (t *topic) send(d delivery) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, g := range t.groups {
+		d := d
+		g.push(&d)
+	}
+}
+
+type delivery struct {
+	key     string
+	value   []byte
+	headers map[string]string
+	acked   bool
+}
+
+type group struct {
+	mu         sync.Mutex
+	queue      []*delivery
+	inflight   map[*delivery]time.Time
+	notify     chan struct{}
+	ackTimeout time.Duration
+}
+
+func (g *group) push(d *delivery) {
+	g.mu.Lock()
+	g.queue = append(g.queue, d)
+	g.mu.Unlock()
+	g.wake()
+}
+
+func (g *group) wake() {
+	select {
+	case g.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for a message, redelivering messages whose ack timeout expired first.
+func (g *group) next(ctx context.Context, consumerDone, brokerDone <-chan struct{}) (*delivery, bool) {
+	for {
+		g.mu.Lock()
+		now := time.Now()
+		wait := g.ackTimeout
+		for d, deadline := range g.inflight {
+			if !deadline.After(now) {
+				delete(g.inflight, d)
+				g.queue = append([]*delivery{d}, g.queue...)
+			} else if deadline.Sub(now) < wait {
+				wait = deadline.Sub(now)
+			}
+		}
+		for len(g.queue) > 0 {
+			d := g.queue[0]
+			g.queue = g.queue[1:]
+			if d.acked {
+				continue
+			}
+			g.inflight[d] = now.Add(g.ackTimeout)
+			g.mu.Unlock()
+			if len(g.queue) > 0 {
+				// Let other consumers of the group pick up the rest.
+				g.wake()
+			}
+			return d, true
+		}
+		g.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, false
+		case <-consumerDone:
+			timer.Stop()
+			return nil, false
+		case <-brokerDone:
+			timer.Stop()
+			return nil, false
+		case <-g.notify:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (g *group) ack(d *delivery) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	d.acked = true
+	delete(g.inflight, d)
+}
+
+type producer struct {
+	broker *Broker
+	topic  *topic
+	mu     sync.RWMutex
+	closed bool
+}
+
+func (p *producer) SendMessage(ctx context.Context, key string, value []byte) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	select {
+	case <-p.broker.done:
+		return errs.Wrap(mq.ErrClosed)
+	default:
+	}
+	if p.closed {
+		return errs.Wrap(mq.ErrClosed)
+	}
+	p.topic.send(delivery{key: key, value: append([]byte(nil), value...), headers: mq.HeadersFromContext(ctx)})
+	return nil
+}
+
+func (p *producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+type consumer struct {
+	broker    *Broker
+	group     *group
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *consumer) Subscribe(ctx context.Context, handler mq.Handler) error {
+	for {
+		d, ok := c.group.next(ctx, c.done, c.broker.done)
+		if !ok {
+			return nil
+		}
+		msg := &message{ctx: mq.ContextFromHeaders(d.headers), group: c.group, delivery: d}
+		if err := handler(msg.ctx, msg); err != nil {
+			log.ZWarn(msg.ctx, "simmq handler failed", err, "key", d.key)
+		}
+	}
+}
+
+func (c *consumer) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+type message struct {
+	ctx      context.Context
+	group    *group
+	delivery *delivery
+}
+
+func (m *message) Context() context.Context { return m.ctx }
+
+func (m *message) Key() string { return m.delivery.key }
+
+func (m *message) Value() []byte { return m.delivery.value }
+
+// Headers returns a copy of the headers, the delivery is shared by every group and redelivery.
+func (m *message) Headers() map[string]string {
+	headers := make(map[string]string, len(m.delivery.headers))
+	for k, v := range m.delivery.headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+func (m *message) Ack() error {
+	m.group.ack(m.delivery)
+	return nil
+}
@@ -0,0 +1,85 @@
+package simmq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/mq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrokerGroups(t *testing.T) {
+	broker := New()
+	defer broker.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	producer := broker.NewProducer("topic")
+	groupA := []mq.Consumer{broker.NewConsumer("topic", "a"), broker.NewConsumer("topic", "a")}
+	groupB := broker.NewConsumer("topic", "b")
+
+	const total = 20
+	var mu sync.Mutex
+	received := map[string]int{}
+	var wg sync.WaitGroup
+	wg.Add(2 * total)
+	subscribe := func(name string, c mq.Consumer) {
+		go c.Subscribe(ctx, func(ctx context.Context, msg mq.Message) error {
+			assert.Equal(t, "op", mcontext.GetOperationID(ctx))
+			mu.Lock()
+			received[name]++
+			mu.Unlock()
+			wg.Done()
+			return msg.Ack()
+		})
+	}
+	subscribe("a", groupA[0])
+	subscribe("a", groupA[1])
+	subscribe("b", groupB)
+
+	for i := 0; i < total; i++ {
+		assert.NoError(t, producer.SendMessage(mcontext.NewCtx("op"), "key", []byte("value")))
+	}
+	wg.Wait()
+	mu.Lock()
+	assert.Equal(t, map[string]int{"a": total, "b": total}, received)
+	mu.Unlock()
+
+	assert.NoError(t, producer.Close())
+	assert.ErrorIs(t, producer.SendMessage(ctx, "key", nil), mq.ErrClosed)
+}
+
+func TestBrokerRedelivery(t *testing.T) {
+	broker := New(WithAckTimeout(50 * time.Millisecond))
+	defer broker.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	consumer := broker.NewConsumer("topic", "group")
+	assert.NoError(t, broker.NewProducer("topic").SendMessage(mcontext.NewCtx("op"), "key", []byte("value")))
+
+	deliveries := make(chan mq.Message, 2)
+	go consumer.Subscribe(ctx, func(ctx context.Context, msg mq.Message) error {
+		deliveries <- msg
+		return nil
+	})
+	first := <-deliveries
+	first.Headers()["mutated"] = "true"
+	second := <-deliveries
+	assert.Equal(t, first.Value(), second.Value())
+	assert.NotContains(t, second.Headers(), "mutated", "headers changed by a consumer are not redelivered")
+	assert.Equal(t, "op", mcontext.GetOperationID(second.Context()))
+	assert.NoError(t, second.Ack())
+
+	select {
+	case <-deliveries:
+		t.Fatal("acknowledged message was delivered again")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	assert.NoError(t, consumer.Close())
+	assert.NoError(t, consumer.Subscribe(ctx, nil))
+}
@@ -0,0 +1,586 @@
+// Copyright © 2023 OpenIM. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	awss3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+)
+
+const (
+	minPartSize int64 = 1024 * 1024 * 5        // 5MB
+	maxPartSize int64 = 1024 * 1024 * 1024 * 5 // 5GB
+	maxNumSize  int64 = 10000
+)
+
+// maxPresignExpire is the longest lifetime of a SigV4 presigned URL.
+const maxPresignExpire = time.Hour * 24 * 7
+
+const successCode = http.StatusOK
+
+var _ s3.Interface = (*Aws)(nil)
+
+type Config struct {
+	Region string
+	Bucket string
+	// Endpoint replaces the AWS endpoint to use an S3-compatible store, empty uses AWS.
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// UsePathStyle addresses the bucket as endpoint/bucket instead of bucket.endpoint,
+	// which most S3-compatible stores require.
+	UsePathStyle bool
+}
+
+func NewAws(conf Config) (*Aws, error) {
+	if conf.Bucket == "" {
+		return nil, errs.ErrArgs.WrapMsg("aws bucket is empty")
+	}
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+	bucketURL, err := makeBucketURL(conf)
+	if err != nil {
+		return nil, err
+	}
+	creds := aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(conf.AccessKeyID, conf.SecretAccessKey, conf.SessionToken))
+	opts := awss3.Options{
+		Region:       conf.Region,
+		Credentials:  creds,
+		UsePathStyle: conf.UsePathStyle,
+	}
+	if conf.Endpoint != "" {
+		opts.BaseEndpoint = aws.String(conf.Endpoint)
+	}
+	client := awss3.New(opts)
+	return &Aws{
+		bucket:      conf.Bucket,
+		region:      conf.Region,
+		bucketURL:   bucketURL,
+		credentials: creds,
+		client:      client,
+		presign:     awss3.NewPresignClient(client),
+	}, nil
+}
+
+// makeBucketURL returns the URL of the bucket, addressed the way the client addresses it.
+func makeBucketURL(conf Config) (string, error) {
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + conf.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", errs.ErrArgs.WrapMsg("invalid aws endpoint", "endpoint", conf.Endpoint)
+	}
+	if conf.UsePathStyle {
+		u.Path += "/" + conf.Bucket
+	} else {
+		u.Host = conf.Bucket + "." + u.Host
+	}
+	return u.String(), nil
+}
+
+type Aws struct {
+	bucket      string
+	region      string
+	bucketURL   string
+	credentials aws.CredentialsProvider
+	client      *awss3.Client
+	presign     *awss3.PresignClient
+}
+
+func (a *Aws) Engine() string {
+	return "aws"
+}
+
+func (a *Aws) PartLimit() *s3.PartLimit {
+	return &s3.PartLimit{
+		MinPartSize: minPartSize,
+		MaxPartSize: maxPartSize,
+		MaxNumSize:  maxNumSize,
+	}
+}
+
+func (a *Aws) objectURL(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return a.bucketURL + "/" + strings.Join(segments, "/")
+}
+
+func formatETag(etag *string) string {
+	return strings.ToLower(strings.ReplaceAll(aws.ToString(etag), `"`, ``))
+}
+
+func (a *Aws) InitiateMultipartUpload(ctx context.Context, name string) (*s3.InitiateMultipartUploadResult, error) {
+	result, err := a.client.CreateMultipartUpload(ctx, &awss3.CreateMultipartUploadInput{
+		Bucket: aws.String(a.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3.InitiateMultipartUploadResult{
+		Bucket:   aws.ToString(result.Bucket),
+		Key:      aws.ToString(result.Key),
+		UploadID: aws.ToString(result.UploadId),
+	}, nil
+}
+
+func (a *Aws) CompleteMultipartUpload(ctx context.Context, uploadID string, name string, parts []s3.Part) (*s3.CompleteMultipartUploadResult, error) {
+	awsParts := make([]awss3types.CompletedPart, len(parts))
+	for i, part := range parts {
+		awsParts[i] = awss3types.CompletedPart{
+			PartNumber: aws.Int32(int32(part.PartNumber)),
+			ETag:       aws.String(strings.ToLower(part.ETag)),
+		}
+	}
+	result, err := a.client.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(a.bucket),
+		Key:             aws.String(name),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &awss3types.CompletedMultipartUpload{Parts: awsParts},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3.CompleteMultipartUploadResult{
+		Location: aws.ToString(result.Location),
+		Bucket:   aws.ToString(result.Bucket),
+		Key:      aws.ToString(result.Key),
+		ETag:     formatETag(result.ETag),
+	}, nil
+}
+
+func (a *Aws) PartSize(ctx context.Context, size int64) (int64, error) {
+	if size <= 0 {
+		return 0, errors.New("size must be greater than 0")
+	}
+	if size > maxPartSize*maxNumSize {
+		return 0, fmt.Errorf("AWS size must be less than the maximum allowed limit")
+	}
+	if size <= minPartSize*maxNumSize {
+		return minPartSize, nil
+	}
+	partSize := size / maxNumSize
+	if size%maxNumSize != 0 {
+		partSize++
+	}
+	return partSize, nil
+}
+
+func presignExpire(expire time.Duration) time.Duration {
+	if expire <= 0 || expire > maxPresignExpire {
+		return maxPresignExpire
+	} else if expire < time.Second {
+		return time.Second
+	}
+	return expire
+}
+
+// AuthSign presigns the parts of a multipart upload. Each part carries its full presigned URL
+// as well as the query to add to the upload URL, so clients may use either.
+func (a *Aws) AuthSign(ctx context.Context, uploadID string, name string, expire time.Duration, partNumbers []int) (*s3.AuthSignResult, error) {
+	result := s3.AuthSignResult{
+		URL:   a.objectURL(name),
+		Query: url.Values{"uploadId": {uploadID}},
+		Parts: make([]s3.SignPart, len(partNumbers)),
+	}
+	for i, partNumber := range partNumbers {
+		req, err := a.presign.PresignUploadPart(ctx, &awss3.UploadPartInput{
+			Bucket:     aws.String(a.bucket),
+			Key:        aws.String(name),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int32(int32(partNumber)),
+		}, awss3.WithPresignExpires(presignExpire(expire)))
+		if err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return nil, err
+		}
+		query := u.Query()
+		query.Del("uploadId")
+		result.Parts[i] = s3.SignPart{
+			PartNumber: partNumber,
+			URL:        req.URL,
+			Query:      query,
+			Header:     req.SignedHeader,
+		}
+	}
+	return &result, nil
+}
+
+func (a *Aws) PresignedPutObject(ctx context.Context, name string, expire time.Duration) (string, error) {
+	req, err := a.presign.PresignPutObject(ctx, &awss3.PutObjectInput{
+		Bucket: aws.String(a.bucket),
+		Key:    aws.String(name),
+	}, awss3.WithPresignExpires(presignExpire(expire)))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+func (a *Aws) PutObject(ctx context.Context, name string, reader io.Reader, size int64, contentType string) (*s3.PutObjectInfo, error) {
+	input := &awss3.PutObjectInput{
+		Bucket:        aws.String(a.bucket),
+		Key:           aws.String(name),
+		Body:          reader,
+		ContentLength: aws.Int64(size),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	// The body is streamed, so it is sent unsigned instead of being read twice to hash it.
+	result, err := a.client.PutObject(ctx, input, awss3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
+	if err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectInfo{
+		Key:  name,
+		ETag: formatETag(result.ETag),
+		Size: size,
+	}, nil
+}
+
+func (a *Aws) GetObject(ctx context.Context, name string, rng *s3.ObjectRange) (io.ReadCloser, error) {
+	input := &awss3.GetObjectInput{
+		Bucket: aws.String(a.bucket),
+		Key:    aws.String(name),
+	}
+	if rng != nil {
+		input.Range = aws.String(rng.HeaderValue())
+	}
+	result, err := a.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return result.Body, nil
+}
+
+func (a *Aws) DeleteObject(ctx context.Context, name string) error {
+	_, err := a.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(a.bucket),
+		Key:    aws.String(name),
+	})
+	return err
+}
+
+func (a *Aws) DeleteObjects(ctx context.Context, names []string) error {
+	failed := make(map[string]string)
+	for start := 0; start < len(names); start += s3.MaxDeleteObjects {
+		batch := names[start:min(start+s3.MaxDeleteObjects, len(names))]
+		objects := make([]awss3types.ObjectIdentifier, len(batch))
+		for i, name := range batch {
+			objects[i] = awss3types.ObjectIdentifier{Key: aws.String(name)}
+		}
+		result, err := a.client.DeleteObjects(ctx, &awss3.DeleteObjectsInput{
+			Bucket: aws.String(a.bucket),
+			Delete: &awss3types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range result.Errors {
+			failed[aws.ToString(e.Key)] = aws.ToString(e.Code) + ": " + aws.ToString(e.Message)
+		}
+	}
+	if len(failed) > 0 {
+		return &s3.DeleteObjectsError{Failed: failed}
+	}
+	return nil
+}
+
+func (a *Aws) ListObjects(ctx context.Context, prefix string, continuationToken string, limit int) (*s3.ListObjectsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	input := &awss3.ListObjectsV2Input{
+		Bucket:  aws.String(a.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(int32(limit)),
+	}
+	if continuationToken != "" {
+		input.ContinuationToken = aws.String(continuationToken)
+	}
+	result, err := a.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListObjectsResult{
+		Objects:               make([]s3.ObjectInfo, len(result.Contents)),
+		NextContinuationToken: aws.ToString(result.NextContinuationToken),
+		IsTruncated:           aws.ToBool(result.IsTruncated),
+	}
+	for i, object := range result.Contents {
+		res.Objects[i] = s3.ObjectInfo{
+			ETag:         formatETag(object.ETag),
+			Key:          aws.ToString(object.Key),
+			Size:         aws.ToInt64(object.Size),
+			LastModified: aws.ToTime(object.LastModified),
+		}
+	}
+	return res, nil
+}
+
+func (a *Aws) CopyObject(ctx context.Context, src string, dst string) (*s3.CopyObjectInfo, error) {
+	segments := strings.Split(src, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	result, err := a.client.CopyObject(ctx, &awss3.CopyObjectInput{
+		Bucket:     aws.String(a.bucket),
+		CopySource: aws.String(a.bucket + "/" + strings.Join(segments, "/")),
+		Key:        aws.String(dst),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.CopyObjectResult == nil {
+		return nil, errs.New("copy object result is empty", "src", src, "dst", dst).Wrap()
+	}
+	return &s3.CopyObjectInfo{
+		Key:  dst,
+		ETag: formatETag(result.CopyObjectResult.ETag),
+	}, nil
+}
+
+func (a *Aws) StatObject(ctx context.Context, name string) (*s3.ObjectInfo, error) {
+	info, err := a.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(a.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3.ObjectInfo{
+		ETag:         formatETag(info.ETag),
+		Key:          name,
+		Size:         aws.ToInt64(info.ContentLength),
+		LastModified: aws.ToTime(info.LastModified),
+	}, nil
+}
+
+func (a *Aws) IsNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	var (
+		notFound     *awss3types.NotFound
+		noSuchKey    *awss3types.NoSuchKey
+		noSuchUpload *awss3types.NoSuchUpload
+		response     interface{ HTTPStatusCode() int }
+	)
+	switch {
+	case errors.As(err, &notFound), errors.As(err, &noSuchKey), errors.As(err, &noSuchUpload):
+		return true
+	case errors.As(err, &response):
+		return response.HTTPStatusCode() == http.StatusNotFound
+	default:
+		return false
+	}
+}
+
+func (a *Aws) AbortMultipartUpload(ctx context.Context, uploadID string, name string) error {
+	_, err := a.client.AbortMultipartUpload(ctx, &awss3.AbortMultipartUploadInput{
+		Bucket:   aws.String(a.bucket),
+		Key:      aws.String(name),
+		UploadId: aws.String(uploadID),
+	})
+	return err
+}
+
+func (a *Aws) ListUploadedParts(ctx context.Context, uploadID string, name string, partNumberMarker int, maxParts int) (*s3.ListUploadedPartsResult, error) {
+	input := &awss3.ListPartsInput{
+		Bucket:           aws.String(a.bucket),
+		Key:              aws.String(name),
+		UploadId:         aws.String(uploadID),
+		PartNumberMarker: aws.String(strconv.Itoa(partNumberMarker)),
+	}
+	if maxParts > 0 {
+		input.MaxParts = aws.Int32(int32(maxParts))
+	}
+	result, err := a.client.ListParts(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListUploadedPartsResult{
+		Key:           aws.ToString(result.Key),
+		UploadID:      aws.ToString(result.UploadId),
+		MaxParts:      int(aws.ToInt32(result.MaxParts)),
+		UploadedParts: make([]s3.UploadedPart, len(result.Parts)),
+	}
+	if marker := aws.ToString(result.NextPartNumberMarker); marker != "" {
+		if res.NextPartNumberMarker, err = strconv.Atoi(marker); err != nil {
+			return nil, errs.WrapMsg(err, "invalid next part number marker", "marker", marker)
+		}
+	}
+	for i, part := range result.Parts {
+		res.UploadedParts[i] = s3.UploadedPart{
+			PartNumber:   int(aws.ToInt32(part.PartNumber)),
+			LastModified: aws.ToTime(part.LastModified),
+			ETag:         formatETag(part.ETag),
+			Size:         aws.ToInt64(part.Size),
+		}
+	}
+	return res, nil
+}
+
+func (a *Aws) ListMultipartUploads(ctx context.Context, prefix string, keyMarker string, uploadIDMarker string, limit int) (*s3.ListMultipartUploadsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	input := &awss3.ListMultipartUploadsInput{
+		Bucket:     aws.String(a.bucket),
+		Prefix:     aws.String(prefix),
+		MaxUploads: aws.Int32(int32(limit)),
+	}
+	if keyMarker != "" {
+		input.KeyMarker = aws.String(keyMarker)
+	}
+	if uploadIDMarker != "" {
+		input.UploadIdMarker = aws.String(uploadIDMarker)
+	}
+	result, err := a.client.ListMultipartUploads(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListMultipartUploadsResult{
+		Uploads:            make([]s3.MultipartUpload, len(result.Uploads)),
+		NextKeyMarker:      aws.ToString(result.NextKeyMarker),
+		NextUploadIDMarker: aws.ToString(result.NextUploadIdMarker),
+		IsTruncated:        aws.ToBool(result.IsTruncated),
+	}
+	for i, upload := range result.Uploads {
+		res.Uploads[i] = s3.MultipartUpload{
+			Key:       aws.ToString(upload.Key),
+			UploadID:  aws.ToString(upload.UploadId),
+			Initiated: aws.ToTime(upload.Initiated),
+		}
+	}
+	return res, nil
+}
+
+// AccessURL returns a presigned GET URL, valid for at most a week. S3 has no image
+// processing, opt.Image is ignored.
+func (a *Aws) AccessURL(ctx context.Context, name string, expire time.Duration, opt *s3.AccessURLOption) (string, error) {
+	input := &awss3.GetObjectInput{
+		Bucket: aws.String(a.bucket),
+		Key:    aws.String(name),
+	}
+	if opt != nil {
+		if opt.ContentType != "" {
+			input.ResponseContentType = aws.String(opt.ContentType)
+		}
+		if opt.Filename != "" {
+			input.ResponseContentDisposition = aws.String(`attachment; filename=` + strconv.Quote(opt.Filename))
+		}
+	}
+	req, err := a.presign.PresignGetObject(ctx, input, awss3.WithPresignExpires(presignExpire(expire)))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// FormData signs a browser-based POST upload with a SigV4 POST policy.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
+func (a *Aws) FormData(ctx context.Context, name string, size int64, contentType string, duration time.Duration) (*s3.FormData, error) {
+	creds, err := a.credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "retrieve aws credentials failed")
+	}
+	now := time.Now().UTC()
+	expires := now.Add(duration)
+	date := now.Format("20060102")
+	fd := map[string]string{
+		"key":                   name,
+		"success_action_status": strconv.Itoa(successCode),
+		"x-amz-algorithm":       "AWS4-HMAC-SHA256",
+		"x-amz-credential":      strings.Join([]string{creds.AccessKeyID, date, a.region, "s3", "aws4_request"}, "/"),
+		"x-amz-date":            now.Format("20060102T150405Z"),
+	}
+	if contentType != "" {
+		fd["Content-Type"] = contentType
+	}
+	if creds.SessionToken != "" {
+		fd["x-amz-security-token"] = creds.SessionToken
+	}
+	keys := make([]string, 0, len(fd))
+	for k := range fd {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	conditions := []any{map[string]string{"bucket": a.bucket}}
+	for _, k := range keys {
+		conditions = append(conditions, map[string]string{k: fd[k]})
+	}
+	if size > 0 {
+		conditions = append(conditions, []any{"content-length-range", 0, size})
+	}
+	policy, err := json.Marshal(map[string]any{
+		"expiration": expires.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, errs.WrapMsg(err, "marshal post policy failed")
+	}
+	encoded := base64.StdEncoding.EncodeToString(policy)
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, scope := range []string{date, a.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, scope)
+	}
+	fd["policy"] = encoded
+	fd["x-amz-signature"] = hex.EncodeToString(hmacSHA256(key, encoded))
+	return &s3.FormData{
+		URL:          a.bucketURL + "/",
+		File:         "file",
+		FormData:     fd,
+		Expires:      expires,
+		SuccessCodes: []int{successCode},
+	}, nil
+}
@@ -0,0 +1,612 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/internal/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBucket = "test"
+	testSecret = "secret"
+)
+
+type stubObject struct {
+	data        []byte
+	etag        string
+	contentType string
+	modified    time.Time
+}
+
+type stubUpload struct {
+	key       string
+	initiated time.Time
+}
+
+type stubPart struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified,omitempty"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size,omitempty"`
+}
+
+// stubS3 is a path-style S3-compatible server covering the requests the engine makes.
+// It checks that requests are signed but does not verify SigV4 signatures, except for
+// POST policies which the engine signs itself.
+type stubS3 struct {
+	mu      sync.Mutex
+	seq     int
+	objects map[string]*stubObject
+	uploads map[string]map[int][]byte
+	pending map[string]*stubUpload
+}
+
+func newStubS3(t *testing.T) (*stubS3, string) {
+	stub := &stubS3{objects: make(map[string]*stubObject), uploads: make(map[string]map[int][]byte), pending: make(map[string]*stubUpload)}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	return stub, srv.URL
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	data, _ := xml.Marshal(v)
+	_, _ = w.Write(data)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (s *stubS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		if r.URL.Path != "/"+testBucket {
+			writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+			return
+		}
+		key = ""
+	}
+	query := r.URL.Query()
+	if key == "" && r.Method == http.MethodPost && !query.Has("delete") {
+		s.postObject(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") == "" && query.Get("X-Amz-Signature") == "" {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	uploadID := query.Get("uploadId")
+	switch {
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		s.listObjects(w, query)
+	case key == "" && r.Method == http.MethodGet && query.Has("uploads"):
+		s.listUploads(w, query)
+	case key == "" && r.Method == http.MethodPost:
+		s.deleteObjects(w, r)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.seq++
+		uploadID = "upload" + strconv.Itoa(s.seq)
+		s.uploads[uploadID] = make(map[int][]byte)
+		s.pending[uploadID] = &stubUpload{key: key, initiated: time.Now()}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: testBucket, Key: key, UploadId: uploadID})
+	case uploadID != "" && s.uploads[uploadID] == nil:
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+	case r.Method == http.MethodPut && uploadID != "":
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		data, _ := io.ReadAll(r.Body)
+		s.uploads[uploadID][partNumber] = data
+		w.Header().Set("ETag", strconv.Quote(s3test.MD5Hex(data)))
+	case r.Method == http.MethodGet && uploadID != "":
+		marker, _ := strconv.Atoi(query.Get("part-number-marker"))
+		maxParts, _ := strconv.Atoi(query.Get("max-parts"))
+		if maxParts == 0 {
+			maxParts = 1000
+		}
+		res := struct {
+			XMLName              xml.Name `xml:"ListPartsResult"`
+			Bucket               string
+			Key                  string
+			UploadId             string
+			NextPartNumberMarker int
+			MaxParts             int
+			IsTruncated          bool
+			Parts                []stubPart `xml:"Part"`
+		}{Bucket: testBucket, Key: key, UploadId: uploadID, MaxParts: maxParts}
+		for n := marker + 1; n <= 10000 && len(res.Parts) < maxParts; n++ {
+			if data, ok := s.uploads[uploadID][n]; ok {
+				res.Parts = append(res.Parts, stubPart{PartNumber: n, LastModified: time.Now().UTC().Format(time.RFC3339), ETag: strconv.Quote(s3test.MD5Hex(data)), Size: len(data)})
+				res.NextPartNumberMarker = n
+			}
+		}
+		writeXML(w, res)
+	case r.Method == http.MethodPost && uploadID != "":
+		var complete struct {
+			Parts []stubPart `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+			writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var data, digests []byte
+		for _, part := range complete.Parts {
+			content, ok := s.uploads[uploadID][part.PartNumber]
+			if !ok || strings.Trim(part.ETag, `"`) != s3test.MD5Hex(content) {
+				writeS3Error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			data = append(data, content...)
+			sum := md5.Sum(content)
+			digests = append(digests, sum[:]...)
+		}
+		etag := s3test.MD5Hex(digests) + "-" + strconv.Itoa(len(complete.Parts))
+		s.objects[key] = &stubObject{data: data, etag: etag, modified: time.Now()}
+		delete(s.uploads, uploadID)
+		delete(s.pending, uploadID)
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+			Location string
+			Bucket   string
+			Key      string
+			ETag     string
+		}{Location: "http://" + r.Host + r.URL.Path, Bucket: testBucket, Key: key, ETag: strconv.Quote(etag)})
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(s.uploads, uploadID)
+		delete(s.pending, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		obj, ok := s.objects[strings.TrimPrefix(strings.TrimPrefix(src, "/"), testBucket+"/")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		copied := *obj
+		copied.modified = time.Now()
+		s.objects[key] = &copied
+		writeXML(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			LastModified string
+			ETag         string
+		}{LastModified: time.Now().UTC().Format(time.RFC3339), ETag: strconv.Quote(obj.etag)})
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[key] = &stubObject{data: data, etag: s3test.MD5Hex(data), contentType: r.Header.Get("Content-Type"), modified: time.Now()}
+		w.Header().Set("ETag", strconv.Quote(s3test.MD5Hex(data)))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := s.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		contentType := obj.contentType
+		if v := query.Get("response-content-type"); v != "" {
+			contentType = v
+		}
+		data, status := obj.data, http.StatusOK
+		if v, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok {
+			start, end, _ := strings.Cut(v, "-")
+			from, _ := strconv.Atoi(start)
+			to := len(data) - 1
+			if end != "" {
+				to, _ = strconv.Atoi(end)
+			}
+			data, status = data[from:min(to+1, len(data))], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("ETag", strconv.Quote(obj.etag))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// listObjects answers ListObjectsV2, using the last listed key as continuation token.
+func (s *stubS3) listObjects(w http.ResponseWriter, query url.Values) {
+	maxKeys, _ := strconv.Atoi(query.Get("max-keys"))
+	if maxKeys == 0 {
+		maxKeys = 1000
+	}
+	prefix, token := query.Get("prefix"), query.Get("continuation-token")
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) && key > token {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	res := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		KeyCount              int
+		MaxKeys               int
+		IsTruncated           bool
+		NextContinuationToken string    `xml:",omitempty"`
+		Contents              []content `xml:"Contents"`
+	}{Name: testBucket, Prefix: prefix, MaxKeys: maxKeys}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		res.IsTruncated, res.NextContinuationToken = true, keys[maxKeys-1]
+	}
+	for _, key := range keys {
+		obj := s.objects[key]
+		res.Contents = append(res.Contents, content{Key: key, LastModified: obj.modified.UTC().Format(time.RFC3339), ETag: strconv.Quote(obj.etag), Size: len(obj.data)})
+	}
+	res.KeyCount = len(res.Contents)
+	writeXML(w, res)
+}
+
+// listUploads answers ListMultipartUploads. Upload IDs increase with time, so uploads of
+// the same key are ordered by the sequence in their ID.
+func (s *stubS3) listUploads(w http.ResponseWriter, query url.Values) {
+	maxUploads, _ := strconv.Atoi(query.Get("max-uploads"))
+	if maxUploads == 0 {
+		maxUploads = 1000
+	}
+	prefix, keyMarker, uploadIDMarker := query.Get("prefix"), query.Get("key-marker"), query.Get("upload-id-marker")
+	seq := func(uploadID string) int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(uploadID, "upload"))
+		return n
+	}
+	var ids []string
+	for id, upload := range s.pending {
+		if !strings.HasPrefix(upload.key, prefix) || upload.key < keyMarker {
+			continue
+		}
+		if upload.key == keyMarker && (uploadIDMarker == "" || seq(id) <= seq(uploadIDMarker)) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if a, b := s.pending[ids[i]].key, s.pending[ids[j]].key; a != b {
+			return a < b
+		}
+		return seq(ids[i]) < seq(ids[j])
+	})
+	type upload struct {
+		Key       string
+		UploadId  string
+		Initiated string
+	}
+	res := struct {
+		XMLName            xml.Name `xml:"ListMultipartUploadsResult"`
+		Bucket             string
+		Prefix             string
+		MaxUploads         int
+		IsTruncated        bool
+		NextKeyMarker      string   `xml:",omitempty"`
+		NextUploadIdMarker string   `xml:",omitempty"`
+		Uploads            []upload `xml:"Upload"`
+	}{Bucket: testBucket, Prefix: prefix, MaxUploads: maxUploads}
+	if len(ids) > maxUploads {
+		ids = ids[:maxUploads]
+		res.IsTruncated, res.NextKeyMarker, res.NextUploadIdMarker = true, s.pending[ids[maxUploads-1]].key, ids[maxUploads-1]
+	}
+	for _, id := range ids {
+		res.Uploads = append(res.Uploads, upload{Key: s.pending[id].key, UploadId: id, Initiated: s.pending[id].initiated.UTC().Format(time.RFC3339)})
+	}
+	writeXML(w, res)
+}
+
+// deleteObjects answers a quiet DeleteObjects, refusing keys under "locked/".
+func (s *stubS3) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	type deleteError struct {
+		Key     string
+		Code    string
+		Message string
+	}
+	res := struct {
+		XMLName xml.Name      `xml:"DeleteResult"`
+		Errors  []deleteError `xml:"Error"`
+	}{}
+	for _, obj := range req.Objects {
+		if strings.HasPrefix(obj.Key, "locked/") {
+			res.Errors = append(res.Errors, deleteError{Key: obj.Key, Code: "AccessDenied", Message: "Access Denied"})
+			continue
+		}
+		delete(s.objects, obj.Key)
+	}
+	writeXML(w, res)
+}
+
+// postObject accepts a POST policy upload after verifying its SigV4 signature.
+func (s *stubS3) postObject(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedPOSTRequest")
+		return
+	}
+	form := r.MultipartForm.Value
+	credential := strings.Split(form["x-amz-credential"][0], "/")
+	key := []byte("AWS4" + testSecret)
+	for _, scope := range credential[1:] {
+		key = hmacSHA256(key, scope)
+	}
+	policy := form["policy"][0]
+	if hex.EncodeToString(hmacSHA256(key, policy)) != form["x-amz-signature"][0] {
+		writeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(policy)
+	if !strings.Contains(string(decoded), `{"key":"`+form["key"][0]+`"}`) {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedPOSTRequest")
+		return
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+	s.objects[form["key"][0]] = &stubObject{data: data, etag: s3test.MD5Hex(data), contentType: form["Content-Type"][0], modified: time.Now()}
+	status, _ := strconv.Atoi(form["success_action_status"][0])
+	w.WriteHeader(status)
+}
+
+func newTestAws(t *testing.T) (*Aws, *stubS3) {
+	stub, endpoint := newStubS3(t)
+	a, err := NewAws(Config{
+		Region:          "us-east-1",
+		Bucket:          testBucket,
+		Endpoint:        endpoint,
+		AccessKeyID:     "access",
+		SecretAccessKey: testSecret,
+		UsePathStyle:    true,
+	})
+	require.NoError(t, err)
+	return a, stub
+}
+
+func TestMakeBucketURL(t *testing.T) {
+	u, err := makeBucketURL(Config{Region: "eu-west-1", Bucket: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://b.s3.eu-west-1.amazonaws.com", u)
+	u, err = makeBucketURL(Config{Bucket: "b", Endpoint: "http://127.0.0.1:9000/", UsePathStyle: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:9000/b", u)
+	_, err = makeBucketURL(Config{Bucket: "b", Endpoint: "127.0.0.1:9000"})
+	assert.Error(t, err)
+}
+
+func TestAccessURL(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAws(t)
+
+	data := []byte("access")
+	_, err := a.PutObject(ctx, "access/a", bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+	require.NoError(t, err)
+	rawURL, err := a.AccessURL(ctx, "access/a", time.Minute, &s3.AccessURLOption{ContentType: "text/plain", Filename: "a.txt"})
+	require.NoError(t, err)
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	assert.Equal(t, `attachment; filename="a.txt"`, u.Query().Get("response-content-disposition"))
+	resp, body := s3test.Do(t, http.MethodGet, rawURL, nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, data, body)
+}
+
+func TestMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAws(t)
+
+	upload, err := a.InitiateMultipartUpload(ctx, "dir/file name")
+	require.NoError(t, err)
+	sign, err := a.AuthSign(ctx, upload.UploadID, "dir/file name", time.Minute, []int{1, 2})
+	require.NoError(t, err)
+	contents := [][]byte{[]byte("first part"), []byte("second part")}
+	parts := make([]s3.Part, len(contents))
+	for i, part := range sign.Parts {
+		resp, _ := s3test.Do(t, http.MethodPut, part.URL, part.Header, contents[i])
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		parts[i] = s3.Part{PartNumber: part.PartNumber, ETag: s3test.MD5Hex(contents[i])}
+
+		query := url.Values{}
+		for k, v := range sign.Query {
+			query[k] = v
+		}
+		for k, v := range part.Query {
+			query[k] = v
+		}
+		u, err := url.Parse(part.URL)
+		require.NoError(t, err)
+		assert.Equal(t, u.Query(), query)
+		assert.True(t, strings.HasPrefix(part.URL, sign.URL+"?"))
+	}
+
+	listed, err := a.ListUploadedParts(ctx, upload.UploadID, "dir/file name", 0, 1)
+	require.NoError(t, err)
+	require.Len(t, listed.UploadedParts, 1)
+	assert.Equal(t, s3test.MD5Hex(contents[0]), listed.UploadedParts[0].ETag)
+	assert.Equal(t, 1, listed.NextPartNumberMarker)
+
+	result, err := a.CompleteMultipartUpload(ctx, upload.UploadID, "dir/file name", parts)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(result.ETag, "-2"))
+	info, err := a.StatObject(ctx, "dir/file name")
+	require.NoError(t, err)
+	assert.Equal(t, result.ETag, info.ETag)
+	assert.Equal(t, int64(len("first partsecond part")), info.Size)
+
+	_, err = a.ListUploadedParts(ctx, upload.UploadID, "dir/file name", 0, 0)
+	assert.True(t, a.IsNotFound(err))
+	require.NoError(t, a.DeleteObject(ctx, "dir/file name"))
+	_, err = a.StatObject(ctx, "dir/file name")
+	assert.True(t, a.IsNotFound(err))
+
+	aborted, err := a.InitiateMultipartUpload(ctx, "aborted")
+	require.NoError(t, err)
+	require.NoError(t, a.AbortMultipartUpload(ctx, aborted.UploadID, "aborted"))
+	assert.True(t, a.IsNotFound(a.AbortMultipartUpload(ctx, aborted.UploadID, "aborted")))
+}
+
+func TestFormData(t *testing.T) {
+	ctx := context.Background()
+	a, stub := newTestAws(t)
+
+	fd, err := a.FormData(ctx, "form/image.png", 1024, "image/png", time.Minute)
+	require.NoError(t, err)
+	post := func() int {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		for k, v := range fd.FormData {
+			require.NoError(t, w.WriteField(k, v))
+		}
+		fw, err := w.CreateFormFile(fd.File, "image.png")
+		require.NoError(t, err)
+		_, _ = fw.Write([]byte("png"))
+		require.NoError(t, w.Close())
+		resp, _ := s3test.Do(t, http.MethodPost, fd.URL, http.Header{"Content-Type": {w.FormDataContentType()}}, buf.Bytes())
+		return resp.StatusCode
+	}
+	assert.Equal(t, fd.SuccessCodes[0], post())
+	assert.Equal(t, []byte("png"), stub.objects["form/image.png"].data)
+	assert.Equal(t, "image/png", stub.objects["form/image.png"].contentType)
+
+	fd.FormData["key"] = "form/other.png"
+	assert.Equal(t, http.StatusForbidden, post())
+}
+
+func TestPutGetObject(t *testing.T) {
+	ctx := context.Background()
+	a, stub := newTestAws(t)
+
+	data := []byte("0123456789")
+	// A reader that cannot seek, as streamed server-side content usually is.
+	reader := io.MultiReader(bytes.NewReader(data))
+	info, err := a.PutObject(ctx, "put/object", reader, int64(len(data)), "text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, s3test.MD5Hex(data), info.ETag)
+	assert.Equal(t, "text/plain", stub.objects["put/object"].contentType)
+
+	read := func(rng *s3.ObjectRange) string {
+		body, err := a.GetObject(ctx, "put/object", rng)
+		require.NoError(t, err)
+		defer body.Close()
+		content, err := io.ReadAll(body)
+		require.NoError(t, err)
+		return string(content)
+	}
+	assert.Equal(t, "0123456789", read(nil))
+	assert.Equal(t, "234", read(&s3.ObjectRange{Start: 2, End: 4}))
+	assert.Equal(t, "789", read(&s3.ObjectRange{Start: 7, End: -1}))
+
+	_, err = a.GetObject(ctx, "missing", nil)
+	assert.True(t, a.IsNotFound(err))
+}
+
+func TestListDeleteObjects(t *testing.T) {
+	ctx := context.Background()
+	a, stub := newTestAws(t)
+
+	keys := []string{"list/1", "list/2", "list/3", "list/sub/4", "locked/5", "other"}
+	for _, key := range keys {
+		_, err := a.PutObject(ctx, key, strings.NewReader(key), int64(len(key)), "")
+		require.NoError(t, err)
+	}
+
+	res, err := a.ListObjects(ctx, "list/", "", 3)
+	require.NoError(t, err)
+	require.Len(t, res.Objects, 3)
+	assert.True(t, res.IsTruncated)
+	assert.Equal(t, "list/1", res.Objects[0].Key)
+	assert.Equal(t, s3test.MD5Hex([]byte("list/1")), res.Objects[0].ETag)
+	assert.Equal(t, int64(6), res.Objects[0].Size)
+	assert.False(t, res.Objects[0].LastModified.IsZero())
+
+	var listed []string
+	it := s3.NewObjectIterator(a, "list/", 2)
+	for it.Next(ctx) {
+		listed = append(listed, it.Object().Key)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, keys[:4], listed)
+
+	err = a.DeleteObjects(ctx, []string{"list/1", "list/sub/4", "locked/5"})
+	var deleteErr *s3.DeleteObjectsError
+	require.ErrorAs(t, err, &deleteErr)
+	assert.Equal(t, map[string]string{"locked/5": "AccessDenied: Access Denied"}, deleteErr.Failed)
+	stub.mu.Lock()
+	assert.Len(t, stub.objects, 4)
+	assert.NotContains(t, stub.objects, "list/1")
+	stub.mu.Unlock()
+}
+
+func TestListMultipartUploads(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAws(t)
+
+	var ids []string
+	for _, name := range []string{"m/1", "m/1", "m/2", "other"} {
+		upload, err := a.InitiateMultipartUpload(ctx, name)
+		require.NoError(t, err)
+		ids = append(ids, upload.UploadID)
+	}
+
+	res, err := a.ListMultipartUploads(ctx, "m/", "", "", 2)
+	require.NoError(t, err)
+	require.Len(t, res.Uploads, 2)
+	assert.True(t, res.IsTruncated)
+	assert.Equal(t, s3.MultipartUpload{Key: "m/1", UploadID: ids[1], Initiated: res.Uploads[1].Initiated}, res.Uploads[1])
+	assert.False(t, res.Uploads[1].Initiated.IsZero())
+
+	res, err = a.ListMultipartUploads(ctx, "m/", res.NextKeyMarker, res.NextUploadIDMarker, 2)
+	require.NoError(t, err)
+	require.Len(t, res.Uploads, 1)
+	assert.Equal(t, ids[2], res.Uploads[0].UploadID)
+	assert.False(t, res.IsTruncated)
+}
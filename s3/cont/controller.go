@@ -20,6 +20,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"path"
 	"strings"
 	"time"
@@ -250,6 +251,53 @@ func (c *Controller) CompleteUpload(ctx context.Context, uploadID string, partHa
 	}, nil
 }
 
+// UploadObject uploads content from the server side. It is stored under the hash path like
+// client uploads, content whose hash is already stored is not stored again.
+func (c *Controller) UploadObject(ctx context.Context, reader io.Reader, size int64, contentType string) (*UploadResult, error) {
+	partSize, err := c.impl.PartSize(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+	hasher := newPartHasher(partSize)
+	key := path.Join(tempPath, c.NowPath(), fmt.Sprintf("%d_%s.server", size, c.UUID()))
+	if _, err := c.impl.PutObject(ctx, key, io.TeeReader(reader, hasher), size, contentType); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = c.impl.DeleteObject(ctx, key)
+	}()
+	if hasher.size != size {
+		return nil, errs.ErrArgs.WrapMsg("upload size mismatching", "size", size, "read", hasher.size)
+	}
+	hash := hasher.Sum()
+	if info, err := c.StatObject(ctx, c.HashPath(hash)); err == nil {
+		return &UploadResult{
+			Key:  info.Key,
+			Size: info.Size,
+			Hash: hash,
+		}, nil
+	} else if !c.IsNotFound(err) {
+		return nil, err
+	}
+	copyInfo, err := c.impl.CopyObject(ctx, key, c.HashPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.cache.DelS3Key(ctx, c.impl.Engine(), copyInfo.Key); err != nil {
+		return nil, err
+	}
+	return &UploadResult{
+		Key:  copyInfo.Key,
+		Size: size,
+		Hash: hash,
+	}, nil
+}
+
+// GetObject reads name, or only the bytes selected by rng when it is not nil.
+func (c *Controller) GetObject(ctx context.Context, name string, rng *s3.ObjectRange) (io.ReadCloser, error) {
+	return c.impl.GetObject(ctx, name, rng)
+}
+
 func (c *Controller) AuthSign(ctx context.Context, uploadID string, partNumbers []int) (*s3.AuthSignResult, error) {
 	upload, err := parseMultipartUploadID(uploadID)
 	if err != nil {
@@ -284,3 +332,49 @@ func (c *Controller) FormData(ctx context.Context, name string, size int64, cont
 func (c *Controller) DeleteObject(ctx context.Context, name string) error {
 	return c.impl.DeleteObject(ctx, name)
 }
+
+// CleanTemp deletes the temp objects of presigned and server side uploads that were last
+// modified more than olderThan ago and aborts multipart uploads initiated before then. Those
+// are left behind when a client never completes its upload. On error the result still counts
+// what was cleaned before it.
+func (c *Controller) CleanTemp(ctx context.Context, olderThan time.Duration) (*CleanTempResult, error) {
+	deadline := time.Now().Add(-olderThan)
+	res := &CleanTempResult{}
+	names := make([]string, 0, s3.MaxDeleteObjects)
+	var size int64
+	flush := func() error {
+		if len(names) == 0 {
+			return nil
+		}
+		if err := c.impl.DeleteObjects(ctx, names); err != nil {
+			return err
+		}
+		res.Objects += len(names)
+		res.Size += size
+		names, size = names[:0], 0
+		return nil
+	}
+	it := s3.NewObjectIterator(c.impl, tempPath, 0)
+	for it.Next(ctx) {
+		obj := it.Object()
+		if !obj.LastModified.Before(deadline) {
+			continue
+		}
+		names = append(names, obj.Key)
+		size += obj.Size
+		if len(names) == s3.MaxDeleteObjects {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return res, err
+	}
+	if err := flush(); err != nil {
+		return res, err
+	}
+	report, err := c.ReapUploads(ctx, olderThan, false)
+	res.Uploads, res.UploadSize = report.Aborted, report.Bytes
+	return res, err
+}
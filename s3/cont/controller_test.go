@@ -0,0 +1,298 @@
+package cont_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/cont"
+	"github.com/openimsdk/tools/s3/internal/s3test"
+	"github.com/openimsdk/tools/s3/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Log to stdout only, the default logger writes files into ./logs.
+	if err := log.InitLoggerFromConfig("test", "cont", "", "", log.LevelDebug, true, false, "", 1, 24, "test", false); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newController returns a controller on a local engine served over HTTP, so presigned URLs work,
+// and the root directory of the engine.
+func newController(t *testing.T) (*cont.Controller, *local.Local, string) {
+	root := t.TempDir()
+	var l *local.Local
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Handler().ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	l, err := local.NewLocal(local.Config{Root: root, BaseURL: srv.URL + "/object", Secret: "secret"})
+	require.NoError(t, err)
+	return cont.New(s3test.StatCache{Impl: l}, l), l, root
+}
+
+// backdateObject sets the modification time of an object of the local engine stored under root.
+func backdateObject(t *testing.T, root string, key string, age time.Duration) {
+	old := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "objects", filepath.FromSlash(key)+".data"), old, old))
+}
+
+func get(t *testing.T, ctx context.Context, impl s3.Interface, name string) []byte {
+	rawURL, err := impl.AccessURL(ctx, name, time.Minute, &s3.AccessURLOption{})
+	require.NoError(t, err)
+	resp, data := s3test.Do(t, http.MethodGet, rawURL, nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return data
+}
+
+func listKeys(t *testing.T, ctx context.Context, impl s3.Interface, prefix string) []string {
+	res, err := impl.ListObjects(ctx, prefix, "", 0)
+	require.NoError(t, err)
+	var keys []string
+	for _, obj := range res.Objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func TestControllerPresignedUpload(t *testing.T) {
+	ctx := context.Background()
+	c, l, _ := newController(t)
+
+	data := []byte(strings.Repeat("presigned", 100))
+	hash := s3test.MD5Hex([]byte(s3test.MD5Hex(data)))
+	upload, err := c.InitiateUpload(ctx, hash, int64(len(data)), time.Minute, -1)
+	require.NoError(t, err)
+	require.Len(t, upload.Sign.Parts, 1)
+
+	resp, _ := s3test.Do(t, http.MethodPut, upload.Sign.Parts[0].URL, nil, data)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"`+s3test.MD5Hex(data)+`"`, resp.Header.Get("ETag"))
+
+	result, err := c.CompleteUpload(ctx, upload.UploadID, []string{s3test.MD5Hex(data)})
+	require.NoError(t, err)
+	assert.Equal(t, c.HashPath(hash), result.Key)
+	assert.Equal(t, data, get(t, ctx, l, result.Key))
+	assert.Empty(t, listKeys(t, ctx, l, "openim/temp/"), "temporary objects are removed")
+
+	_, err = c.InitiateUpload(ctx, hash, int64(len(data)), time.Minute, -1)
+	var exists *cont.HashAlreadyExistsError
+	assert.ErrorAs(t, err, &exists)
+}
+
+func TestControllerMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	c, l, _ := newController(t)
+
+	minPartSize := l.PartLimit().MinPartSize
+	data := make([]byte, minPartSize*5/2)
+	rand.New(rand.NewSource(1)).Read(data)
+	partSize, err := l.PartSize(ctx, int64(len(data)))
+	require.NoError(t, err)
+	var partHashes []string
+	var digests []byte
+	for off := int64(0); off < int64(len(data)); off += partSize {
+		part := data[off:min(off+partSize, int64(len(data)))]
+		sum := md5.Sum(part)
+		partHashes = append(partHashes, hex.EncodeToString(sum[:]))
+		digests = append(digests, sum[:]...)
+	}
+	require.Len(t, partHashes, 3)
+	hash := s3test.MD5Hex([]byte(strings.Join(partHashes, ",")))
+
+	upload, err := c.InitiateUpload(ctx, hash, int64(len(data)), time.Minute, -1)
+	require.NoError(t, err)
+	require.Len(t, upload.Sign.Parts, 3)
+	for i, part := range upload.Sign.Parts {
+		query := url.Values{}
+		for k, v := range upload.Sign.Query {
+			query[k] = v
+		}
+		for k, v := range part.Query {
+			query[k] = v
+		}
+		off := int64(i) * partSize
+		resp, body := s3test.Do(t, http.MethodPut, upload.Sign.URL+"?"+query.Encode(), part.Header, data[off:min(off+partSize, int64(len(data)))])
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	}
+
+	_, err = c.CompleteUpload(ctx, upload.UploadID, []string{partHashes[0], partHashes[0], partHashes[2]})
+	assert.Error(t, err, "part hashes must match the upload hash")
+
+	result, err := c.CompleteUpload(ctx, upload.UploadID, partHashes)
+	require.NoError(t, err)
+	info, err := l.StatObject(ctx, result.Key)
+	require.NoError(t, err)
+	// The ETag S3 gives a multipart object.
+	assert.Equal(t, s3test.MD5Hex(digests)+"-"+strconv.Itoa(len(partHashes)), info.ETag)
+	assert.Equal(t, int64(len(data)), info.Size)
+	assert.Equal(t, data, get(t, ctx, l, result.Key))
+}
+
+func TestControllerUploadObject(t *testing.T) {
+	ctx := context.Background()
+	c, l, _ := newController(t)
+
+	minPartSize := l.PartLimit().MinPartSize
+	data := make([]byte, minPartSize*3/2)
+	rand.New(rand.NewSource(2)).Read(data)
+	hash := s3test.MD5Hex([]byte(s3test.MD5Hex(data[:minPartSize]) + "," + s3test.MD5Hex(data[minPartSize:])))
+
+	result, err := c.UploadObject(ctx, bytes.NewReader(data), int64(len(data)), "application/octet-stream")
+	require.NoError(t, err)
+	assert.Equal(t, hash, result.Hash)
+	assert.Equal(t, c.HashPath(hash), result.Key)
+	assert.Equal(t, data, get(t, ctx, l, result.Key))
+
+	again, err := c.UploadObject(ctx, bytes.NewReader(data), int64(len(data)), "")
+	require.NoError(t, err)
+	assert.Equal(t, result, again)
+	_, err = c.InitiateUpload(ctx, hash, int64(len(data)), time.Minute, -1)
+	var exists *cont.HashAlreadyExistsError
+	assert.ErrorAs(t, err, &exists, "server uploads share the client hash path")
+	assert.Empty(t, listKeys(t, ctx, l, "openim/temp/"))
+
+	_, err = c.UploadObject(ctx, bytes.NewReader(data[:10]), 20, "")
+	assert.Error(t, err)
+}
+
+func TestControllerCleanTemp(t *testing.T) {
+	ctx := context.Background()
+	c, l, root := newController(t)
+
+	data := []byte("abandoned")
+	upload, err := c.InitiateUpload(ctx, s3test.MD5Hex([]byte(s3test.MD5Hex(data))), int64(len(data)), time.Minute, -1)
+	require.NoError(t, err)
+	resp, _ := s3test.Do(t, http.MethodPut, upload.Sign.Parts[0].URL, nil, data)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	fresh := "openim/temp/fresh.presigned"
+	_, err = l.PutObject(ctx, fresh, strings.NewReader("fresh"), 5, "")
+	require.NoError(t, err)
+	kept := "openim/data/kept"
+	_, err = l.PutObject(ctx, kept, strings.NewReader("kept"), 4, "")
+	require.NoError(t, err)
+
+	temp := listKeys(t, ctx, l, "openim/temp/")
+	require.Len(t, temp, 2)
+	for _, key := range temp {
+		if key != fresh {
+			backdateObject(t, root, key, 2*time.Hour)
+		}
+	}
+
+	result, err := c.CleanTemp(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Objects)
+	assert.Equal(t, int64(len(data)), result.Size)
+	assert.Equal(t, []string{kept, fresh}, listKeys(t, ctx, l, "openim/"))
+}
+
+// initiateOld starts a multipart upload of name on the local engine stored under root, uploads
+// parts through presigned URLs and moves its initiation time age into the past.
+func initiateOld(t *testing.T, ctx context.Context, l *local.Local, root string, name string, age time.Duration, parts ...string) string {
+	upload, err := l.InitiateMultipartUpload(ctx, name)
+	require.NoError(t, err)
+	if len(parts) > 0 {
+		partNumbers := make([]int, len(parts))
+		for i := range parts {
+			partNumbers[i] = i + 1
+		}
+		sign, err := l.AuthSign(ctx, upload.UploadID, upload.Key, time.Minute, partNumbers)
+		require.NoError(t, err)
+		for i, part := range sign.Parts {
+			query := url.Values{}
+			for k, v := range sign.Query {
+				query[k] = v
+			}
+			for k, v := range part.Query {
+				query[k] = v
+			}
+			resp, body := s3test.Do(t, http.MethodPut, sign.URL+"?"+query.Encode(), part.Header, []byte(parts[i]))
+			require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		}
+	}
+	path := filepath.Join(root, "uploads", upload.UploadID, "upload.json")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var meta struct {
+		Key       string    `json:"key"`
+		Initiated time.Time `json:"initiated"`
+	}
+	require.NoError(t, json.Unmarshal(data, &meta))
+	meta.Initiated = meta.Initiated.Add(-age)
+	data, err = json.Marshal(meta)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return upload.UploadID
+}
+
+func uploadIDs(t *testing.T, ctx context.Context, l *local.Local) []string {
+	res, err := l.ListMultipartUploads(ctx, "", "", "", 0)
+	require.NoError(t, err)
+	var ids []string
+	for _, upload := range res.Uploads {
+		ids = append(ids, upload.UploadID)
+	}
+	return ids
+}
+
+func TestControllerReapUploads(t *testing.T) {
+	ctx := context.Background()
+	c, l, root := newController(t)
+
+	old := initiateOld(t, ctx, l, root, c.HashPath(s3test.MD5Hex([]byte("old"))), 2*time.Hour, "part1", "part2")
+	initiateOld(t, ctx, l, root, c.HashPath(s3test.MD5Hex([]byte("new"))), 0, "part")
+	initiateOld(t, ctx, l, root, "foreign", 2*time.Hour, "part")
+
+	report, err := c.ReapUploads(ctx, time.Hour, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	require.Len(t, report.Uploads, 1)
+	assert.Equal(t, old, report.Uploads[0].UploadID)
+	assert.Equal(t, int64(10), report.Uploads[0].Size)
+	assert.Equal(t, 0, report.Aborted)
+	assert.Equal(t, int64(10), report.Bytes)
+	assert.Len(t, uploadIDs(t, ctx, l), 3)
+
+	reports := make(chan *cont.ReapReport, 1)
+	reaper := cont.NewUploadReaper(c, time.Hour, cont.WithReapInterval(time.Hour), cont.WithReportHandler(func(ctx context.Context, report *cont.ReapReport, err error) {
+		assert.NoError(t, err)
+		reports <- report
+	}))
+	reaper.Start(ctx)
+	select {
+	case report = <-reports:
+	case <-time.After(10 * time.Second):
+		t.Fatal("reaper did not run")
+	}
+	reaper.Stop()
+	assert.False(t, report.DryRun)
+	assert.Equal(t, 1, report.Aborted)
+	assert.Equal(t, int64(10), report.Bytes)
+	ids := uploadIDs(t, ctx, l)
+	assert.Len(t, ids, 2)
+	assert.NotContains(t, ids, old)
+
+	initiateOld(t, ctx, l, root, c.HashPath(s3test.MD5Hex([]byte("abandoned"))), 2*time.Hour, "abandoned")
+	result, err := c.CleanTemp(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Uploads)
+	assert.Equal(t, int64(9), result.UploadSize)
+}
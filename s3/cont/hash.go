@@ -0,0 +1,66 @@
+// Copyright © 2023 OpenIM. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cont
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"hash"
+	"strings"
+)
+
+// partHasher computes the hash clients pass to InitiateUpload: the MD5 of the hex MD5s of
+// every part, joined by partSeparator.
+type partHasher struct {
+	partSize int64
+	size     int64
+	written  int64 // bytes in the current part
+	part     hash.Hash
+	hashes   []string
+}
+
+func newPartHasher(partSize int64) *partHasher {
+	return &partHasher{partSize: partSize, part: md5.New()}
+}
+
+func (h *partHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := p
+		if rest := h.partSize - h.written; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		h.part.Write(chunk)
+		h.written += int64(len(chunk))
+		h.size += int64(len(chunk))
+		p = p[len(chunk):]
+		if h.written == h.partSize {
+			h.hashes = append(h.hashes, hex.EncodeToString(h.part.Sum(nil)))
+			h.part.Reset()
+			h.written = 0
+		}
+	}
+	return n, nil
+}
+
+// Sum returns the hash of everything written so far.
+func (h *partHasher) Sum() string {
+	hashes := h.hashes
+	if h.written > 0 {
+		hashes = append(hashes[:len(hashes):len(hashes)], hex.EncodeToString(h.part.Sum(nil)))
+	}
+	sum := md5.Sum([]byte(strings.Join(hashes, partSeparator)))
+	return hex.EncodeToString(sum[:])
+}
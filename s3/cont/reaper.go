@@ -0,0 +1,212 @@
+// Copyright © 2023 OpenIM. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cont
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/log"
+)
+
+const (
+	defaultReapInterval = time.Hour
+	listPartsLimit      = 1000
+)
+
+// ReapedUpload is an abandoned multipart upload found by ReapUploads.
+type ReapedUpload struct {
+	Key       string    `json:"key"`
+	UploadID  string    `json:"uploadID"`
+	Initiated time.Time `json:"initiated"`
+	// Size is the total size of the parts uploaded so far.
+	Size int64 `json:"size"`
+	// Error is set when the upload could not be aborted.
+	Error string `json:"error,omitempty"`
+}
+
+// ReapReport describes one ReapUploads run.
+type ReapReport struct {
+	DryRun  bool           `json:"dryRun"`
+	Uploads []ReapedUpload `json:"uploads"`
+	// Aborted is the number of uploads aborted, always 0 in dry-run mode.
+	Aborted int `json:"aborted"`
+	// Bytes is the size of the parts reclaimed, or that would be reclaimed in dry-run mode.
+	Bytes int64 `json:"bytes"`
+}
+
+// ReapUploads aborts the multipart uploads started by InitiateUpload more than ttl ago. Their
+// upload IDs only live in the client's uploadID, so a client that goes away leaves its parts
+// behind forever. With dryRun the uploads are reported but left alone. Uploads that fail to
+// abort are reported with their error and do not fail the run.
+func (c *Controller) ReapUploads(ctx context.Context, ttl time.Duration, dryRun bool) (*ReapReport, error) {
+	deadline := time.Now().Add(-ttl)
+	report := &ReapReport{DryRun: dryRun}
+	var keyMarker, uploadIDMarker string
+	for {
+		res, err := c.impl.ListMultipartUploads(ctx, hashPath, keyMarker, uploadIDMarker, 0)
+		if err != nil {
+			return report, err
+		}
+		for _, upload := range res.Uploads {
+			if !upload.Initiated.Before(deadline) {
+				continue
+			}
+			size, err := c.uploadedSize(ctx, upload.UploadID, upload.Key)
+			if err != nil {
+				if c.impl.IsNotFound(err) {
+					continue // completed or aborted in the meantime
+				}
+				return report, err
+			}
+			reaped := ReapedUpload{
+				Key:       upload.Key,
+				UploadID:  upload.UploadID,
+				Initiated: upload.Initiated,
+				Size:      size,
+			}
+			if !dryRun {
+				if err := c.impl.AbortMultipartUpload(ctx, upload.UploadID, upload.Key); err != nil {
+					if c.impl.IsNotFound(err) {
+						continue
+					}
+					reaped.Error = err.Error()
+					report.Uploads = append(report.Uploads, reaped)
+					continue
+				}
+				report.Aborted++
+			}
+			report.Bytes += size
+			report.Uploads = append(report.Uploads, reaped)
+		}
+		if !res.IsTruncated || (res.NextKeyMarker == "" && res.NextUploadIDMarker == "") {
+			return report, nil
+		}
+		keyMarker, uploadIDMarker = res.NextKeyMarker, res.NextUploadIDMarker
+	}
+}
+
+// uploadedSize sums the sizes of the parts uploaded to an unfinished multipart upload.
+func (c *Controller) uploadedSize(ctx context.Context, uploadID string, name string) (int64, error) {
+	var size int64
+	marker := 0
+	for {
+		res, err := c.impl.ListUploadedParts(ctx, uploadID, name, marker, listPartsLimit)
+		if err != nil {
+			return 0, err
+		}
+		for _, part := range res.UploadedParts {
+			size += part.Size
+		}
+		if len(res.UploadedParts) < listPartsLimit || res.NextPartNumberMarker <= marker {
+			return size, nil
+		}
+		marker = res.NextPartNumberMarker
+	}
+}
+
+type ReaperOption func(*UploadReaper)
+
+// WithReapInterval sets how often the reaper runs, one hour by default.
+func WithReapInterval(interval time.Duration) ReaperOption {
+	return func(r *UploadReaper) {
+		if interval > 0 {
+			r.interval = interval
+		}
+	}
+}
+
+// WithDryRun makes the reaper only report the uploads it would abort.
+func WithDryRun() ReaperOption {
+	return func(r *UploadReaper) {
+		r.dryRun = true
+	}
+}
+
+// WithReportHandler receives the report of every run. Without it reports are logged.
+func WithReportHandler(fn func(ctx context.Context, report *ReapReport, err error)) ReaperOption {
+	return func(r *UploadReaper) {
+		r.onReport = fn
+	}
+}
+
+// UploadReaper runs Controller.ReapUploads in the background.
+type UploadReaper struct {
+	ctrl     *Controller
+	ttl      time.Duration
+	interval time.Duration
+	dryRun   bool
+	onReport func(ctx context.Context, report *ReapReport, err error)
+
+	once sync.Once
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewUploadReaper returns a reaper aborting uploads older than ttl. Call Start to run it.
+func NewUploadReaper(ctrl *Controller, ttl time.Duration, opts ...ReaperOption) *UploadReaper {
+	r := &UploadReaper{
+		ctrl:     ctrl,
+		ttl:      ttl,
+		interval: defaultReapInterval,
+		onReport: logReapReport,
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Start runs the reaper once right away and then every interval, until Stop is called or ctx
+// is done.
+func (r *UploadReaper) Start(ctx context.Context) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			report, err := r.ctrl.ReapUploads(ctx, r.ttl, r.dryRun)
+			r.onReport(ctx, report, err)
+			select {
+			case <-r.done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the reaper and waits for a running pass to finish.
+func (r *UploadReaper) Stop() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+	r.wg.Wait()
+}
+
+func logReapReport(ctx context.Context, report *ReapReport, err error) {
+	if err != nil {
+		log.ZError(ctx, "reap multipart uploads failed", err, "dryRun", report.DryRun, "aborted", report.Aborted, "bytes", report.Bytes)
+		return
+	}
+	if len(report.Uploads) > 0 {
+		log.ZInfo(ctx, "reaped multipart uploads", "dryRun", report.DryRun, "uploads", len(report.Uploads), "aborted", report.Aborted, "bytes", report.Bytes)
+	}
+}
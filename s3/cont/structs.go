@@ -32,3 +32,17 @@ type UploadResult struct {
 	Size int64  `json:"size"`
 	Key  string `json:"key"`
 }
+
+type CleanTempResult struct {
+	// Objects is the number of temp objects deleted.
+	Objects int `json:"objects"`
+
+	// Size is the total size of the deleted temp objects in bytes.
+	Size int64 `json:"size"`
+
+	// Uploads is the number of abandoned multipart uploads aborted.
+	Uploads int `json:"uploads"`
+
+	// UploadSize is the total size of the parts of the aborted uploads in bytes.
+	UploadSize int64 `json:"uploadSize"`
+}
@@ -23,6 +23,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -181,11 +182,105 @@ func (c *Cos) PresignedPutObject(ctx context.Context, name string, expire time.D
 	return rawURL.String(), nil
 }
 
+func (c *Cos) PutObject(ctx context.Context, name string, reader io.Reader, size int64, contentType string) (*s3.PutObjectInfo, error) {
+	if name != "" && name[0] == '/' {
+		name = name[1:]
+	}
+	resp, err := c.client.Object.Put(ctx, name, reader, &cos.ObjectPutOptions{
+		ObjectPutHeaderOptions: &cos.ObjectPutHeaderOptions{
+			ContentType:   contentType,
+			ContentLength: size,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectInfo{
+		Key:  name,
+		ETag: strings.ToLower(strings.ReplaceAll(resp.Header.Get("ETag"), `"`, "")),
+		Size: size,
+	}, nil
+}
+
+func (c *Cos) GetObject(ctx context.Context, name string, rng *s3.ObjectRange) (io.ReadCloser, error) {
+	if name != "" && name[0] == '/' {
+		name = name[1:]
+	}
+	opt := &cos.ObjectGetOptions{}
+	if rng != nil {
+		opt.Range = rng.HeaderValue()
+	}
+	resp, err := c.client.Object.Get(ctx, name, opt)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
 func (c *Cos) DeleteObject(ctx context.Context, name string) error {
 	_, err := c.client.Object.Delete(ctx, name)
 	return err
 }
 
+func (c *Cos) DeleteObjects(ctx context.Context, names []string) error {
+	failed := make(map[string]string)
+	for start := 0; start < len(names); start += s3.MaxDeleteObjects {
+		batch := names[start:min(start+s3.MaxDeleteObjects, len(names))]
+		objects := make([]cos.Object, len(batch))
+		for i, name := range batch {
+			objects[i] = cos.Object{Key: strings.TrimPrefix(name, "/")}
+		}
+		result, _, err := c.client.Object.DeleteMulti(ctx, &cos.ObjectDeleteMultiOptions{Quiet: true, Objects: objects})
+		if err != nil {
+			return err
+		}
+		for _, e := range result.Errors {
+			failed[e.Key] = e.Code + ": " + e.Message
+		}
+	}
+	if len(failed) > 0 {
+		return &s3.DeleteObjectsError{Failed: failed}
+	}
+	return nil
+}
+
+// ListObjects lists with markers, the continuation token is the key the next page starts after.
+func (c *Cos) ListObjects(ctx context.Context, prefix string, continuationToken string, limit int) (*s3.ListObjectsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	result, _, err := c.client.Bucket.Get(ctx, &cos.BucketGetOptions{
+		Prefix:  prefix,
+		Marker:  continuationToken,
+		MaxKeys: limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListObjectsResult{
+		Objects:     make([]s3.ObjectInfo, len(result.Contents)),
+		IsTruncated: result.IsTruncated,
+	}
+	for i, object := range result.Contents {
+		lastModified, err := time.Parse(time.RFC3339, object.LastModified)
+		if err != nil {
+			return nil, fmt.Errorf("ListObjects last-modified parse error: %w", err)
+		}
+		res.Objects[i] = s3.ObjectInfo{
+			ETag:         strings.ToLower(strings.ReplaceAll(object.ETag, `"`, "")),
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: lastModified,
+		}
+	}
+	if res.IsTruncated {
+		if res.NextContinuationToken = result.NextMarker; res.NextContinuationToken == "" && len(res.Objects) > 0 {
+			res.NextContinuationToken = res.Objects[len(res.Objects)-1].Key
+		}
+	}
+	return res, nil
+}
+
 func (c *Cos) StatObject(ctx context.Context, name string) (*s3.ObjectInfo, error) {
 	if name != "" && name[0] == '/' {
 		name = name[1:]
@@ -273,6 +368,39 @@ func (c *Cos) ListUploadedParts(ctx context.Context, uploadID string, name strin
 	return res, nil
 }
 
+func (c *Cos) ListMultipartUploads(ctx context.Context, prefix string, keyMarker string, uploadIDMarker string, limit int) (*s3.ListMultipartUploadsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	result, _, err := c.client.Bucket.ListMultipartUploads(ctx, &cos.ListMultipartUploadsOptions{
+		Prefix:         prefix,
+		KeyMarker:      keyMarker,
+		UploadIDMarker: uploadIDMarker,
+		MaxUploads:     limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListMultipartUploadsResult{
+		Uploads:            make([]s3.MultipartUpload, len(result.Uploads)),
+		NextKeyMarker:      result.NextKeyMarker,
+		NextUploadIDMarker: result.NextUploadIDMarker,
+		IsTruncated:        result.IsTruncated,
+	}
+	for i, upload := range result.Uploads {
+		initiated, err := time.Parse(time.RFC3339, upload.Initiated)
+		if err != nil {
+			return nil, fmt.Errorf("ListMultipartUploads initiated parse error: %w", err)
+		}
+		res.Uploads[i] = s3.MultipartUpload{
+			Key:       upload.Key,
+			UploadID:  upload.UploadID,
+			Initiated: initiated,
+		}
+	}
+	return res, nil
+}
+
 func (c *Cos) AccessURL(ctx context.Context, name string, expire time.Duration, opt *s3.AccessURLOption) (string, error) {
 	var imageMogr string
 	var option cos.PresignedURLOptions
@@ -0,0 +1,66 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3test holds helpers shared by the tests of the s3 engines and the controller.
+package s3test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/openimsdk/tools/s3"
+	"github.com/stretchr/testify/require"
+)
+
+// StatCache is a cont.S3Cache without caching.
+type StatCache struct {
+	Impl s3.Interface
+}
+
+func (c StatCache) GetKey(ctx context.Context, engine string, key string) (*s3.ObjectInfo, error) {
+	return c.Impl.StatObject(ctx, key)
+}
+
+func (c StatCache) DelS3Key(ctx context.Context, engine string, keys ...string) error {
+	return nil
+}
+
+// MD5Hex returns the hex encoded MD5 of data, the hash format used by the controller.
+func MD5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Do sends a request, e.g. to a presigned URL, and returns the response with its body read.
+// A signed Host header is left to the HTTP client, which sets it from the URL.
+func Do(t testing.TB, method string, rawURL string, header http.Header, body []byte) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		if k != "Host" {
+			req.Header[k] = v
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, data
+}
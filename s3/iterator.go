@@ -0,0 +1,81 @@
+// Copyright © 2023 OpenIM. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import "context"
+
+// ObjectIterator walks the objects under a prefix, listing them page by page.
+//
+//	it := s3.NewObjectIterator(impl, prefix, 0)
+//	for it.Next(ctx) {
+//		obj := it.Object()
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type ObjectIterator struct {
+	impl     Interface
+	prefix   string
+	pageSize int
+	token    string
+	page     []ObjectInfo
+	index    int
+	done     bool
+	err      error
+}
+
+// NewObjectIterator returns an iterator over the objects under prefix. A pageSize of 0 lets
+// the engine choose the page size.
+func NewObjectIterator(impl Interface, prefix string, pageSize int) *ObjectIterator {
+	return &ObjectIterator{
+		impl:     impl,
+		prefix:   prefix,
+		pageSize: pageSize,
+		index:    -1,
+	}
+}
+
+// Next advances to the next object, listing the next page when needed. It returns false
+// when there are no more objects or listing failed.
+func (it *ObjectIterator) Next(ctx context.Context) bool {
+	for it.err == nil {
+		if it.index+1 < len(it.page) {
+			it.index++
+			return true
+		}
+		if it.done {
+			return false
+		}
+		res, err := it.impl.ListObjects(ctx, it.prefix, it.token, it.pageSize)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.index = res.Objects, -1
+		it.token = res.NextContinuationToken
+		it.done = !res.IsTruncated || it.token == ""
+	}
+	return false
+}
+
+// Object returns the current object.
+func (it *ObjectIterator) Object() *ObjectInfo {
+	return &it.page[it.index]
+}
+
+// Err returns the error that stopped the iteration.
+func (it *ObjectIterator) Err() error {
+	return it.err
+}
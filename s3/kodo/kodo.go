@@ -29,6 +29,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	awss3config "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
@@ -204,6 +205,43 @@ func (k Kodo) PresignedPutObject(ctx context.Context, name string, expire time.D
 
 }
 
+func (k Kodo) PutObject(ctx context.Context, name string, reader io.Reader, size int64, contentType string) (*s3.PutObjectInfo, error) {
+	input := &awss3.PutObjectInput{
+		Bucket:        aws.String(k.Region),
+		Key:           aws.String(name),
+		Body:          reader,
+		ContentLength: aws.Int64(size),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	// The body is streamed, so it is sent unsigned instead of being read twice to hash it.
+	result, err := k.Client.PutObject(ctx, input, awss3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
+	if err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectInfo{
+		Key:  name,
+		ETag: strings.ToLower(strings.ReplaceAll(aws.ToString(result.ETag), `"`, ``)),
+		Size: size,
+	}, nil
+}
+
+func (k Kodo) GetObject(ctx context.Context, name string, rng *s3.ObjectRange) (io.ReadCloser, error) {
+	input := &awss3.GetObjectInput{
+		Bucket: aws.String(k.Region),
+		Key:    aws.String(name),
+	}
+	if rng != nil {
+		input.Range = aws.String(rng.HeaderValue())
+	}
+	result, err := k.Client.GetObject(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return result.Body, nil
+}
+
 func (k Kodo) DeleteObject(ctx context.Context, name string) error {
 	_, err := k.Client.DeleteObject(ctx, &awss3.DeleteObjectInput{
 		Bucket: aws.String(k.Region),
@@ -212,6 +250,63 @@ func (k Kodo) DeleteObject(ctx context.Context, name string) error {
 	return err
 }
 
+func (k Kodo) DeleteObjects(ctx context.Context, names []string) error {
+	failed := make(map[string]string)
+	for start := 0; start < len(names); start += s3.MaxDeleteObjects {
+		batch := names[start:min(start+s3.MaxDeleteObjects, len(names))]
+		objects := make([]awss3types.ObjectIdentifier, len(batch))
+		for i, name := range batch {
+			objects[i] = awss3types.ObjectIdentifier{Key: aws.String(name)}
+		}
+		result, err := k.Client.DeleteObjects(ctx, &awss3.DeleteObjectsInput{
+			Bucket: aws.String(k.Region),
+			Delete: &awss3types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range result.Errors {
+			failed[aws.ToString(e.Key)] = aws.ToString(e.Code) + ": " + aws.ToString(e.Message)
+		}
+	}
+	if len(failed) > 0 {
+		return &s3.DeleteObjectsError{Failed: failed}
+	}
+	return nil
+}
+
+func (k Kodo) ListObjects(ctx context.Context, prefix string, continuationToken string, limit int) (*s3.ListObjectsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	input := &awss3.ListObjectsV2Input{
+		Bucket:  aws.String(k.Region),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(int32(limit)),
+	}
+	if continuationToken != "" {
+		input.ContinuationToken = aws.String(continuationToken)
+	}
+	result, err := k.Client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListObjectsResult{
+		Objects:               make([]s3.ObjectInfo, len(result.Contents)),
+		NextContinuationToken: aws.ToString(result.NextContinuationToken),
+		IsTruncated:           aws.ToBool(result.IsTruncated),
+	}
+	for i, object := range result.Contents {
+		res.Objects[i] = s3.ObjectInfo{
+			ETag:         strings.ToLower(strings.ReplaceAll(aws.ToString(object.ETag), `"`, ``)),
+			Key:          aws.ToString(object.Key),
+			Size:         aws.ToInt64(object.Size),
+			LastModified: aws.ToTime(object.LastModified),
+		}
+	}
+	return res, nil
+}
+
 func (k Kodo) CopyObject(ctx context.Context, src string, dst string) (*s3.CopyObjectInfo, error) {
 	result, err := k.Client.CopyObject(ctx, &awss3.CopyObjectInput{
 		Bucket:     aws.String(k.Region),
@@ -294,6 +389,41 @@ func (k Kodo) ListUploadedParts(ctx context.Context, uploadID string, name strin
 	return res, nil
 }
 
+func (k Kodo) ListMultipartUploads(ctx context.Context, prefix string, keyMarker string, uploadIDMarker string, limit int) (*s3.ListMultipartUploadsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	input := &awss3.ListMultipartUploadsInput{
+		Bucket:     aws.String(k.Region),
+		Prefix:     aws.String(prefix),
+		MaxUploads: aws.Int32(int32(limit)),
+	}
+	if keyMarker != "" {
+		input.KeyMarker = aws.String(keyMarker)
+	}
+	if uploadIDMarker != "" {
+		input.UploadIdMarker = aws.String(uploadIDMarker)
+	}
+	result, err := k.Client.ListMultipartUploads(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListMultipartUploadsResult{
+		Uploads:            make([]s3.MultipartUpload, len(result.Uploads)),
+		NextKeyMarker:      aws.ToString(result.NextKeyMarker),
+		NextUploadIDMarker: aws.ToString(result.NextUploadIdMarker),
+		IsTruncated:        aws.ToBool(result.IsTruncated),
+	}
+	for i, upload := range result.Uploads {
+		res.Uploads[i] = s3.MultipartUpload{
+			Key:       aws.ToString(upload.Key),
+			UploadID:  aws.ToString(upload.UploadId),
+			Initiated: aws.ToTime(upload.Initiated),
+		}
+	}
+	return res, nil
+}
+
 func (k Kodo) AccessURL(ctx context.Context, name string, expire time.Duration, opt *s3.AccessURLOption) (string, error) {
 	//get object head
 	info, err := k.Client.HeadObject(ctx, &awss3.HeadObjectInput{
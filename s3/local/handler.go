@@ -0,0 +1,197 @@
+// Copyright © 2023 OpenIM. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+// maxFormFieldSize bounds the non-file fields of a FormData upload.
+const maxFormFieldSize = 64 * 1024
+
+// Handler returns the http.Handler serving the URLs handed out by the engine: presigned GET
+// and PUT of objects, PUT of multipart upload parts and FormData POST uploads. It must be
+// reachable at Config.BaseURL, request paths are expected to keep the base URL path.
+func (l *Local) Handler() http.Handler {
+	return http.HandlerFunc(l.serveHTTP)
+}
+
+func (l *Local) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutPrefix(r.URL.Path, l.basePath+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var err error
+	switch {
+	case r.Method == http.MethodPost && name == "":
+		err = l.servePost(w, r)
+	case name == "":
+		http.NotFound(w, r)
+		return
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		err = l.serveGet(w, r, name)
+	case r.Method == http.MethodPut:
+		err = l.servePut(w, r, name)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		l.writeError(r.Context(), w, err)
+	}
+}
+
+func (l *Local) writeError(ctx context.Context, w http.ResponseWriter, err error) {
+	var code int
+	switch {
+	case l.IsNotFound(err):
+		code = http.StatusNotFound
+	case errs.ErrNoPermission.Is(err):
+		code = http.StatusForbidden
+	case errs.ErrArgs.Is(err):
+		code = http.StatusBadRequest
+	default:
+		code = http.StatusInternalServerError
+		log.ZError(ctx, "local storage request failed", err)
+	}
+	http.Error(w, err.Error(), code)
+}
+
+func (l *Local) serveGet(w http.ResponseWriter, r *http.Request, name string) error {
+	query := r.URL.Query()
+	// A URL signed for GET is also valid for HEAD.
+	if err := l.verify(http.MethodGet, name, query); err != nil {
+		return err
+	}
+	f, info, meta, err := l.openObject(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := w.Header()
+	if contentType := query.Get("response-content-type"); contentType != "" {
+		header.Set("Content-Type", contentType)
+	} else if meta.ContentType != "" {
+		header.Set("Content-Type", meta.ContentType)
+	}
+	if disposition := query.Get("response-content-disposition"); disposition != "" {
+		header.Set("Content-Disposition", disposition)
+	}
+	header.Set("ETag", strconv.Quote(info.ETag))
+	http.ServeContent(w, r, path.Base(name), info.LastModified, f)
+	return nil
+}
+
+func (l *Local) servePut(w http.ResponseWriter, r *http.Request, name string) error {
+	query := r.URL.Query()
+	if err := l.verify(http.MethodPut, name, query); err != nil {
+		return err
+	}
+	var etag string
+	if uploadID := query.Get("uploadId"); uploadID != "" {
+		partNumber, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil {
+			return errs.ErrArgs.WrapMsg("invalid part number", "partNumber", query.Get("partNumber"))
+		}
+		if etag, err = l.putPart(uploadID, partNumber, r.Body); err != nil {
+			return err
+		}
+	} else {
+		t, err := l.writeTemp(r.Body, maxPartSize)
+		if err != nil {
+			return err
+		}
+		etag = t.etag()
+		if _, err := l.commitObject(t, name, objectMeta{ETag: etag, ContentType: r.Header.Get("Content-Type")}); err != nil {
+			return err
+		}
+	}
+	w.Header().Set("ETag", strconv.Quote(etag))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// servePost stores a FormData upload. As with S3 the file has to be the last form field,
+// the fields before it carry the signed policy.
+func (l *Local) servePost(w http.ResponseWriter, r *http.Request) error {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return errs.ErrArgs.WrapMsg("invalid multipart form", "err", err.Error())
+	}
+	fields := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return errs.ErrArgs.WrapMsg("form has no file field")
+		}
+		if err != nil {
+			return errs.ErrArgs.WrapMsg("invalid multipart form", "err", err.Error())
+		}
+		if part.FormName() != formFile {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+			if err != nil {
+				return errs.ErrArgs.WrapMsg("read form field failed", "field", part.FormName())
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+		policy, err := l.verifyPolicy(fields[formPolicy], fields[formSignature])
+		if err != nil {
+			return err
+		}
+		if fields[formKey] != policy.Key {
+			return errs.ErrNoPermission.WrapMsg("key does not match policy", "key", fields[formKey])
+		}
+		contentType := fields[formContentType]
+		if contentType == "" {
+			contentType = part.Header.Get("Content-Type")
+		}
+		if policy.ContentType != "" && !sameMediaType(contentType, policy.ContentType) {
+			return errs.ErrNoPermission.WrapMsg("content type does not match policy", "contentType", contentType)
+		}
+		limit := maxPartSize
+		if policy.MaxSize > 0 {
+			limit = policy.MaxSize
+		}
+		t, err := l.writeTemp(part, limit)
+		if err != nil {
+			return err
+		}
+		if _, err := l.commitObject(t, policy.Key, objectMeta{ETag: t.etag(), ContentType: contentType}); err != nil {
+			return err
+		}
+		w.Header().Set("ETag", strconv.Quote(t.etag()))
+		w.WriteHeader(successCode)
+		return nil
+	}
+}
+
+func sameMediaType(a, b string) bool {
+	ma, _, errA := mime.ParseMediaType(a)
+	mb, _, errB := mime.ParseMediaType(b)
+	return errA == nil && errB == nil && ma == mb
+}
@@ -0,0 +1,522 @@
+// Copyright © 2023 OpenIM. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+)
+
+const (
+	minPartSize int64 = 1024 * 1024 * 1        // 1MB
+	maxPartSize int64 = 1024 * 1024 * 1024 * 5 // 5GB
+	maxNumSize  int64 = 10000
+)
+
+const successCode = http.StatusOK
+
+var _ s3.Interface = (*Local)(nil)
+
+type Config struct {
+	// Root is the directory objects and pending multipart uploads are stored in.
+	Root string
+	// BaseURL is the external URL Handler is served at, presigned URLs are built on it.
+	BaseURL string
+	// Secret is the HMAC key presigned URLs and form policies are signed with.
+	Secret string
+}
+
+// NewLocal creates an engine storing objects below conf.Root. Presigned URLs point at
+// conf.BaseURL and are only usable when Handler is served there.
+func NewLocal(conf Config) (*Local, error) {
+	if conf.Root == "" {
+		return nil, errs.ErrArgs.WrapMsg("local storage root is empty")
+	}
+	if conf.Secret == "" {
+		return nil, errs.ErrArgs.WrapMsg("local storage secret is empty")
+	}
+	u, err := url.Parse(strings.TrimRight(conf.BaseURL, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errs.ErrArgs.WrapMsg("invalid local storage base url", "baseURL", conf.BaseURL)
+	}
+	for _, dir := range []string{objectsDir, uploadsDir, tempDir} {
+		if err := os.MkdirAll(filepath.Join(conf.Root, dir), 0o755); err != nil {
+			return nil, errs.WrapMsg(err, "create local storage dir failed", "root", conf.Root)
+		}
+	}
+	return &Local{
+		root:     conf.Root,
+		baseURL:  u.String(),
+		basePath: u.Path,
+		secret:   []byte(conf.Secret),
+	}, nil
+}
+
+type Local struct {
+	root     string
+	baseURL  string
+	basePath string
+	secret   []byte
+	mu       sync.RWMutex // guards commits against concurrent readers of data and metadata
+}
+
+func (l *Local) Engine() string {
+	return "local"
+}
+
+func (l *Local) PartLimit() *s3.PartLimit {
+	return &s3.PartLimit{
+		MinPartSize: minPartSize,
+		MaxPartSize: maxPartSize,
+		MaxNumSize:  maxNumSize,
+	}
+}
+
+// objectURL returns the URL of name below the base URL, escaping each path segment.
+func (l *Local) objectURL(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return l.baseURL + "/" + strings.Join(segments, "/")
+}
+
+func (l *Local) InitiateMultipartUpload(ctx context.Context, name string) (*s3.InitiateMultipartUploadResult, error) {
+	if _, err := l.objectPath(name); err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, errs.WrapMsg(err, "generate upload id failed")
+	}
+	uploadID := hex.EncodeToString(id)
+	dir, err := l.uploadPath(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(uploadMeta{Key: name, Initiated: time.Now()})
+	if err != nil {
+		return nil, errs.WrapMsg(err, "marshal upload failed")
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return nil, errs.WrapMsg(err, "create upload dir failed", "uploadID", uploadID)
+	}
+	if err := l.writeFile(filepath.Join(dir, uploadFile), data); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return &s3.InitiateMultipartUploadResult{
+		Key:      name,
+		UploadID: uploadID,
+	}, nil
+}
+
+func (l *Local) CompleteMultipartUpload(ctx context.Context, uploadID string, name string, parts []s3.Part) (*s3.CompleteMultipartUploadResult, error) {
+	if len(parts) == 0 {
+		return nil, errs.ErrArgs.WrapMsg("no parts to complete")
+	}
+	files, err := l.openParts(uploadID, name, parts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	readers := make([]io.Reader, len(files))
+	for i, f := range files {
+		readers[i] = f
+	}
+	t, err := l.writeTemp(io.MultiReader(readers...), -1)
+	if err != nil {
+		return nil, err
+	}
+	digests := make([][]byte, len(parts))
+	for i, part := range parts {
+		digests[i], _ = hex.DecodeString(normalizeETag(part.ETag))
+	}
+	etag := multipartETag(digests)
+	if _, err := l.commitObject(t, name, objectMeta{ETag: etag}); err != nil {
+		return nil, err
+	}
+	if err := l.removeUpload(uploadID); err != nil {
+		return nil, err
+	}
+	return &s3.CompleteMultipartUploadResult{
+		Location: l.objectURL(name),
+		Key:      name,
+		ETag:     etag,
+	}, nil
+}
+
+// openParts validates the parts against the staged ones and opens them. Open files keep
+// their content even if a part is uploaded again before the object is assembled.
+func (l *Local) openParts(uploadID string, name string, parts []s3.Part) ([]*os.File, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	dir, meta, err := l.readUpload(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Key != name {
+		return nil, errs.ErrArgs.WrapMsg("upload belongs to another object", "uploadID", uploadID, "name", name)
+	}
+	files := make([]*os.File, 0, len(parts))
+	closeAll := func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			closeAll()
+			return nil, errs.ErrArgs.WrapMsg("parts must be in ascending order", "partNumber", part.PartNumber)
+		}
+		filename := partPath(dir, part.PartNumber)
+		etag, err := os.ReadFile(filename + etagSuffix)
+		if err != nil {
+			closeAll()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, errs.ErrArgs.WrapMsg("part not uploaded", "partNumber", part.PartNumber)
+			}
+			return nil, errs.WrapMsg(err, "read part etag failed", "partNumber", part.PartNumber)
+		}
+		if string(etag) != normalizeETag(part.ETag) {
+			closeAll()
+			return nil, errs.ErrArgs.WrapMsg("part etag mismatch", "partNumber", part.PartNumber, "etag", part.ETag)
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			closeAll()
+			return nil, errs.WrapMsg(err, "open part failed", "partNumber", part.PartNumber)
+		}
+		files = append(files, f)
+		if i == len(parts)-1 {
+			break
+		}
+		if info, err := f.Stat(); err != nil {
+			closeAll()
+			return nil, errs.WrapMsg(err, "stat part failed", "partNumber", part.PartNumber)
+		} else if info.Size() < minPartSize {
+			closeAll()
+			return nil, errs.ErrArgs.WrapMsg("part too small", "partNumber", part.PartNumber, "size", info.Size())
+		}
+	}
+	return files, nil
+}
+
+func (l *Local) removeUpload(uploadID string) error {
+	dir, err := l.uploadPath(uploadID)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return errUploadNotFound(uploadID)
+		}
+		return errs.WrapMsg(err, "stat upload failed", "uploadID", uploadID)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return errs.WrapMsg(err, "remove upload failed", "uploadID", uploadID)
+	}
+	return nil
+}
+
+func normalizeETag(etag string) string {
+	return strings.ToLower(strings.Trim(etag, `"`))
+}
+
+func (l *Local) PartSize(ctx context.Context, size int64) (int64, error) {
+	if size <= 0 {
+		return 0, errors.New("size must be greater than 0")
+	}
+	if size > maxPartSize*maxNumSize {
+		return 0, fmt.Errorf("LOCAL size must be less than the maximum allowed limit")
+	}
+	if size <= minPartSize*maxNumSize {
+		return minPartSize, nil
+	}
+	partSize := size / maxNumSize
+	if size%maxNumSize != 0 {
+		partSize++
+	}
+	return partSize, nil
+}
+
+func (l *Local) AuthSign(ctx context.Context, uploadID string, name string, expire time.Duration, partNumbers []int) (*s3.AuthSignResult, error) {
+	if _, _, err := l.readUpload(uploadID); err != nil {
+		return nil, err
+	}
+	result := s3.AuthSignResult{
+		URL:   l.objectURL(name),
+		Query: url.Values{"uploadId": {uploadID}},
+		Parts: make([]s3.SignPart, len(partNumbers)),
+	}
+	for i, partNumber := range partNumbers {
+		signed := l.signQuery("PUT", name, expire, url.Values{"uploadId": {uploadID}, "partNumber": {strconv.Itoa(partNumber)}})
+		signed.Del("uploadId")
+		result.Parts[i] = s3.SignPart{
+			PartNumber: partNumber,
+			Query:      signed,
+		}
+	}
+	return &result, nil
+}
+
+func (l *Local) PresignedPutObject(ctx context.Context, name string, expire time.Duration) (string, error) {
+	if _, err := l.objectPath(name); err != nil {
+		return "", err
+	}
+	return l.signURL("PUT", name, expire, nil), nil
+}
+
+func (l *Local) PutObject(ctx context.Context, name string, reader io.Reader, size int64, contentType string) (*s3.PutObjectInfo, error) {
+	t, err := l.writeTemp(reader, size)
+	if err != nil {
+		return nil, err
+	}
+	if t.size != size {
+		t.remove()
+		return nil, errs.ErrArgs.WrapMsg("content shorter than size", "size", size, "read", t.size)
+	}
+	info, err := l.commitObject(t, name, objectMeta{ETag: t.etag(), ContentType: contentType})
+	if err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectInfo{
+		Key:  name,
+		ETag: info.ETag,
+		Size: info.Size,
+	}, nil
+}
+
+func (l *Local) GetObject(ctx context.Context, name string, rng *s3.ObjectRange) (io.ReadCloser, error) {
+	f, info, _, err := l.openObject(name)
+	if err != nil {
+		return nil, err
+	}
+	if rng == nil {
+		return f, nil
+	}
+	end := rng.End
+	if end < 0 || end >= info.Size {
+		end = info.Size - 1
+	}
+	if rng.Start < 0 || rng.Start > end {
+		_ = f.Close()
+		return nil, errs.ErrArgs.WrapMsg("invalid range", "start", rng.Start, "end", rng.End, "size", info.Size)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, rng.Start, end-rng.Start+1), f}, nil
+}
+
+// DeleteObject removes name. Like S3, deleting a missing object succeeds.
+func (l *Local) DeleteObject(ctx context.Context, name string) error {
+	return l.removeObject(name)
+}
+
+func (l *Local) DeleteObjects(ctx context.Context, names []string) error {
+	failed := make(map[string]string)
+	for _, name := range names {
+		if err := l.removeObject(name); err != nil {
+			failed[name] = err.Error()
+		}
+	}
+	if len(failed) > 0 {
+		return &s3.DeleteObjectsError{Failed: failed}
+	}
+	return nil
+}
+
+// ListObjects lists objects in key order, the continuation token is the last key returned.
+func (l *Local) ListObjects(ctx context.Context, prefix string, continuationToken string, limit int) (*s3.ListObjectsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	objects, next, err := l.listObjects(prefix, continuationToken, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.ListObjectsResult{
+		Objects:               objects,
+		NextContinuationToken: next,
+		IsTruncated:           next != "",
+	}, nil
+}
+
+func (l *Local) CopyObject(ctx context.Context, src string, dst string) (*s3.CopyObjectInfo, error) {
+	f, _, meta, err := l.openObject(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t, err := l.writeTemp(f, -1)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.commitObject(t, dst, *meta); err != nil {
+		return nil, err
+	}
+	return &s3.CopyObjectInfo{
+		Key:  dst,
+		ETag: meta.ETag,
+	}, nil
+}
+
+func (l *Local) StatObject(ctx context.Context, name string) (*s3.ObjectInfo, error) {
+	f, info, _, err := l.openObject(name)
+	if err != nil {
+		return nil, err
+	}
+	_ = f.Close()
+	return info, nil
+}
+
+func (l *Local) IsNotFound(err error) bool {
+	return errs.ErrRecordNotFound.Is(err) || errors.Is(err, fs.ErrNotExist)
+}
+
+func (l *Local) AbortMultipartUpload(ctx context.Context, uploadID string, name string) error {
+	_, meta, err := l.readUpload(uploadID)
+	if err != nil {
+		return err
+	}
+	if meta.Key != name {
+		return errs.ErrArgs.WrapMsg("upload belongs to another object", "uploadID", uploadID, "name", name)
+	}
+	return l.removeUpload(uploadID)
+}
+
+func (l *Local) ListUploadedParts(ctx context.Context, uploadID string, name string, partNumberMarker int, maxParts int) (*s3.ListUploadedPartsResult, error) {
+	meta, parts, err := l.listParts(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Key != name {
+		return nil, errs.ErrArgs.WrapMsg("upload belongs to another object", "uploadID", uploadID, "name", name)
+	}
+	if maxParts <= 0 || maxParts > 1000 {
+		maxParts = 1000
+	}
+	res := &s3.ListUploadedPartsResult{
+		Key:           name,
+		UploadID:      uploadID,
+		MaxParts:      maxParts,
+		UploadedParts: make([]s3.UploadedPart, 0),
+	}
+	for _, part := range parts {
+		if part.PartNumber <= partNumberMarker {
+			continue
+		}
+		if len(res.UploadedParts) == maxParts {
+			break
+		}
+		res.UploadedParts = append(res.UploadedParts, part)
+		res.NextPartNumberMarker = part.PartNumber
+	}
+	return res, nil
+}
+
+func (l *Local) ListMultipartUploads(ctx context.Context, prefix string, keyMarker string, uploadIDMarker string, limit int) (*s3.ListMultipartUploadsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	uploads, err := l.listUploads(prefix, keyMarker, uploadIDMarker)
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListMultipartUploadsResult{Uploads: uploads}
+	if len(uploads) > limit {
+		res.Uploads = uploads[:limit]
+		last := res.Uploads[limit-1]
+		res.NextKeyMarker, res.NextUploadIDMarker, res.IsTruncated = last.Key, last.UploadID, true
+	}
+	return res, nil
+}
+
+// AccessURL returns a presigned GET URL. Image processing is not supported, opt.Image is ignored.
+func (l *Local) AccessURL(ctx context.Context, name string, expire time.Duration, opt *s3.AccessURLOption) (string, error) {
+	if _, err := l.objectPath(name); err != nil {
+		return "", err
+	}
+	if expire <= 0 {
+		expire = time.Hour * 24 * 365 * 99 // 99 years
+	} else if expire < time.Second {
+		expire = time.Second
+	}
+	reqParams := make(url.Values)
+	if opt != nil {
+		if opt.ContentType != "" {
+			reqParams.Set("response-content-type", opt.ContentType)
+		}
+		if opt.Filename != "" {
+			reqParams.Set("response-content-disposition", `attachment; filename=`+strconv.Quote(opt.Filename))
+		}
+	}
+	return l.signURL("GET", name, expire, reqParams), nil
+}
+
+func (l *Local) FormData(ctx context.Context, name string, size int64, contentType string, duration time.Duration) (*s3.FormData, error) {
+	if _, err := l.objectPath(name); err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(duration)
+	encoded, signature, err := l.signPolicy(&postPolicy{
+		Key:         name,
+		Expires:     expires.Unix(),
+		MaxSize:     size,
+		ContentType: contentType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fd := map[string]string{
+		formKey:       name,
+		formPolicy:    encoded,
+		formSignature: signature,
+	}
+	if contentType != "" {
+		fd[formContentType] = contentType
+	}
+	return &s3.FormData{
+		URL:          l.baseURL + "/",
+		File:         formFile,
+		FormData:     fd,
+		Expires:      expires,
+		SuccessCodes: []int{successCode},
+	}, nil
+}
@@ -0,0 +1,285 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/internal/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	var l *Local
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Handler().ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	l, err := NewLocal(Config{Root: t.TempDir(), BaseURL: srv.URL + "/object", Secret: "secret"})
+	require.NoError(t, err)
+	return l
+}
+
+func get(t *testing.T, ctx context.Context, l *Local, name string) []byte {
+	rawURL, err := l.AccessURL(ctx, name, time.Minute, &s3.AccessURLOption{})
+	require.NoError(t, err)
+	resp, data := s3test.Do(t, http.MethodGet, rawURL, nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return data
+}
+
+func TestMultipartParts(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	upload, err := l.InitiateMultipartUpload(ctx, "a/b")
+	require.NoError(t, err)
+	sign, err := l.AuthSign(ctx, upload.UploadID, "a/b", time.Minute, []int{1, 2})
+	require.NoError(t, err)
+	for i, body := range [][]byte{[]byte("small"), []byte("last")} {
+		query := sign.Parts[i].Query
+		query.Set("uploadId", upload.UploadID)
+		resp, _ := s3test.Do(t, http.MethodPut, sign.URL+"?"+query.Encode(), nil, body)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	parts, err := l.ListUploadedParts(ctx, upload.UploadID, "a/b", 0, 1)
+	require.NoError(t, err)
+	require.Len(t, parts.UploadedParts, 1)
+	assert.Equal(t, s3test.MD5Hex([]byte("small")), parts.UploadedParts[0].ETag)
+	parts, err = l.ListUploadedParts(ctx, upload.UploadID, "a/b", parts.NextPartNumberMarker, 0)
+	require.NoError(t, err)
+	require.Len(t, parts.UploadedParts, 1)
+	assert.Equal(t, 2, parts.UploadedParts[0].PartNumber)
+
+	_, err = l.CompleteMultipartUpload(ctx, upload.UploadID, "a/b", []s3.Part{{PartNumber: 1, ETag: s3test.MD5Hex([]byte("small"))}, {PartNumber: 2, ETag: s3test.MD5Hex([]byte("last"))}})
+	assert.ErrorContains(t, err, "part too small")
+	_, err = l.CompleteMultipartUpload(ctx, upload.UploadID, "a/b", []s3.Part{{PartNumber: 2, ETag: "wrong"}})
+	assert.ErrorContains(t, err, "part etag mismatch")
+
+	require.NoError(t, l.AbortMultipartUpload(ctx, upload.UploadID, "a/b"))
+	_, err = l.ListUploadedParts(ctx, upload.UploadID, "a/b", 0, 0)
+	assert.True(t, l.IsNotFound(err))
+}
+
+func TestPresignedURLs(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	rawURL, err := l.PresignedPutObject(ctx, "dir/file name.txt", time.Minute)
+	require.NoError(t, err)
+	resp, _ := s3test.Do(t, http.MethodPut, rawURL, http.Header{"Content-Type": {"text/plain"}}, []byte("0123456789"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = s3test.Do(t, http.MethodPut, strings.Replace(rawURL, "file", "other", 1), nil, []byte("x"))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	expired, err := l.PresignedPutObject(ctx, "dir/file name.txt", -time.Minute)
+	require.NoError(t, err)
+	resp, _ = s3test.Do(t, http.MethodPut, expired, nil, []byte("x"))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	getURL, err := l.AccessURL(ctx, "dir/file name.txt", time.Minute, &s3.AccessURLOption{Filename: "a.txt"})
+	require.NoError(t, err)
+	resp, body := s3test.Do(t, http.MethodGet, getURL, http.Header{"Range": {"bytes=2-4"}}, nil)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "234", string(body))
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="a.txt"`, resp.Header.Get("Content-Disposition"))
+
+	copied, err := l.CopyObject(ctx, "dir/file name.txt", "copy")
+	require.NoError(t, err)
+	assert.Equal(t, s3test.MD5Hex([]byte("0123456789")), copied.ETag)
+	require.NoError(t, l.DeleteObject(ctx, "dir/file name.txt"))
+	require.NoError(t, l.DeleteObject(ctx, "dir/file name.txt"))
+	_, err = l.StatObject(ctx, "dir/file name.txt")
+	assert.True(t, l.IsNotFound(err))
+	resp, _ = s3test.Do(t, http.MethodGet, getURL, nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	_, err = l.PresignedPutObject(ctx, "../escape", time.Minute)
+	assert.Error(t, err)
+}
+
+func TestFormData(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	post := func(fd *s3.FormData, content []byte) int {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		for k, v := range fd.FormData {
+			require.NoError(t, w.WriteField(k, v))
+		}
+		fw, err := w.CreateFormFile(fd.File, "upload.png")
+		require.NoError(t, err)
+		_, _ = fw.Write(content)
+		require.NoError(t, w.Close())
+		resp, _ := s3test.Do(t, http.MethodPost, fd.URL, http.Header{"Content-Type": {w.FormDataContentType()}}, buf.Bytes())
+		return resp.StatusCode
+	}
+
+	fd, err := l.FormData(ctx, "form/image.png", 8, "image/png", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, post(fd, []byte("too large content")))
+	assert.Equal(t, fd.SuccessCodes[0], post(fd, []byte("png")))
+	assert.Equal(t, []byte("png"), get(t, ctx, l, "form/image.png"))
+
+	fd.FormData[formKey] = "form/other.png"
+	assert.Equal(t, http.StatusForbidden, post(fd, []byte("png")))
+}
+
+func TestGetObjectRange(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	_, err := l.PutObject(ctx, "range", strings.NewReader("0123456789"), 10, "text/plain")
+	require.NoError(t, err)
+	read := func(rng *s3.ObjectRange) string {
+		body, err := l.GetObject(ctx, "range", rng)
+		require.NoError(t, err)
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "0123456789", read(nil))
+	assert.Equal(t, "234", read(&s3.ObjectRange{Start: 2, End: 4}))
+	assert.Equal(t, "789", read(&s3.ObjectRange{Start: 7, End: -1}))
+	assert.Equal(t, "9", read(&s3.ObjectRange{Start: 9, End: 100}))
+
+	_, err = l.GetObject(ctx, "range", &s3.ObjectRange{Start: 10, End: -1})
+	assert.Error(t, err)
+	_, err = l.PutObject(ctx, "long", strings.NewReader("0123456789"), 5, "")
+	assert.Error(t, err)
+}
+
+func TestListObjects(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	keys := []string{"a/1", "a/2", "a/b/3", "a/b/4", "a.txt", "b/5"}
+	for _, key := range keys {
+		_, err := l.PutObject(ctx, key, strings.NewReader(key), int64(len(key)), "")
+		require.NoError(t, err)
+	}
+
+	res, err := l.ListObjects(ctx, "a/", "", 3)
+	require.NoError(t, err)
+	require.Len(t, res.Objects, 3)
+	assert.True(t, res.IsTruncated)
+	assert.Equal(t, "a/1", res.Objects[0].Key)
+	assert.Equal(t, s3test.MD5Hex([]byte("a/1")), res.Objects[0].ETag)
+	assert.Equal(t, int64(3), res.Objects[0].Size)
+	res, err = l.ListObjects(ctx, "a/", res.NextContinuationToken, 3)
+	require.NoError(t, err)
+	require.Len(t, res.Objects, 1)
+	assert.Equal(t, "a/b/4", res.Objects[0].Key)
+	assert.False(t, res.IsTruncated)
+
+	var listed []string
+	it := s3.NewObjectIterator(l, "a", 2)
+	for it.Next(ctx) {
+		listed = append(listed, it.Object().Key)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, []string{"a.txt", "a/1", "a/2", "a/b/3", "a/b/4"}, listed)
+
+	res, err = l.ListObjects(ctx, "missing/", "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, res.Objects)
+
+	// A prefix cannot move the walk out of the objects directory.
+	require.NoError(t, os.MkdirAll(filepath.Join(l.root, "outside"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(l.root, "outside", "leak"+dataSuffix), nil, 0o644))
+	for _, prefix := range []string{"../outside/", "a/../../outside/", "../../x/"} {
+		_, err = l.ListObjects(ctx, prefix, "", 0)
+		assert.True(t, errs.ErrArgs.Is(err), "prefix %q must be rejected", prefix)
+	}
+	_, err = l.PutObject(ctx, "a/..b", strings.NewReader("dots"), 4, "")
+	require.NoError(t, err)
+	res, err = l.ListObjects(ctx, "a/..", "", 0)
+	require.NoError(t, err)
+	require.Len(t, res.Objects, 1)
+	assert.Equal(t, "a/..b", res.Objects[0].Key)
+}
+
+func TestObjectNames(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	for _, name := range []string{"", ".", "..", "a/..", "../a", "a/../b", "/a", "a//b", "a/./b", "a/"} {
+		_, err := l.PutObject(ctx, name, strings.NewReader("x"), 1, "")
+		assert.True(t, errs.ErrArgs.Is(err), "name %q must be rejected", name)
+	}
+	_, err := os.Stat(filepath.Clean(l.root) + dataSuffix)
+	assert.True(t, os.IsNotExist(err), "no file may be written outside the root")
+
+	for _, name := range []string{"..a", "a..", "a/..b/c", "a/b.."} {
+		_, err := l.PutObject(ctx, name, strings.NewReader("x"), 1, "")
+		assert.NoError(t, err, "name %q", name)
+	}
+}
+
+func TestDeleteObjects(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	for _, key := range []string{"d/1", "d/2", "d/3"} {
+		_, err := l.PutObject(ctx, key, strings.NewReader(key), int64(len(key)), "")
+		require.NoError(t, err)
+	}
+	require.NoError(t, l.DeleteObjects(ctx, []string{"d/1", "d/3", "d/missing"}))
+	res, err := l.ListObjects(ctx, "d/", "", 0)
+	require.NoError(t, err)
+	require.Len(t, res.Objects, 1)
+	assert.Equal(t, "d/2", res.Objects[0].Key)
+
+	err = l.DeleteObjects(ctx, []string{"d/2", "../escape"})
+	var deleteErr *s3.DeleteObjectsError
+	require.ErrorAs(t, err, &deleteErr)
+	assert.Contains(t, deleteErr.Failed, "../escape")
+	_, err = l.StatObject(ctx, "d/2")
+	assert.True(t, l.IsNotFound(err))
+}
+
+func TestListMultipartUploads(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	ids := map[string]string{}
+	for _, name := range []string{"m/1", "m/2", "m/3", "other"} {
+		upload, err := l.InitiateMultipartUpload(ctx, name)
+		require.NoError(t, err)
+		ids[name] = upload.UploadID
+	}
+
+	res, err := l.ListMultipartUploads(ctx, "m/", "", "", 2)
+	require.NoError(t, err)
+	require.Len(t, res.Uploads, 2)
+	assert.True(t, res.IsTruncated)
+	assert.Equal(t, "m/1", res.Uploads[0].Key)
+	assert.Equal(t, ids["m/1"], res.Uploads[0].UploadID)
+	assert.False(t, res.Uploads[0].Initiated.IsZero())
+
+	res, err = l.ListMultipartUploads(ctx, "m/", res.NextKeyMarker, res.NextUploadIDMarker, 2)
+	require.NoError(t, err)
+	require.Len(t, res.Uploads, 1)
+	assert.Equal(t, "m/3", res.Uploads[0].Key)
+	assert.False(t, res.IsTruncated)
+
+	require.NoError(t, l.AbortMultipartUpload(ctx, ids["m/3"], "m/3"))
+	res, err = l.ListMultipartUploads(ctx, "", "", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, res.Uploads, 3)
+}
@@ -0,0 +1,124 @@
+// Copyright © 2023 OpenIM. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const (
+	queryExpires   = "X-Expires"
+	querySignature = "X-Signature"
+
+	formKey         = "key"
+	formPolicy      = "policy"
+	formSignature   = "signature"
+	formContentType = "Content-Type"
+	formFile        = "file"
+)
+
+// postPolicy restricts what a FormData upload may store.
+type postPolicy struct {
+	Key         string `json:"key"`
+	Expires     int64  `json:"expires"` // unix seconds
+	MaxSize     int64  `json:"maxSize,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+func (l *Local) mac(fields ...string) string {
+	h := hmac.New(sha256.New, l.secret)
+	h.Write([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// signature signs a request for name. Every query parameter except the signature itself is
+// covered, so none can be added, dropped or altered.
+func (l *Local) signature(method string, name string, query url.Values) string {
+	signed := make(url.Values, len(query))
+	for k, v := range query {
+		if k != querySignature {
+			signed[k] = v
+		}
+	}
+	return l.mac(method, name, signed.Encode())
+}
+
+// signQuery adds an expiry and the signature to query.
+func (l *Local) signQuery(method string, name string, expire time.Duration, query url.Values) url.Values {
+	signed := make(url.Values, len(query)+2)
+	for k, v := range query {
+		signed[k] = v
+	}
+	signed.Set(queryExpires, strconv.FormatInt(time.Now().Add(expire).Unix(), 10))
+	signed.Set(querySignature, l.signature(method, name, signed))
+	return signed
+}
+
+func (l *Local) signURL(method string, name string, expire time.Duration, query url.Values) string {
+	return l.objectURL(name) + "?" + l.signQuery(method, name, expire, query).Encode()
+}
+
+// verify checks the signature and expiry of a presigned request.
+func (l *Local) verify(method string, name string, query url.Values) error {
+	expires, err := strconv.ParseInt(query.Get(queryExpires), 10, 64)
+	if err != nil {
+		return errs.ErrNoPermission.WrapMsg("missing expires")
+	}
+	if time.Now().Unix() > expires {
+		return errs.ErrNoPermission.WrapMsg("request expired", "expires", expires)
+	}
+	if !hmac.Equal([]byte(query.Get(querySignature)), []byte(l.signature(method, name, query))) {
+		return errs.ErrNoPermission.WrapMsg("signature mismatch")
+	}
+	return nil
+}
+
+func (l *Local) signPolicy(policy *postPolicy) (string, string, error) {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", "", errs.WrapMsg(err, "marshal post policy failed")
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	return encoded, l.mac("POST", encoded), nil
+}
+
+// verifyPolicy checks the signature and expiry of a FormData policy and returns it.
+func (l *Local) verifyPolicy(encoded string, signature string) (*postPolicy, error) {
+	if !hmac.Equal([]byte(signature), []byte(l.mac("POST", encoded))) {
+		return nil, errs.ErrNoPermission.WrapMsg("policy signature mismatch")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errs.ErrArgs.WrapMsg("invalid policy encoding")
+	}
+	var policy postPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, errs.ErrArgs.WrapMsg("invalid policy")
+	}
+	if time.Now().Unix() > policy.Expires {
+		return nil, errs.ErrNoPermission.WrapMsg("policy expired", "expires", policy.Expires)
+	}
+	return &policy, nil
+}
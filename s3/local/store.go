@@ -0,0 +1,464 @@
+// Copyright © 2023 OpenIM. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+)
+
+// On-disk layout below Config.Root. An object is stored as <key>.data with its metadata in
+// <key>.meta, so a key can never collide with the directory of a longer key.
+const (
+	objectsDir = "objects"
+	uploadsDir = "uploads"
+	tempDir    = "tmp"
+	dataSuffix = ".data"
+	metaSuffix = ".meta"
+	uploadFile = "upload.json"
+	partSuffix = ".part"
+	etagSuffix = ".etag"
+)
+
+type objectMeta struct {
+	ETag        string `json:"etag"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+type uploadMeta struct {
+	Key       string    `json:"key"`
+	Initiated time.Time `json:"initiated"`
+}
+
+func errObjectNotFound(name string) error {
+	return errs.ErrRecordNotFound.WrapMsg("object not found", "name", name)
+}
+
+func errUploadNotFound(uploadID string) error {
+	return errs.ErrRecordNotFound.WrapMsg("multipart upload not found", "uploadID", uploadID)
+}
+
+// objectPath returns the data file of name, rejecting names that are not clean relative paths
+// or that would resolve outside the objects directory.
+func (l *Local) objectPath(name string) (string, error) {
+	if name == "" || name == "." || strings.HasPrefix(name, "/") || hasDotDot(name) || path.Clean(name) != name {
+		return "", errs.ErrArgs.WrapMsg("invalid object name", "name", name)
+	}
+	root := filepath.Join(l.root, objectsDir)
+	filename := filepath.Join(root, filepath.FromSlash(name))
+	if !strings.HasPrefix(filename, root+string(filepath.Separator)) {
+		return "", errs.ErrArgs.WrapMsg("invalid object name", "name", name)
+	}
+	return filename + dataSuffix, nil
+}
+
+// hasDotDot reports whether the slash separated p has a ".." element.
+func hasDotDot(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func metaPath(dataPath string) string {
+	return strings.TrimSuffix(dataPath, dataSuffix) + metaSuffix
+}
+
+// uploadPath returns the staging directory of an upload. IDs are hex strings, which keeps
+// them from escaping the uploads directory.
+func (l *Local) uploadPath(uploadID string) (string, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", errs.ErrArgs.WrapMsg("invalid upload id", "uploadID", uploadID)
+	}
+	return filepath.Join(l.root, uploadsDir, uploadID), nil
+}
+
+func partPath(dir string, partNumber int) string {
+	return filepath.Join(dir, strconv.Itoa(partNumber)+partSuffix)
+}
+
+func readJSON(filename string, v any) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeFile replaces filename atomically through a temporary file.
+func (l *Local) writeFile(filename string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Join(l.root, tempDir), "meta-*")
+	if err != nil {
+		return errs.WrapMsg(err, "create temp file failed")
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return errs.WrapMsg(err, "write temp file failed")
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return errs.WrapMsg(err, "close temp file failed")
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		_ = os.Remove(f.Name())
+		return errs.WrapMsg(err, "rename temp file failed", "filename", filename)
+	}
+	return nil
+}
+
+// tempFile is content staged in the temp directory before it is committed.
+type tempFile struct {
+	name string
+	size int64
+	md5  []byte
+}
+
+func (t *tempFile) etag() string {
+	return hex.EncodeToString(t.md5)
+}
+
+func (t *tempFile) remove() {
+	_ = os.Remove(t.name)
+}
+
+// writeTemp copies r into a temp file. A non-negative limit rejects content larger than limit.
+func (l *Local) writeTemp(r io.Reader, limit int64) (*tempFile, error) {
+	f, err := os.CreateTemp(filepath.Join(l.root, tempDir), "data-*")
+	if err != nil {
+		return nil, errs.WrapMsg(err, "create temp file failed")
+	}
+	t := &tempFile{name: f.Name()}
+	h := md5.New()
+	if limit >= 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	t.size, err = io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.remove()
+		return nil, errs.WrapMsg(err, "write temp file failed")
+	}
+	if limit >= 0 && t.size > limit {
+		t.remove()
+		return nil, errs.ErrArgs.WrapMsg("entity too large", "limit", limit)
+	}
+	t.md5 = h.Sum(nil)
+	return t, nil
+}
+
+// commitObject moves a staged file to name, replacing any previous object.
+func (l *Local) commitObject(t *tempFile, name string, meta objectMeta) (*s3.ObjectInfo, error) {
+	filename, err := l.objectPath(name)
+	if err != nil {
+		t.remove()
+		return nil, err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		t.remove()
+		return nil, errs.WrapMsg(err, "marshal object meta failed")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		t.remove()
+		return nil, errs.WrapMsg(err, "create object dir failed", "name", name)
+	}
+	if err := l.writeFile(metaPath(filename), data); err != nil {
+		t.remove()
+		return nil, err
+	}
+	if err := os.Rename(t.name, filename); err != nil {
+		t.remove()
+		return nil, errs.WrapMsg(err, "rename object failed", "name", name)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "stat object failed", "name", name)
+	}
+	return &s3.ObjectInfo{ETag: meta.ETag, Key: name, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+// openObject opens the data of name together with its metadata. The caller closes the file.
+func (l *Local) openObject(name string) (*os.File, *s3.ObjectInfo, *objectMeta, error) {
+	filename, err := l.objectPath(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, nil, errObjectNotFound(name)
+		}
+		return nil, nil, nil, errs.WrapMsg(err, "open object failed", "name", name)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, nil, errs.WrapMsg(err, "stat object failed", "name", name)
+	}
+	var meta objectMeta
+	if err := readJSON(metaPath(filename), &meta); err != nil {
+		_ = f.Close()
+		return nil, nil, nil, errs.WrapMsg(err, "read object meta failed", "name", name)
+	}
+	return f, &s3.ObjectInfo{ETag: meta.ETag, Key: name, Size: info.Size(), LastModified: info.ModTime()}, &meta, nil
+}
+
+// removeObject deletes name and prunes the directories it leaves empty.
+func (l *Local) removeObject(name string) error {
+	filename, err := l.objectPath(name)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.Remove(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errs.WrapMsg(err, "remove object failed", "name", name)
+	}
+	if err := os.Remove(metaPath(filename)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errs.WrapMsg(err, "remove object meta failed", "name", name)
+	}
+	root := filepath.Join(l.root, objectsDir)
+	for dir := filepath.Dir(filename); dir != root; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// listObjects returns up to limit objects whose keys start with prefix and sort after
+// startAfter, along with the key the next page starts after when more remain. The walk starts at the deepest directory
+// the prefix names, so listing a folder does not scan the whole store.
+func (l *Local) listObjects(prefix string, startAfter string, limit int) ([]s3.ObjectInfo, string, error) {
+	root := filepath.Join(l.root, objectsDir)
+	start := root
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		// Only the directories of the prefix choose where the walk starts, its last element
+		// may be the start of a key like "..a".
+		start = filepath.Join(root, filepath.FromSlash(path.Clean(prefix[:i])))
+		if hasDotDot(prefix[:i]) || (start != root && !strings.HasPrefix(start, root+string(filepath.Separator))) {
+			return nil, "", errs.ErrArgs.WrapMsg("invalid prefix", "prefix", prefix)
+		}
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var keys []string
+	err := filepath.WalkDir(start, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(filename, dataSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, strings.TrimSuffix(filename, dataSuffix))
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) && key > startAfter {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", errs.WrapMsg(err, "walk objects failed", "prefix", prefix)
+	}
+	sort.Strings(keys)
+	var next string
+	if len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+	objects := make([]s3.ObjectInfo, 0, len(keys))
+	for _, key := range keys {
+		filename := filepath.Join(root, filepath.FromSlash(key)) + dataSuffix
+		info, err := os.Stat(filename)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, "", errs.WrapMsg(err, "stat object failed", "name", key)
+		}
+		var meta objectMeta
+		if err := readJSON(metaPath(filename), &meta); err != nil {
+			return nil, "", errs.WrapMsg(err, "read object meta failed", "name", key)
+		}
+		objects = append(objects, s3.ObjectInfo{
+			ETag:         meta.ETag,
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+	}
+	return objects, next, nil
+}
+
+// readUpload returns the staging directory and metadata of an upload.
+func (l *Local) readUpload(uploadID string) (string, *uploadMeta, error) {
+	dir, err := l.uploadPath(uploadID)
+	if err != nil {
+		return "", nil, err
+	}
+	var meta uploadMeta
+	if err := readJSON(filepath.Join(dir, uploadFile), &meta); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil, errUploadNotFound(uploadID)
+		}
+		return "", nil, errs.WrapMsg(err, "read upload failed", "uploadID", uploadID)
+	}
+	return dir, &meta, nil
+}
+
+// putPart stages a part of a multipart upload and returns its ETag.
+func (l *Local) putPart(uploadID string, partNumber int, r io.Reader) (string, error) {
+	if partNumber < 1 || int64(partNumber) > maxNumSize {
+		return "", errs.ErrArgs.WrapMsg("invalid part number", "partNumber", partNumber)
+	}
+	dir, _, err := l.readUpload(uploadID)
+	if err != nil {
+		return "", err
+	}
+	t, err := l.writeTemp(r, maxPartSize)
+	if err != nil {
+		return "", err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	filename := partPath(dir, partNumber)
+	if err := l.writeFile(filename+etagSuffix, []byte(t.etag())); err != nil {
+		t.remove()
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", errUploadNotFound(uploadID)
+		}
+		return "", err
+	}
+	if err := os.Rename(t.name, filename); err != nil {
+		t.remove()
+		return "", errs.WrapMsg(err, "rename part failed", "uploadID", uploadID, "partNumber", partNumber)
+	}
+	return t.etag(), nil
+}
+
+// listParts returns the staged parts of an upload ordered by part number.
+func (l *Local) listParts(uploadID string) (*uploadMeta, []s3.UploadedPart, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	dir, meta, err := l.readUpload(uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, errs.WrapMsg(err, "read upload dir failed", "uploadID", uploadID)
+	}
+	parts := make([]s3.UploadedPart, 0, len(entries))
+	for _, entry := range entries {
+		num, ok := strings.CutSuffix(entry.Name(), partSuffix)
+		if !ok {
+			continue
+		}
+		partNumber, err := strconv.Atoi(num)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, nil, errs.WrapMsg(err, "stat part failed", "uploadID", uploadID, "partNumber", partNumber)
+		}
+		etag, err := os.ReadFile(partPath(dir, partNumber) + etagSuffix)
+		if err != nil {
+			return nil, nil, errs.WrapMsg(err, "read part etag failed", "uploadID", uploadID, "partNumber", partNumber)
+		}
+		parts = append(parts, s3.UploadedPart{
+			PartNumber:   partNumber,
+			LastModified: info.ModTime(),
+			ETag:         string(etag),
+			Size:         info.Size(),
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return meta, parts, nil
+}
+
+// listUploads returns the unfinished uploads under prefix that sort after keyMarker and
+// uploadIDMarker, ordered by key and then upload ID.
+func (l *Local) listUploads(prefix string, keyMarker string, uploadIDMarker string) ([]s3.MultipartUpload, error) {
+	entries, err := os.ReadDir(filepath.Join(l.root, uploadsDir))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "read uploads failed")
+	}
+	var uploads []s3.MultipartUpload
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		_, meta, err := l.readUpload(entry.Name())
+		if err != nil {
+			if errs.ErrRecordNotFound.Is(err) || errs.ErrArgs.Is(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !strings.HasPrefix(meta.Key, prefix) {
+			continue
+		}
+		if meta.Key < keyMarker || (meta.Key == keyMarker && (uploadIDMarker == "" || entry.Name() <= uploadIDMarker)) {
+			continue
+		}
+		uploads = append(uploads, s3.MultipartUpload{Key: meta.Key, UploadID: entry.Name(), Initiated: meta.Initiated})
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Key != uploads[j].Key {
+			return uploads[i].Key < uploads[j].Key
+		}
+		return uploads[i].UploadID < uploads[j].UploadID
+	})
+	return uploads, nil
+}
+
+// multipartETag computes the ETag S3 gives a multipart object: the MD5 of the concatenated
+// binary part digests followed by the number of parts.
+func multipartETag(digests [][]byte) string {
+	h := md5.New()
+	for _, digest := range digests {
+		h.Write(digest)
+	}
+	return hex.EncodeToString(h.Sum(nil)) + "-" + strconv.Itoa(len(digests))
+}
@@ -309,6 +309,37 @@ func (m *Minio) PresignedPutObject(ctx context.Context, name string, expire time
 	return rawURL.String(), nil
 }
 
+func (m *Minio) PutObject(ctx context.Context, name string, reader io.Reader, size int64, contentType string) (*s3.PutObjectInfo, error) {
+	if err := m.initMinio(ctx); err != nil {
+		return nil, err
+	}
+	info, err := m.core.Client.PutObject(ctx, m.bucket, name, reader, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return nil, err
+	}
+	m.delObjectImageInfoKey(ctx, name, info.Size)
+	return &s3.PutObjectInfo{
+		Key:  name,
+		ETag: strings.ToLower(info.ETag),
+		Size: info.Size,
+	}, nil
+}
+
+func (m *Minio) GetObject(ctx context.Context, name string, rng *s3.ObjectRange) (io.ReadCloser, error) {
+	if err := m.initMinio(ctx); err != nil {
+		return nil, err
+	}
+	opts := minio.GetObjectOptions{}
+	if rng != nil {
+		opts.Set("Range", rng.HeaderValue())
+	}
+	reader, _, _, err := m.core.GetObject(ctx, m.bucket, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
 func (m *Minio) DeleteObject(ctx context.Context, name string) error {
 	if err := m.initMinio(ctx); err != nil {
 		return err
@@ -316,6 +347,52 @@ func (m *Minio) DeleteObject(ctx context.Context, name string) error {
 	return m.core.Client.RemoveObject(ctx, m.bucket, name, minio.RemoveObjectOptions{})
 }
 
+func (m *Minio) DeleteObjects(ctx context.Context, names []string) error {
+	if err := m.initMinio(ctx); err != nil {
+		return err
+	}
+	objects := make(chan minio.ObjectInfo, len(names))
+	for _, name := range names {
+		objects <- minio.ObjectInfo{Key: name}
+	}
+	close(objects)
+	failed := make(map[string]string)
+	for result := range m.core.Client.RemoveObjects(ctx, m.bucket, objects, minio.RemoveObjectsOptions{}) {
+		failed[result.ObjectName] = result.Err.Error()
+	}
+	if len(failed) > 0 {
+		return &s3.DeleteObjectsError{Failed: failed}
+	}
+	return nil
+}
+
+func (m *Minio) ListObjects(ctx context.Context, prefix string, continuationToken string, limit int) (*s3.ListObjectsResult, error) {
+	if err := m.initMinio(ctx); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	result, err := m.core.ListObjectsV2(m.bucket, prefix, "", continuationToken, "", limit)
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListObjectsResult{
+		Objects:               make([]s3.ObjectInfo, len(result.Contents)),
+		NextContinuationToken: result.NextContinuationToken,
+		IsTruncated:           result.IsTruncated,
+	}
+	for i, object := range result.Contents {
+		res.Objects[i] = s3.ObjectInfo{
+			ETag:         strings.ToLower(strings.ReplaceAll(object.ETag, `"`, ``)),
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		}
+	}
+	return res, nil
+}
+
 func (m *Minio) StatObject(ctx context.Context, name string) (*s3.ObjectInfo, error) {
 	if err := m.initMinio(ctx); err != nil {
 		return nil, err
@@ -420,6 +497,33 @@ func (m *Minio) PresignedGetObject(ctx context.Context, name string, expire time
 	return rawURL.String(), nil
 }
 
+func (m *Minio) ListMultipartUploads(ctx context.Context, prefix string, keyMarker string, uploadIDMarker string, limit int) (*s3.ListMultipartUploadsResult, error) {
+	if err := m.initMinio(ctx); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	result, err := m.core.ListMultipartUploads(ctx, m.bucket, prefix, keyMarker, uploadIDMarker, "", limit)
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListMultipartUploadsResult{
+		Uploads:            make([]s3.MultipartUpload, len(result.Uploads)),
+		NextKeyMarker:      result.NextKeyMarker,
+		NextUploadIDMarker: result.NextUploadIDMarker,
+		IsTruncated:        result.IsTruncated,
+	}
+	for i, upload := range result.Uploads {
+		res.Uploads[i] = s3.MultipartUpload{
+			Key:       upload.Key,
+			UploadID:  upload.UploadID,
+			Initiated: upload.Initiated,
+		}
+	}
+	return res, nil
+}
+
 func (m *Minio) AccessURL(ctx context.Context, name string, expire time.Duration, opt *s3.AccessURLOption) (string, error) {
 	if err := m.initMinio(ctx); err != nil {
 		return "", err
@@ -228,10 +228,86 @@ func (o *OSS) StatObject(ctx context.Context, name string) (*s3.ObjectInfo, erro
 	return res, nil
 }
 
+func (o *OSS) PutObject(ctx context.Context, name string, reader io.Reader, size int64, contentType string) (*s3.PutObjectInfo, error) {
+	var header http.Header
+	opts := []oss.Option{oss.WithContext(ctx), oss.ContentLength(size), oss.GetResponseHeader(&header)}
+	if contentType != "" {
+		opts = append(opts, oss.ContentType(contentType))
+	}
+	if err := o.bucket.PutObject(name, reader, opts...); err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectInfo{
+		Key:  name,
+		ETag: strings.ToLower(strings.ReplaceAll(header.Get("ETag"), `"`, ``)),
+		Size: size,
+	}, nil
+}
+
+func (o *OSS) GetObject(ctx context.Context, name string, rng *s3.ObjectRange) (io.ReadCloser, error) {
+	opts := []oss.Option{oss.WithContext(ctx)}
+	if rng != nil {
+		opts = append(opts, oss.NormalizedRange(strings.TrimPrefix(rng.HeaderValue(), "bytes=")))
+	}
+	return o.bucket.GetObject(name, opts...)
+}
+
 func (o *OSS) DeleteObject(ctx context.Context, name string) error {
 	return o.bucket.DeleteObject(name)
 }
 
+func (o *OSS) DeleteObjects(ctx context.Context, names []string) error {
+	failed := make(map[string]string)
+	for start := 0; start < len(names); start += s3.MaxDeleteObjects {
+		batch := names[start:min(start+s3.MaxDeleteObjects, len(names))]
+		result, err := o.bucket.DeleteObjects(batch, oss.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		deleted := make(map[string]struct{}, len(result.DeletedObjects))
+		for _, key := range result.DeletedObjects {
+			deleted[key] = struct{}{}
+		}
+		for _, key := range batch {
+			if _, ok := deleted[key]; !ok {
+				failed[key] = "not deleted"
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return &s3.DeleteObjectsError{Failed: failed}
+	}
+	return nil
+}
+
+func (o *OSS) ListObjects(ctx context.Context, prefix string, continuationToken string, limit int) (*s3.ListObjectsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	opts := []oss.Option{oss.WithContext(ctx), oss.Prefix(prefix), oss.MaxKeys(limit)}
+	if continuationToken != "" {
+		opts = append(opts, oss.ContinuationToken(continuationToken))
+	}
+	result, err := o.bucket.ListObjectsV2(opts...)
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListObjectsResult{
+		Objects:               make([]s3.ObjectInfo, len(result.Objects)),
+		NextContinuationToken: result.NextContinuationToken,
+		IsTruncated:           result.IsTruncated,
+	}
+	for i, object := range result.Objects {
+		res.Objects[i] = s3.ObjectInfo{
+			ETag:         strings.ToLower(strings.ReplaceAll(object.ETag, `"`, ``)),
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		}
+	}
+	return res, nil
+}
+
 func (o *OSS) CopyObject(ctx context.Context, src string, dst string) (*s3.CopyObjectInfo, error) {
 	result, err := o.bucket.CopyObject(src, dst)
 	if err != nil {
@@ -289,6 +365,30 @@ func (o *OSS) ListUploadedParts(ctx context.Context, uploadID string, name strin
 	return res, nil
 }
 
+func (o *OSS) ListMultipartUploads(ctx context.Context, prefix string, keyMarker string, uploadIDMarker string, limit int) (*s3.ListMultipartUploadsResult, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	result, err := o.bucket.ListMultipartUploads(oss.WithContext(ctx), oss.Prefix(prefix), oss.KeyMarker(keyMarker), oss.UploadIDMarker(uploadIDMarker), oss.MaxUploads(limit))
+	if err != nil {
+		return nil, err
+	}
+	res := &s3.ListMultipartUploadsResult{
+		Uploads:            make([]s3.MultipartUpload, len(result.Uploads)),
+		NextKeyMarker:      result.NextKeyMarker,
+		NextUploadIDMarker: result.NextUploadIDMarker,
+		IsTruncated:        result.IsTruncated,
+	}
+	for i, upload := range result.Uploads {
+		res.Uploads[i] = s3.MultipartUpload{
+			Key:       upload.Key,
+			UploadID:  upload.UploadID,
+			Initiated: upload.Initiated,
+		}
+	}
+	return res, nil
+}
+
 func (o *OSS) AccessURL(ctx context.Context, name string, expire time.Duration, opt *s3.AccessURLOption) (string, error) {
 	var opts []oss.Option
 	if opt != nil {
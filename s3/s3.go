@@ -16,11 +16,19 @@ package s3
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// MaxDeleteObjects is the number of objects DeleteObjects removes per request.
+const MaxDeleteObjects = 1000
+
 type PartLimit struct {
 	MinPartSize int64 `json:"minPartSize"`
 	MaxPartSize int64 `json:"maxPartSize"`
@@ -74,6 +82,50 @@ type CopyObjectInfo struct {
 	ETag string `json:"etag"`
 }
 
+type PutObjectInfo struct {
+	Key  string `json:"name"`
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+// ObjectRange selects the bytes of an object from Start to End, both inclusive.
+// A negative End reads to the end of the object.
+type ObjectRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// HeaderValue returns the value of the HTTP Range header selecting r.
+func (r *ObjectRange) HeaderValue() string {
+	if r.End < 0 {
+		return "bytes=" + strconv.FormatInt(r.Start, 10) + "-"
+	}
+	return "bytes=" + strconv.FormatInt(r.Start, 10) + "-" + strconv.FormatInt(r.End, 10)
+}
+
+type ListObjectsResult struct {
+	Objects               []ObjectInfo `json:"objects"`
+	NextContinuationToken string       `json:"nextContinuationToken"`
+	IsTruncated           bool         `json:"isTruncated"`
+}
+
+// DeleteObjectsError lists the objects DeleteObjects failed to delete.
+type DeleteObjectsError struct {
+	Failed map[string]string `json:"failed"` // object name to reason
+}
+
+func (e *DeleteObjectsError) Error() string {
+	names := make([]string, 0, len(e.Failed))
+	for name := range e.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + ": " + e.Failed[name]
+	}
+	return fmt.Sprintf("failed to delete %d objects: %s", len(names), strings.Join(names, ", "))
+}
+
 type FormData struct {
 	URL          string            `json:"url"`
 	File         string            `json:"file"`
@@ -125,6 +177,19 @@ type ListUploadedPartsResult struct {
 	UploadedParts        []UploadedPart `xml:"Part"`
 }
 
+type MultipartUpload struct {
+	Key       string    `json:"key"`
+	UploadID  string    `json:"uploadID"`
+	Initiated time.Time `json:"initiated"`
+}
+
+type ListMultipartUploadsResult struct {
+	Uploads            []MultipartUpload `json:"uploads"`
+	NextKeyMarker      string            `json:"nextKeyMarker"`
+	NextUploadIDMarker string            `json:"nextUploadIDMarker"`
+	IsTruncated        bool              `json:"isTruncated"`
+}
+
 type Image struct {
 	Format string `json:"format"`
 	Width  int    `json:"width"`
@@ -149,7 +214,19 @@ type Interface interface {
 
 	PresignedPutObject(ctx context.Context, name string, expire time.Duration) (string, error)
 
+	// PutObject uploads size bytes read from reader to name.
+	PutObject(ctx context.Context, name string, reader io.Reader, size int64, contentType string) (*PutObjectInfo, error)
+	// GetObject reads name, or only the bytes selected by rng when it is not nil. The caller closes the reader.
+	GetObject(ctx context.Context, name string, rng *ObjectRange) (io.ReadCloser, error)
+
 	DeleteObject(ctx context.Context, name string) error
+	// DeleteObjects deletes names in batches of MaxDeleteObjects. Objects that could not be
+	// deleted are reported by a *DeleteObjectsError.
+	DeleteObjects(ctx context.Context, names []string) error
+
+	// ListObjects lists up to limit objects under prefix in key order. An empty continuationToken
+	// starts from the beginning, otherwise listing continues after the page that returned it.
+	ListObjects(ctx context.Context, prefix string, continuationToken string, limit int) (*ListObjectsResult, error)
 
 	CopyObject(ctx context.Context, src string, dst string) (*CopyObjectInfo, error)
 
@@ -159,6 +236,9 @@ type Interface interface {
 
 	AbortMultipartUpload(ctx context.Context, uploadID string, name string) error
 	ListUploadedParts(ctx context.Context, uploadID string, name string, partNumberMarker int, maxParts int) (*ListUploadedPartsResult, error)
+	// ListMultipartUploads lists up to limit unfinished multipart uploads under prefix, ordered by
+	// key and then upload. Listing continues after keyMarker and uploadIDMarker when they are set.
+	ListMultipartUploads(ctx context.Context, prefix string, keyMarker string, uploadIDMarker string, limit int) (*ListMultipartUploadsResult, error)
 
 	AccessURL(ctx context.Context, name string, expire time.Duration, opt *AccessURLOption) (string, error)
 